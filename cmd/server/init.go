@@ -4,12 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/auth"
+	"github.com/ayushgpt01/chatRoomGo/internal/blob"
 	"github.com/ayushgpt01/chatRoomGo/internal/event"
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/message"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/internal/presence"
 	"github.com/ayushgpt01/chatRoomGo/internal/room"
 	"github.com/ayushgpt01/chatRoomGo/internal/router"
 	"github.com/ayushgpt01/chatRoomGo/internal/seed"
@@ -21,21 +26,36 @@ func handlerInit(ctx context.Context, db *sql.DB) http.Handler {
 	userStore := user.NewPostgresUserRepo(ctx, db)
 	roomStore := room.NewPostgresRoomRepo(ctx, db)
 	messageStore := message.NewPostgresMessageRepo(ctx, db)
+	reactionStore := message.NewPostgresReactionRepo(ctx, db)
+	mentionStore := message.NewPostgresMentionRepo(ctx, db)
+	attachmentStore := message.NewPostgresAttachmentRepo(ctx, db)
+	pinStore := message.NewPostgresPinRepo(ctx, db)
+	scheduledStore := message.NewPostgresScheduledMessageRepo(ctx, db)
 	roomMemberStore := room.NewPostgresRoomMemberRepo(ctx, db)
+	inviteStore := room.NewPostgresInviteRepo(ctx, db)
 	authStore := auth.NewPostgresAuthRepo(ctx, db)
 
 	if err := seed.SeedChatData(context.Background(), db); err != nil {
 		logger.Error("Failed to seed chat data", "error", err)
 	}
 
-	hub := ws.NewHub(ctx)
+	hub := ws.NewHub(ctx, hubConfig())
 	go hub.Cleanup()
+	go hub.ReportStats(1 * time.Minute)
+
+	broadcaster := newBroadcaster(ctx, db, hub)
 
 	authService := auth.NewAuthService(userStore, authStore)
-	eventService := event.NewEventService(userStore, roomStore, messageStore, roomMemberStore)
-	roomService := room.NewRoomService(roomMemberStore, roomStore, authService, hub)
-	messageService := message.NewMessageService(messageStore, roomMemberStore, hub)
-	wsHandler := ws.NewWSHandler(hub, eventService)
+	roomService := room.NewRoomService(roomMemberStore, roomStore, inviteStore, authService, broadcaster)
+	messageService := message.NewMessageService(messageStore, reactionStore, mentionStore, attachmentStore, pinStore, newBlobStore(), roomMemberStore, broadcaster)
+	scheduleService := message.NewScheduleService(scheduledStore, roomMemberStore, messageService)
+	eventService := event.NewEventService(userStore, roomStore, messageStore, roomMemberStore, messageService)
+	presenceService := presence.NewPresenceService(ctx, roomMemberStore, broadcaster, 5*time.Minute)
+	hub.TrackPresence(presenceService)
+	messageService.TrackPresence(presenceService)
+	roomService.PurgeAttachmentsWith(messageService)
+	go presenceService.Run()
+	wsHandler := ws.NewWSHandler(hub, broadcaster, eventService, authService)
 
 	// Cleanup expired tokens every 1 hour
 	go func() {
@@ -54,5 +74,145 @@ func handlerInit(ctx context.Context, db *sql.DB) http.Handler {
 		}
 	}()
 
-	return router.HandleRoutes(wsHandler, authService, roomService, messageService)
+	// Post scheduled messages as they come due, checking every 10 seconds.
+	// Messages that came due while the server was down go out on the first run
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			publishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			if err := scheduleService.HandlePublishDue(publishCtx); err != nil {
+				logger.Error("Failed to publish scheduled messages", "error", err)
+			}
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Purge message tombstones past their retention, attachments left
+	// without a message for a day and expired send nonces every 1 hour
+	go func() {
+		retention := tombstoneRetention()
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purgeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				if err := messageService.HandlePurgeDeleted(purgeCtx, retention); err != nil {
+					logger.Error("Failed to purge deleted messages", "error", err)
+				}
+				if err := messageService.HandlePurgeAttachments(purgeCtx, 24*time.Hour); err != nil {
+					logger.Error("Failed to purge orphaned attachments", "error", err)
+				}
+				if err := messageService.HandlePurgeNonces(purgeCtx); err != nil {
+					logger.Error("Failed to purge message nonces", "error", err)
+				}
+				cancel()
+			}
+		}
+	}()
+
+	return router.HandleRoutes(wsHandler, authService, roomService, messageService, scheduleService, presenceService)
+}
+
+// newBroadcaster picks how room events reach sockets. With BROADCAST_BACKEND
+// set to "postgres" events go through LISTEN/NOTIFY so every replica's hub
+// receives them; otherwise they are delivered in-process.
+func newBroadcaster(ctx context.Context, db *sql.DB, hub *ws.Hub) models.HubBroadcaster {
+	switch os.Getenv("BROADCAST_BACKEND") {
+	case "postgres":
+		logger.Info("Using Postgres broadcast backend")
+		broadcaster := ws.NewPostgresBroadcaster(ctx, db, hub)
+		go broadcaster.Listen()
+		return broadcaster
+	default:
+		logger.Info("Using in-process broadcast backend")
+		return ws.NewLocalBroadcaster(hub)
+	}
+}
+
+// newBlobStore picks where attachments are kept. With BLOB_STORE set to
+// "s3" they go to the S3_BUCKET bucket at S3_ENDPOINT; otherwise they are
+// written under UPLOAD_DIR, "uploads" by default.
+func newBlobStore() blob.Store {
+	switch os.Getenv("BLOB_STORE") {
+	case "s3":
+		logger.Info("Using S3 blob store", "endpoint", os.Getenv("S3_ENDPOINT"), "bucket", os.Getenv("S3_BUCKET"))
+		return blob.NewS3Store(blob.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyId:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}, nil)
+	default:
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+
+		logger.Info("Using local blob store", "dir", dir)
+		store, err := blob.NewLocalStore(dir)
+		if err != nil {
+			logger.Error("Failed to create local blob store", "error", err)
+			os.Exit(1)
+		}
+
+		return store
+	}
+}
+
+// hubConfig reads the slow client limits from WS_SEND_QUEUE_SIZE and
+// WS_SLOW_CLIENT_TIMEOUT (a duration such as "10s"), keeping the defaults
+// for anything unset or invalid.
+func hubConfig() ws.Config {
+	config := ws.DefaultConfig()
+
+	if value := os.Getenv("WS_SEND_QUEUE_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			logger.Warn("Invalid WS_SEND_QUEUE_SIZE, using default", "value", value)
+		} else {
+			config.SendQueueSize = size
+		}
+	}
+
+	if value := os.Getenv("WS_SLOW_CLIENT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			logger.Warn("Invalid WS_SLOW_CLIENT_TIMEOUT, using default", "value", value)
+		} else {
+			config.SlowClientTimeout = timeout
+		}
+	}
+
+	return config
+}
+
+// tombstoneRetention reads how long deleted messages are kept as tombstones
+// from DELETED_MESSAGE_RETENTION (a duration such as "720h"), defaulting to
+// 30 days.
+func tombstoneRetention() time.Duration {
+	retention := 30 * 24 * time.Hour
+
+	if value := os.Getenv("DELETED_MESSAGE_RETENTION"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			logger.Warn("Invalid DELETED_MESSAGE_RETENTION, using default", "value", value)
+		} else {
+			retention = parsed
+		}
+	}
+
+	return retention
 }
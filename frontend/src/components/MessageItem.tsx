@@ -33,6 +33,7 @@ export default function MessageItem({
 	const isMine = message.senderId === currentUserId;
 	const isSending = Boolean(message.nonce);
 	const isEdited = Boolean(message.editedAt);
+	const isDeleted = Boolean(message.deletedAt);
 	const isConsecutive =
 		prevMessage &&
 		prevMessage.senderId === message.senderId &&
@@ -147,13 +148,19 @@ export default function MessageItem({
 				) : (
 					<div className="flex justify-between items-start gap-2">
 						<div className="flex-1 wrap-break-word">
-							{message.content}
-							{isEdited && (
+							{isDeleted ? (
+								<span className="italic opacity-60">
+									This message was deleted
+								</span>
+							) : (
+								message.content
+							)}
+							{isEdited && !isDeleted && (
 								<span className="text-xs opacity-60 ml-2 italic">(edited)</span>
 							)}
 						</div>
 
-						{isMine && !isSending && (
+						{isMine && !isSending && !isDeleted && (
 							<div className="opacity-0 group-hover:opacity-100 transition-opacity duration-200">
 								<button
 									popoverTarget={popoverId}
@@ -1,14 +1,25 @@
 import { useEffect } from "react";
 import useAuthStore from "@/stores/authStore";
 import useMessagesStore from "@/stores/messagesStore";
+import useRoomStore from "@/stores/roomStore";
 import useSocketStore from "@/stores/socketStore";
 import { useTypingStore } from "@/stores/typingStore";
 import {
+	type AckMessageEvent,
 	type ErrorEvent,
 	IncomingEventTypes,
+	type MemberRoleChangedEvent,
 	type MessageCreatedEvent,
 	type MessageDeletedEvent,
+	type MessagePinnedEvent,
+	type MessageUnpinnedEvent,
 	type MessageUpdatedEvent,
+	OutgoingEventTypes,
+	type ReactionUpdatedEvent,
+	type ReadMessageEvent,
+	type ReadReceiptUpdatedEvent,
+	type RoomDeletedEvent,
+	type RoomUpdatedEvent,
 	type UserStartedTypingEvent,
 	type UserStoppedTypingEvent,
 } from "@/types/events";
@@ -16,6 +27,7 @@ import {
 export default function useSocketEvents(roomId: number) {
 	const userId = useAuthStore((s) => s.user?.id);
 	const subscribe = useSocketStore((s) => s.subscribe);
+	const send = useSocketStore((s) => s.send);
 	const connect = useSocketStore((s) => s.connect);
 	const disconnect = useSocketStore((s) => s.disconnect);
 	const handleTypingEvent = useTypingStore((s) => s.handleTypingEvent);
@@ -28,7 +40,7 @@ export default function useSocketEvents(roomId: number) {
 			import.meta.env.VITE_ENV === "development"
 				? import.meta.env.VITE_WS_URL
 				: import.meta.env.VITE_API_ROUTE || window.location.host
-		}/ws?room=${roomId}&user=${userId}`;
+		}/ws?room=${roomId}`;
 
 		connect(wsUrl);
 
@@ -46,6 +58,31 @@ export default function useSocketEvents(roomId: number) {
 
 				// Use fresh state from the store instead of stale state
 				const currentStore = useMessagesStore.getState();
+
+				// Replies update their thread's summary instead of the timeline
+				const { threadId } = event.payload;
+				if (threadId) {
+					const thread = currentStore
+						.getMessage(roomId)
+						.messages.find((m) => m.id === threadId);
+
+					if (thread) {
+						currentStore.upsertMessage(roomId, {
+							...thread,
+							replyCount:
+								event.payload.replyCount ?? thread.replyCount + 1,
+							latestReply: {
+								id: msg.id,
+								content: msg.content,
+								senderId: msg.senderId,
+								senderName: msg.senderName,
+								sentAt: msg.sentAt,
+							},
+						});
+					}
+					return;
+				}
+
 				const existing = currentStore
 					.getMessage(roomId)
 					.messages.some((m) => m.id === msg.id);
@@ -53,6 +90,23 @@ export default function useSocketEvents(roomId: number) {
 				if (existing) return;
 
 				currentStore.upsertMessage(roomId, msg);
+
+				if (msg.senderId !== userId) {
+					const ack: AckMessageEvent = {
+						type: OutgoingEventTypes.EventAckMessage,
+						roomId,
+						data: { messageId: msg.id },
+					};
+					send(ack);
+
+					// The room is open, so the message has been seen
+					const read: ReadMessageEvent = {
+						type: OutgoingEventTypes.EventReadMessage,
+						roomId,
+						data: { messageId: msg.id },
+					};
+					send(read);
+				}
 			},
 		);
 
@@ -87,7 +141,108 @@ export default function useSocketEvents(roomId: number) {
 
 				if (!exists) return;
 
-				currentStore.removeMessage(roomId, event.payload.messageId);
+				currentStore.tombstoneMessage(
+					roomId,
+					event.payload.messageId,
+					event.payload.deletedBy,
+				);
+			},
+		);
+
+		const unsubReadReceipt = subscribe(
+			IncomingEventTypes.EventReadReceiptUpdated,
+			(event: ReadReceiptUpdatedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				useMessagesStore
+					.getState()
+					.applyReadReceipt(
+						roomId,
+						event.payload.userId,
+						event.payload.lastReadMessageId,
+					);
+			},
+		);
+
+		const unsubReaction = subscribe(
+			IncomingEventTypes.EventReactionUpdated,
+			(event: ReactionUpdatedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				const { messageId, emoji, count, added } = event.payload;
+				useMessagesStore
+					.getState()
+					.applyReaction(
+						roomId,
+						messageId,
+						emoji,
+						count,
+						event.payload.userId === userId ? added : undefined,
+					);
+			},
+		);
+
+		const unsubPinned = subscribe(
+			IncomingEventTypes.EventMessagePinned,
+			(event: MessagePinnedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				useMessagesStore
+					.getState()
+					.applyPinned(roomId, event.payload.message.id, true);
+			},
+		);
+
+		const unsubUnpinned = subscribe(
+			IncomingEventTypes.EventMessageUnpinned,
+			(event: MessageUnpinnedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				useMessagesStore
+					.getState()
+					.applyPinned(roomId, event.payload.messageId, false);
+			},
+		);
+
+		const unsubRoleChanged = subscribe(
+			IncomingEventTypes.EventMemberRoleChanged,
+			(event: MemberRoleChangedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				useRoomStore
+					.getState()
+					.applyRole(
+						roomId,
+						event.payload.userId,
+						event.payload.role,
+						event.payload.userId === userId,
+					);
+			},
+		);
+
+		const unsubRoomUpdated = subscribe(
+			IncomingEventTypes.EventRoomUpdated,
+			(event: RoomUpdatedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				const { name, topic, description, avatarUrl, visibility } =
+					event.payload;
+				useRoomStore.getState().applyDetails(roomId, {
+					name,
+					topic,
+					description,
+					avatarUrl,
+					visibility,
+				});
+			},
+		);
+
+		const unsubRoomDeleted = subscribe(
+			IncomingEventTypes.EventRoomDeleted,
+			(event: RoomDeletedEvent) => {
+				if (event.payload.roomId !== roomId) return;
+
+				useRoomStore.getState().removeRoom(roomId);
 			},
 		);
 
@@ -126,9 +281,16 @@ export default function useSocketEvents(roomId: number) {
 			unsubCreated();
 			unsubUpdated();
 			unsubDeleted();
+			unsubReadReceipt();
+			unsubReaction();
+			unsubPinned();
+			unsubUnpinned();
+			unsubRoleChanged();
+			unsubRoomUpdated();
+			unsubRoomDeleted();
 			unsubError();
 			unsubStartedTyping();
 			unsubStoppedTyping();
 		};
-	}, [roomId, subscribe, handleTypingEvent, userId]);
+	}, [roomId, subscribe, send, handleTypingEvent, userId]);
 }
@@ -95,6 +95,7 @@ function RoomComponent() {
 		if (isTyping) {
 			socketSend({
 				type: OutgoingEventTypes.EventStopTyping,
+				roomId: Number(roomId),
 				data: { roomId: Number(roomId) },
 			});
 			setIsTyping(false);
@@ -109,6 +110,7 @@ function RoomComponent() {
 		const id = window.setTimeout(() => {
 			socketSend({
 				type: OutgoingEventTypes.EventStopTyping,
+				roomId: Number(roomId),
 				data: { roomId: Number(roomId) },
 			});
 			setIsTyping(false);
@@ -121,6 +123,7 @@ function RoomComponent() {
 		if (!isTyping) {
 			socketSend({
 				type: OutgoingEventTypes.EventStartTyping,
+				roomId: Number(roomId),
 				data: { roomId: Number(roomId) },
 			});
 			setIsTyping(true);
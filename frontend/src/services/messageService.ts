@@ -1,22 +1,40 @@
 import { z } from "zod";
 import axiosClient from "@/integrations/axios/axiosClient";
 import {
+	type Attachment,
+	AttachmentSchema,
 	GetMessageSchema,
 	type GetMessages,
 	type Message,
 	MessageSchema,
+	type ScheduledMessage,
+	ScheduledMessageSchema,
 } from "@/types/message";
 
 interface GetMessagesResponse {
 	messages: Message[];
+	prevCursor: string | null;
 	nextCursor: string | null;
 }
 
-const SendMessageSchema = z.object({
-	roomId: z.coerce.number(),
-	content: z.string().min(1),
-	nonce: z.string(),
-});
+interface GetPinsResponse {
+	pins: {
+		message: Message;
+		pinnedBy: number | null;
+		pinnedAt: string;
+	}[];
+}
+
+const SendMessageSchema = z
+	.object({
+		roomId: z.coerce.number(),
+		content: z.string(),
+		nonce: z.string(),
+		attachmentIds: z.array(z.number()).max(10).optional(),
+	})
+	.refine((m) => m.content.trim() !== "" || m.attachmentIds?.length, {
+		message: "Message needs content or attachments",
+	});
 
 const EditMessageSchema = z.object({
 	roomId: z.coerce.number(),
@@ -29,13 +47,31 @@ const DeleteMessageSchema = z.object({
 	messageId: z.coerce.number(),
 });
 
+const ScheduleMessageSchema = z.object({
+	roomId: z.coerce.number(),
+	content: z.string().trim().min(1).max(2000),
+	sendAt: z.date(),
+});
+
+const EditScheduledSchema = z
+	.object({
+		roomId: z.coerce.number(),
+		scheduledId: z.coerce.number(),
+		content: z.string().trim().min(1).max(2000).optional(),
+		sendAt: z.date().optional(),
+	})
+	.refine((m) => m.content !== undefined || m.sendAt !== undefined, {
+		message: "Nothing to change",
+	});
+
 const messageService = {
 	getHistory: async (payload: GetMessages) => {
-		const { cursor, limit, roomId } = GetMessageSchema.parse(payload);
+		const { before, after, around, limit, roomId } =
+			GetMessageSchema.parse(payload);
 
 		const response = await axiosClient.get<GetMessagesResponse>(
 			`/room/${roomId}/messages`,
-			{ params: { cursor, limit } },
+			{ params: { before, after, around, limit } },
 		);
 
 		const data = response.data;
@@ -46,13 +82,15 @@ const messageService = {
 	},
 
 	sendMessage: async (payload: z.infer<typeof SendMessageSchema>) => {
-		const { roomId, content, nonce } = SendMessageSchema.parse(payload);
+		const { roomId, content, nonce, attachmentIds } =
+			SendMessageSchema.parse(payload);
 
 		const response = await axiosClient.post<Message>(
 			`/room/${roomId}/messages`,
 			{
 				content,
 				nonce,
+				attachmentIds,
 			},
 		);
 
@@ -75,6 +113,83 @@ const messageService = {
 
 		await axiosClient.delete(`/room/${roomId}/messages/${messageId}`);
 	},
+
+	getPins: async (roomId: number) => {
+		const response = await axiosClient.get<GetPinsResponse>(
+			`/room/${roomId}/pins`,
+		);
+
+		z.array(MessageSchema).parse(response.data.pins.map((p) => p.message));
+
+		return response.data.pins;
+	},
+
+	pinMessage: async (roomId: number, messageId: number) => {
+		await axiosClient.put(`/room/${roomId}/messages/${messageId}/pin`);
+	},
+
+	unpinMessage: async (roomId: number, messageId: number) => {
+		await axiosClient.delete(`/room/${roomId}/messages/${messageId}/pin`);
+	},
+
+	getScheduled: async (roomId: number) => {
+		const response = await axiosClient.get<{ messages: ScheduledMessage[] }>(
+			`/room/${roomId}/scheduled`,
+		);
+
+		return z.array(ScheduledMessageSchema).parse(response.data.messages);
+	},
+
+	scheduleMessage: async (payload: z.infer<typeof ScheduleMessageSchema>) => {
+		const { roomId, content, sendAt } = ScheduleMessageSchema.parse(payload);
+
+		const response = await axiosClient.post<ScheduledMessage>(
+			`/room/${roomId}/scheduled`,
+			{ content, sendAt: sendAt.toISOString() },
+		);
+
+		return ScheduledMessageSchema.parse(response.data);
+	},
+
+	editScheduled: async (payload: z.infer<typeof EditScheduledSchema>) => {
+		const { roomId, scheduledId, content, sendAt } =
+			EditScheduledSchema.parse(payload);
+
+		const response = await axiosClient.patch<ScheduledMessage>(
+			`/room/${roomId}/scheduled/${scheduledId}`,
+			{ content, sendAt: sendAt?.toISOString() },
+		);
+
+		return ScheduledMessageSchema.parse(response.data);
+	},
+
+	cancelScheduled: async (roomId: number, scheduledId: number) => {
+		await axiosClient.delete(`/room/${roomId}/scheduled/${scheduledId}`);
+	},
+
+	uploadAttachment: async (roomId: number, file: File) => {
+		const form = new FormData();
+		form.append("file", file);
+
+		const response = await axiosClient.post<Attachment>(
+			`/room/${roomId}/attachments`,
+			form,
+			{ headers: { "Content-Type": "multipart/form-data" } },
+		);
+
+		return AttachmentSchema.parse(response.data);
+	},
+
+	// Downloads need the auth header, so they are fetched as blobs rather
+	// than linked to directly
+	getAttachment: async (attachmentId: number, thumbnail = false) => {
+		const response = await axiosClient.get<Blob>(
+			`/attachments/${attachmentId}${thumbnail ? "/thumbnail" : ""}`,
+			{ responseType: "blob" },
+		);
+
+		return response.data;
+	},
 };
 
 export default messageService;
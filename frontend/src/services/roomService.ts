@@ -2,10 +2,19 @@ import { z } from "zod";
 import axiosClient from "@/integrations/axios/axiosClient";
 import { UserSchema } from "@/types/auth";
 import {
+	type DirectoryRoom,
+	DirectoryRoomSchema,
+	type GetDirectory,
+	GetDirectorySchema,
 	type GetRooms,
 	GetRoomsSchema,
 	type Room,
+	type RoomDetails,
+	type RoomInvite,
+	RoomInviteSchema,
+	type RoomRole,
 	RoomSchema,
+	type RoomVisibility,
 } from "@/types/room";
 import type { LoginResponse } from "./authService";
 
@@ -18,15 +27,34 @@ type CreateRoomResponse = {
 	room: Room;
 };
 
+type GetDirectoryResponse = {
+	rooms: DirectoryRoom[];
+	nextCursor: string | null;
+};
+
+type CreateDMResponse = {
+	room: Room;
+};
+
+type UpdateRoomResponse = {
+	room: Room;
+};
+
+type GetInvitesResponse = {
+	invites: RoomInvite[];
+};
+
 type GetRoomsResponse = {
 	rooms: Room[];
 	nextCursor: string | null;
 };
 
 export const roomService = {
-	join: async (roomId: number) => {
+	// Private rooms can only be joined with an invite token
+	join: async (roomId: number, invite?: string) => {
 		const response = await axiosClient.post<JoinRoomResponse>("/room/join", {
 			roomId,
+			invite,
 		});
 
 		const data = response.data;
@@ -45,10 +73,10 @@ export const roomService = {
 		await axiosClient.post("/room/leave", { roomId });
 	},
 
-	create: async (roomName: string) => {
+	create: async (roomName: string, visibility: RoomVisibility = "public") => {
 		const response = await axiosClient.post<CreateRoomResponse>(
 			"/room/create",
-			{ name: roomName },
+			{ name: roomName, visibility },
 		);
 
 		const data = response.data;
@@ -67,4 +95,83 @@ export const roomService = {
 		z.array(RoomSchema).parse(data.rooms);
 		return data;
 	},
+
+	// Public rooms anyone can join, searched by name or topic
+	getDirectory: async (payload: GetDirectory) => {
+		const params = GetDirectorySchema.parse(payload);
+
+		const response = await axiosClient.get<GetDirectoryResponse>(
+			"/rooms/directory",
+			{ params },
+		);
+
+		const data = response.data;
+		z.array(DirectoryRoomSchema).parse(data.rooms);
+		return data;
+	},
+
+	// Returns the existing DM with these users or starts one
+	createDM: async (userIds: number[]) => {
+		const response = await axiosClient.post<CreateDMResponse>("/dm", {
+			userIds,
+		});
+
+		const data = response.data;
+		RoomSchema.parse(data.room);
+		return data;
+	},
+
+	// Only the owner may update or delete a room
+	update: async (roomId: number, details: RoomDetails) => {
+		const response = await axiosClient.patch<UpdateRoomResponse>(
+			`/room/${roomId}`,
+			details,
+		);
+
+		const data = response.data;
+		RoomSchema.parse(data.room);
+		return data;
+	},
+
+	remove: async (roomId: number) => {
+		await axiosClient.delete(`/room/${roomId}`);
+	},
+
+	// Only the owner may, and only between moderator and member
+	setRole: async (
+		roomId: number,
+		userId: number,
+		role: Exclude<RoomRole, "owner">,
+	) => {
+		await axiosClient.put(`/room/${roomId}/members/${userId}/role`, {
+			role,
+		});
+	},
+
+	getInvites: async (roomId: number) => {
+		const response = await axiosClient.get<GetInvitesResponse>(
+			`/room/${roomId}/invites`,
+		);
+
+		const data = response.data;
+		z.array(RoomInviteSchema).parse(data.invites);
+		return data;
+	},
+
+	// Invites last a week unless expiresAt is given
+	createInvite: async (
+		roomId: number,
+		options: { expiresAt?: string; maxUses?: number } = {},
+	) => {
+		const response = await axiosClient.post<RoomInvite>(
+			`/room/${roomId}/invites`,
+			options,
+		);
+
+		return RoomInviteSchema.parse(response.data);
+	},
+
+	revokeInvite: async (roomId: number, inviteId: number) => {
+		await axiosClient.delete(`/room/${roomId}/invites/${inviteId}`);
+	},
 };
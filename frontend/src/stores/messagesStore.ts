@@ -34,6 +34,24 @@ export interface MessagesState {
 	) => void;
 	upsertMessage: (roomId: number, message: Message) => void;
 	removeMessage: (roomId: number, messageId: number) => void;
+	tombstoneMessage: (
+		roomId: number,
+		messageId: number,
+		deletedBy: number,
+	) => void;
+	applyReadReceipt: (
+		roomId: number,
+		userId: number,
+		lastReadMessageId: number,
+	) => void;
+	applyReaction: (
+		roomId: number,
+		messageId: number,
+		emoji: string,
+		count: number,
+		mine?: boolean,
+	) => void;
+	applyPinned: (roomId: number, messageId: number, pinned: boolean) => void;
 
 	reset: () => void;
 }
@@ -62,10 +80,11 @@ const useMessagesStore = create<MessagesState>()((set, get) => ({
 		try {
 			set({ loading: true, error: null });
 
-			const { messages, nextCursor } = await messageService.getHistory({
+			// Pages load newest first, each one older than the last
+			const { messages, prevCursor } = await messageService.getHistory({
 				limit: 50,
 				roomId,
-				cursor: current.cursor,
+				before: current.cursor,
 			});
 
 			set((state) => ({
@@ -73,11 +92,11 @@ const useMessagesStore = create<MessagesState>()((set, get) => ({
 					...state.messagesPerRoom,
 					[roomId]: {
 						messages: [
-							...(state.messagesPerRoom[roomId]?.messages ?? []),
 							...messages,
+							...(state.messagesPerRoom[roomId]?.messages ?? []),
 						],
-						cursor: nextCursor,
-						hasMore: nextCursor !== null,
+						cursor: prevCursor,
+						hasMore: prevCursor !== null,
 					},
 				},
 				loading: false,
@@ -104,6 +123,12 @@ const useMessagesStore = create<MessagesState>()((set, get) => ({
 			nonce,
 			delivered: false,
 			readBy: [],
+			replyCount: 0,
+			revisionCount: 0,
+			pinned: false,
+			reactions: [],
+			mentions: [],
+			attachments: [],
 		};
 
 		// optimistic insert
@@ -261,6 +286,109 @@ const useMessagesStore = create<MessagesState>()((set, get) => ({
 			},
 		}));
 	},
+
+	tombstoneMessage: (roomId, messageId, deletedBy) => {
+		const current = get().messagesPerRoom[roomId];
+		if (!current) return;
+
+		set((state) => ({
+			messagesPerRoom: {
+				...state.messagesPerRoom,
+				[roomId]: {
+					...current,
+					messages: current.messages.map((m) =>
+						m.id === messageId
+							? {
+									...m,
+									content: "",
+									deletedAt: new Date().toISOString(),
+									deletedBy,
+									reactions: [],
+									mentions: [],
+									attachments: [],
+								}
+							: m,
+					),
+				},
+			},
+		}));
+	},
+
+	applyReadReceipt: (roomId, userId, lastReadMessageId) => {
+		const current = get().messagesPerRoom[roomId];
+		if (!current) return;
+
+		set((state) => ({
+			messagesPerRoom: {
+				...state.messagesPerRoom,
+				[roomId]: {
+					...current,
+					messages: current.messages.map((m) =>
+						m.id === 0 ||
+						m.id > lastReadMessageId ||
+						m.readBy?.includes(userId)
+							? m
+							: { ...m, readBy: [...(m.readBy ?? []), userId] },
+					),
+				},
+			},
+		}));
+	},
+
+	applyReaction: (roomId, messageId, emoji, count, mine) => {
+		const current = get().messagesPerRoom[roomId];
+		if (!current) return;
+
+		// Socket payloads skip schema parsing, so reactions may be missing
+		const update = (m: Message): Message => {
+			const reactions = m.reactions ?? [];
+			const existing = reactions.find((r) => r.emoji === emoji);
+			const reactedByMe = mine ?? existing?.reactedByMe ?? false;
+			const others = reactions.filter((r) => r.emoji !== emoji);
+			if (count === 0) return { ...m, reactions: others };
+			if (!existing) {
+				return {
+					...m,
+					reactions: [...reactions, { emoji, count, reactedByMe }],
+				};
+			}
+			return {
+				...m,
+				reactions: reactions.map((r) =>
+					r.emoji === emoji ? { emoji, count, reactedByMe } : r,
+				),
+			};
+		};
+
+		set((state) => ({
+			messagesPerRoom: {
+				...state.messagesPerRoom,
+				[roomId]: {
+					...current,
+					messages: current.messages.map((m) =>
+						m.id === messageId ? update(m) : m,
+					),
+				},
+			},
+		}));
+	},
+
+	applyPinned: (roomId, messageId, pinned) => {
+		const current = get().messagesPerRoom[roomId];
+		if (!current) return;
+
+		set((state) => ({
+			messagesPerRoom: {
+				...state.messagesPerRoom,
+				[roomId]: {
+					...current,
+					messages: current.messages.map((m) =>
+						m.id === messageId ? { ...m, pinned } : m,
+					),
+				},
+			},
+		}));
+	},
 }));
 
 export default useMessagesStore;
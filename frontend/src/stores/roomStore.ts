@@ -3,7 +3,7 @@ import { create } from "zustand";
 import { persist } from "zustand/middleware";
 import type { LoginResponse } from "@/services/authService";
 import { roomService } from "@/services/roomService";
-import type { Room } from "@/types/room";
+import type { Room, RoomDetails, RoomRole } from "@/types/room";
 import { getErrorMessage } from "@/utils/errorHandler";
 
 export interface RoomState {
@@ -23,6 +23,15 @@ export interface RoomState {
 	join: (roomId: number) => Promise<{ login: LoginResponse | undefined }>;
 	leave: () => Promise<void>;
 	getRooms: () => Promise<void>;
+	applyRole: (
+		roomId: number,
+		userId: number,
+		role: RoomRole,
+		isSelf: boolean,
+	) => void;
+	applyDetails: (roomId: number, details: RoomDetails) => void;
+	// Forgets a room that was deleted
+	removeRoom: (roomId: number) => void;
 }
 
 const useRoomStore = create<RoomState>()(
@@ -122,6 +131,38 @@ const useRoomStore = create<RoomState>()(
 					});
 				}
 			},
+			applyRole: (roomId, userId, role, isSelf) => {
+				const update = (room: Room): Room =>
+					room.id !== roomId
+						? room
+						: {
+								...room,
+								role: isSelf ? role : room.role,
+								members: room.members?.map((m) =>
+									m.id === userId ? { ...m, role } : m,
+								),
+							};
+
+				set((state) => ({
+					room: state.room ? update(state.room) : null,
+					roomsList: state.roomsList.map(update),
+				}));
+			},
+			applyDetails: (roomId, details) => {
+				const update = (room: Room): Room =>
+					room.id !== roomId ? room : { ...room, ...details };
+
+				set((state) => ({
+					room: state.room ? update(state.room) : null,
+					roomsList: state.roomsList.map(update),
+				}));
+			},
+			removeRoom: (roomId) => {
+				set((state) => ({
+					room: state.room?.id === roomId ? null : state.room,
+					roomsList: state.roomsList.filter((r) => r.id !== roomId),
+				}));
+			},
 		}),
 		{
 			name: "room-storage",
@@ -26,6 +26,7 @@ let reconnectTimeout: ReturnType<typeof setTimeout>;
 let retryCount = 0;
 
 const CLOSE_CODE = 1000;
+const ACCESS_TOKEN_PROTOCOL = "access_token";
 const MAX_RECONNECT_DELAY = 30000;
 const messageQueue: string[] = [];
 const MAX_QUEUE_SIZE = 100;
@@ -47,7 +48,9 @@ const useSocketStore = create<SocketState>((set, get) => ({
 			return;
 		}
 
-		const socket = new WebSocket(url);
+		// The server reads the access token from the second subprotocol entry
+		const token = localStorage.getItem("token") ?? "";
+		const socket = new WebSocket(url, [ACCESS_TOKEN_PROTOCOL, token]);
 		set({ socket, status: "connecting", error: null, currentUrl: url });
 
 		socket.onopen = () => {
@@ -5,6 +5,8 @@ export const UserSchema = z.object({
 	username: z.string().max(255),
 	name: z.string().min(2),
 	isAnonymous: z.boolean().optional(),
+	// Set when the user is listed as a member of a room
+	role: z.enum(["owner", "moderator", "member"]).optional(),
 });
 
 export type User = z.infer<typeof UserSchema>;
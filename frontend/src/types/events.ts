@@ -1,4 +1,5 @@
 import type { Message } from "./message";
+import type { RoomRole, RoomVisibility } from "./room";
 
 // ---- BASE TYPES ---------
 
@@ -8,6 +9,10 @@ export enum OutgoingEventTypes {
 	EventDeleteMessage = "message.delete",
 	EventStartTyping = "typing.start",
 	EventStopTyping = "typing.stop",
+	EventAckMessage = "message.ack",
+	EventReadMessage = "message.read",
+	EventReactMessage = "message.react",
+	EventUnreactMessage = "message.unreact",
 }
 
 export enum IncomingEventTypes {
@@ -18,6 +23,15 @@ export enum IncomingEventTypes {
 	EventUserLeftRoom = "user_left_room",
 	EventUserStartedTyping = "user_started_typing",
 	EventUserStoppedTyping = "user_stopped_typing",
+	EventReadReceiptUpdated = "read_receipt_updated",
+	EventReactionUpdated = "reaction_updated",
+	EventMentioned = "mentioned",
+	EventMessagePinned = "message_pinned",
+	EventMessageUnpinned = "message_unpinned",
+	EventMemberRoleChanged = "member_role_changed",
+	EventRoomUpdated = "room_updated",
+	EventRoomDeleted = "room_deleted",
+	EventDMCreated = "dm_created",
 	EventError = "error",
 }
 
@@ -28,6 +42,7 @@ export type ServerEvent<T extends IncomingEventTypes, P> = {
 
 export type ClientEvent<T extends OutgoingEventTypes, D> = {
 	type: T;
+	roomId: number;
 	data: D;
 };
 
@@ -35,7 +50,7 @@ export type ClientEvent<T extends OutgoingEventTypes, D> = {
 
 export type MessageCreatedEvent = ServerEvent<
 	IncomingEventTypes.EventMessageCreated,
-	{ message: Message }
+	{ message: Message; threadId?: number; replyCount?: number }
 >;
 
 export type MessageUpdatedEvent = ServerEvent<
@@ -48,6 +63,7 @@ export type MessageDeletedEvent = ServerEvent<
 	{
 		messageId: number;
 		roomId: number;
+		deletedBy: number;
 	}
 >;
 
@@ -72,6 +88,7 @@ export enum ErrorCodes {
 	NotRoomMember = "not_room_member",
 	Forbidden = "forbidden",
 	UnsupportedEvent = "unsupported_event",
+	Unauthorized = "unauthorized",
 	InternalError = "internal_error",
 }
 
@@ -101,6 +118,97 @@ export type UserStoppedTypingEvent = ServerEvent<
 	}
 >;
 
+export type ReadReceiptUpdatedEvent = ServerEvent<
+	IncomingEventTypes.EventReadReceiptUpdated,
+	{
+		roomId: number;
+		userId: number;
+		lastReadMessageId: number;
+	}
+>;
+
+export type ReactionUpdatedEvent = ServerEvent<
+	IncomingEventTypes.EventReactionUpdated,
+	{
+		messageId: number;
+		roomId: number;
+		userId: number;
+		emoji: string;
+		count: number;
+		added: boolean;
+	}
+>;
+
+export type MentionedEvent = ServerEvent<
+	IncomingEventTypes.EventMentioned,
+	{
+		roomId: number;
+		message: Message;
+	}
+>;
+
+export type MessagePinnedEvent = ServerEvent<
+	IncomingEventTypes.EventMessagePinned,
+	{
+		roomId: number;
+		message: Message;
+		pinnedBy: number;
+		pinnedAt: string;
+	}
+>;
+
+export type MessageUnpinnedEvent = ServerEvent<
+	IncomingEventTypes.EventMessageUnpinned,
+	{
+		roomId: number;
+		messageId: number;
+		unpinnedBy: number | null;
+	}
+>;
+
+export type MemberRoleChangedEvent = ServerEvent<
+	IncomingEventTypes.EventMemberRoleChanged,
+	{
+		roomId: number;
+		userId: number;
+		role: RoomRole;
+		changedBy: number | null;
+	}
+>;
+
+export type RoomUpdatedEvent = ServerEvent<
+	IncomingEventTypes.EventRoomUpdated,
+	{
+		roomId: number;
+		name: string;
+		topic: string;
+		description: string;
+		avatarUrl: string;
+		visibility: RoomVisibility;
+		updatedBy: number;
+		updatedAt: string;
+	}
+>;
+
+// The room's last event; the socket gets nothing more from it
+export type RoomDeletedEvent = ServerEvent<
+	IncomingEventTypes.EventRoomDeleted,
+	{
+		roomId: number;
+		deletedBy: number;
+	}
+>;
+
+// Sent to the other participants when a DM starts or they are brought back
+export type DMCreatedEvent = ServerEvent<
+	IncomingEventTypes.EventDMCreated,
+	{
+		roomId: number;
+		participants: number[];
+		createdBy: number;
+	}
+>;
+
 export type IncomingSocketEvent =
 	| MessageCreatedEvent
 	| MessageUpdatedEvent
@@ -109,6 +217,15 @@ export type IncomingSocketEvent =
 	| UserLeftRoomEvent
 	| UserStartedTypingEvent
 	| UserStoppedTypingEvent
+	| ReadReceiptUpdatedEvent
+	| ReactionUpdatedEvent
+	| MentionedEvent
+	| MessagePinnedEvent
+	| MessageUnpinnedEvent
+	| MemberRoleChangedEvent
+	| RoomUpdatedEvent
+	| RoomDeletedEvent
+	| DMCreatedEvent
 	| ErrorEvent;
 
 // ---- Client TYPES ---------
@@ -150,9 +267,35 @@ export type StopTypingEvent = ClientEvent<
 	}
 >;
 
+export type AckMessageEvent = ClientEvent<
+	OutgoingEventTypes.EventAckMessage,
+	{
+		messageId: number;
+	}
+>;
+
+export type ReadMessageEvent = ClientEvent<
+	OutgoingEventTypes.EventReadMessage,
+	{
+		messageId: number;
+	}
+>;
+
+export type ReactMessageEvent = ClientEvent<
+	| OutgoingEventTypes.EventReactMessage
+	| OutgoingEventTypes.EventUnreactMessage,
+	{
+		messageId: number;
+		emoji: string;
+	}
+>;
+
 export type OutgoingSocketEvent =
 	| SendMessageEvent
 	| EditMessageEvent
 	| DeleteMessageEvent
 	| StartTypingEvent
-	| StopTypingEvent;
+	| StopTypingEvent
+	| AckMessageEvent
+	| ReadMessageEvent
+	| ReactMessageEvent;
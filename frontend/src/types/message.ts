@@ -1,5 +1,17 @@
 import { z } from "zod";
 
+export const AttachmentSchema = z.object({
+	id: z.number(),
+	fileName: z.string(),
+	contentType: z.string(),
+	size: z.number(),
+	width: z.number().nullable(),
+	height: z.number().nullable(),
+	hasThumbnail: z.boolean(),
+});
+
+export type Attachment = z.infer<typeof AttachmentSchema>;
+
 export const MessageSchema = z.object({
 	id: z.coerce.number(),
 	roomId: z.coerce.number(),
@@ -11,6 +23,42 @@ export const MessageSchema = z.object({
 	nonce: z.string().nullable().optional(),
 	delivered: z.boolean().default(true),
 	readBy: z.array(z.number()).nullable().optional(),
+	parentId: z.number().nullable().optional(),
+	replyCount: z.number().default(0),
+	deletedAt: z.string().nullable().optional(),
+	deletedBy: z.number().nullable().optional(),
+	revisionCount: z.number().default(0),
+	pinned: z.boolean().default(false),
+	latestReply: z
+		.object({
+			id: z.number(),
+			content: z.string(),
+			senderId: z.number(),
+			senderName: z.string(),
+			sentAt: z.string(),
+		})
+		.nullable()
+		.optional(),
+	reactions: z
+		.array(
+			z.object({
+				emoji: z.string(),
+				count: z.number(),
+				reactedByMe: z.boolean(),
+			}),
+		)
+		.default([]),
+	mentions: z
+		.array(
+			z.object({
+				kind: z.enum(["user", "room", "here"]),
+				userId: z.number().optional(),
+				start: z.number(),
+				end: z.number(),
+			}),
+		)
+		.default([]),
+	attachments: z.array(AttachmentSchema).default([]),
 });
 
 export type Message = z.infer<typeof MessageSchema>;
@@ -18,11 +66,27 @@ export type Message = z.infer<typeof MessageSchema>;
 export const GetMessageSchema = z.object({
 	limit: z.coerce.number().min(1).max(100).default(50),
 	roomId: z.coerce.number(),
-	cursor: z.string().nullable(),
+	before: z.string().nullable().optional(),
+	after: z.string().nullable().optional(),
+	around: z.string().nullable().optional(),
 });
 
 export type GetMessages = z.infer<typeof GetMessageSchema>;
 
+export const ScheduledMessageSchema = z.object({
+	id: z.number(),
+	roomId: z.number(),
+	userId: z.number(),
+	content: z.string(),
+	sendAt: z.string(),
+	status: z.enum(["pending", "sending", "failed"]),
+	failure: z.string().nullable(),
+	createdAt: z.string(),
+	updatedAt: z.string(),
+});
+
+export type ScheduledMessage = z.infer<typeof ScheduledMessageSchema>;
+
 // Typing event types
 export const TypingEventSchema = z.object({
 	type: z.enum(["user_started_typing", "user_stopped_typing"]),
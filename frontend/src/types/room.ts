@@ -1,19 +1,99 @@
 import { z } from "zod";
 import { UserSchema } from "./auth";
 
+export const RoomRoleSchema = z.enum(["owner", "moderator", "member"]);
+
+export type RoomRole = z.infer<typeof RoomRoleSchema>;
+
+export const RoomVisibilitySchema = z.enum(["public", "private"]);
+
+export type RoomVisibility = z.infer<typeof RoomVisibilitySchema>;
+
+// A DM has no name of its own; the server names it after the other
+// participants
+export const RoomKindSchema = z.enum(["room", "dm"]);
+
+export type RoomKind = z.infer<typeof RoomKindSchema>;
+
 export const RoomSchema = z.object({
 	id: z.coerce.number(),
 	name: z.string(),
+	topic: z.string().default(""),
+	description: z.string().default(""),
+	avatarUrl: z.string().default(""),
+	visibility: RoomVisibilitySchema.default("public"),
+	kind: RoomKindSchema.default("room"),
 	participantCount: z.number().default(1),
 	updatedAt: z.string(),
 	members: z.array(UserSchema).optional(),
+	unreadCount: z.number().default(0),
+	lastMessage: z
+		.object({
+			id: z.number(),
+			content: z.string(),
+			senderId: z.number(),
+			senderName: z.string(),
+			sentAt: z.string(),
+		})
+		.nullable()
+		.optional(),
+	lastActivityAt: z.string().optional(),
+	// The current user's role in the room
+	role: RoomRoleSchema.default("member"),
 });
 
 export type Room = z.infer<typeof RoomSchema>;
 
+// The details only the owner may change; unset fields stay as they are
+export type RoomDetails = Partial<
+	Pick<Room, "name" | "topic" | "description" | "avatarUrl" | "visibility">
+>;
+
 export const GetRoomsSchema = z.object({
 	limit: z.coerce.number().min(1).max(100).default(50),
 	cursor: z.string().nullable(),
 });
 
 export type GetRooms = z.infer<typeof GetRoomsSchema>;
+
+export const RoomInviteSchema = z.object({
+	id: z.coerce.number(),
+	roomId: z.coerce.number(),
+	token: z.string(),
+	createdBy: z.coerce.number().nullable(),
+	expiresAt: z.string(),
+	// null allows any number of uses
+	maxUses: z.number().nullable(),
+	uses: z.number(),
+	revokedAt: z.string().nullable(),
+	createdAt: z.string(),
+});
+
+export type RoomInvite = z.infer<typeof RoomInviteSchema>;
+
+export const DirectorySortSchema = z.enum(["members", "activity"]);
+
+export type DirectorySort = z.infer<typeof DirectorySortSchema>;
+
+export const GetDirectorySchema = z.object({
+	q: z.string().optional(),
+	sort: DirectorySortSchema.default("members"),
+	limit: z.coerce.number().min(1).max(100).default(20),
+	cursor: z.string().nullable(),
+});
+
+export type GetDirectory = z.input<typeof GetDirectorySchema>;
+
+// A public room as listed in the directory
+export const DirectoryRoomSchema = z.object({
+	id: z.coerce.number(),
+	name: z.string(),
+	topic: z.string(),
+	description: z.string(),
+	avatarUrl: z.string(),
+	memberCount: z.number(),
+	lastActivityAt: z.string(),
+	joined: z.boolean(),
+});
+
+export type DirectoryRoom = z.infer<typeof DirectoryRoomSchema>;
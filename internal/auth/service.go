@@ -38,6 +38,14 @@ func (srv *AuthService) generateAccessToken(userId models.UserId) (string, error
 }
 
 func (srv *AuthService) getByAccessToken(tokenString string) (models.UserId, error) {
+	userId, _, err := srv.ParseAccessToken(tokenString)
+	return userId, err
+}
+
+// ParseAccessToken validates an access token and returns the user it was
+// issued for along with its expiry, so long-lived connections can be cut
+// off once the token is no longer valid.
+func (srv *AuthService) ParseAccessToken(tokenString string) (models.UserId, time.Time, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -46,16 +54,25 @@ func (srv *AuthService) getByAccessToken(tokenString string) (models.UserId, err
 	})
 
 	if err != nil || !token.Valid {
-		return 0, models.ErrUnauthorized
+		return 0, time.Time{}, models.ErrUnauthorized
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if sub, ok := claims["sub"].(float64); ok {
-			return models.UserId(sub), nil
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, time.Time{}, models.ErrUnauthorized
+	}
+
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return 0, time.Time{}, models.ErrUnauthorized
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return 0, time.Time{}, models.ErrUnauthorized
 	}
 
-	return 0, models.ErrUnauthorized
+	return models.UserId(sub), exp.Time, nil
 }
 
 func (srv *AuthService) generateRefreshToken() (string, error) {
@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// LocalStore keeps blobs as files under a directory on disk.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("creating blob directory %s: %w", root, err)
+	}
+
+	return &LocalStore{root}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	path := filepath.FromSlash(key)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("blob key %q: %w", key, models.ErrInvalidInput)
+	}
+
+	return filepath.Join(s.root, path), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("creating directory for blob %s: %w", key, err)
+	}
+
+	// Write beside the target and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file for blob %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing blob %s: %w", key, err)
+	}
+
+	if written != size {
+		return fmt.Errorf("writing blob %s: got %d bytes, want %d", key, written, size)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storing blob %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s: %w", key, models.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening blob %s: %w", key, err)
+	}
+
+	return file, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting blob %s: %w", key, err)
+	}
+
+	return nil
+}
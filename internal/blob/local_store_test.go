@@ -0,0 +1,51 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "rooms/1/abc", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	body, err := store.Get(ctx, "rooms/1/abc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "hello" {
+		t.Errorf("Get = %q, want %q", data, "hello")
+	}
+
+	if err := store.Delete(ctx, "rooms/1/abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := store.Get(ctx, "rooms/1/abc"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, models.ErrInvalidInput) {
+		t.Errorf("Put outside root error = %v, want ErrInvalidInput", err)
+	}
+
+	if err := store.Put(ctx, "short", strings.NewReader("abc"), 5, "text/plain"); err == nil {
+		t.Error("Put with short body succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+package blob
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// fakeS3 is a stand-in for an S3 bucket that checks each request's
+// signature against what actually arrived on the wire.
+type fakeS3 struct {
+	t       *testing.T
+	store   *S3Store
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	signedAt, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, "missing date", http.StatusForbidden)
+		return
+	}
+
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.RequestURI, nil)
+	f.store.sign(check, signedAt)
+	if got, want := r.Header.Get("Authorization"), check.Header.Get("Authorization"); got != want {
+		f.t.Errorf("authorization = %q, want %q", got, want)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(body)
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{t: t, objects: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "uploads",
+		Region:          "us-east-1",
+		AccessKeyId:     "AKID",
+		SecretAccessKey: "secret",
+	}, server.Client())
+	fake.store = store
+
+	ctx := context.Background()
+	key := "rooms/1/a file (1).txt"
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, ok := fake.objects["/uploads/rooms/1/a file (1).txt"]; !ok {
+		t.Fatalf("object not stored under its key, have %v", fake.objects)
+	}
+
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "hello" {
+		t.Errorf("Get = %q, want %q", data, "hello")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("signingKey = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,15 @@
+package blob
+
+import (
+	"context"
+	"io"
+)
+
+// Store keeps file contents under keys chosen by the caller. Keys are
+// slash separated paths such as "rooms/1/abc"; a missing key is reported
+// as models.ErrNotFound.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
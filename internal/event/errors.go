@@ -7,4 +7,6 @@ var (
 	ErrNotRoomMember    = errors.New("user is not a member of the room")
 	ErrForbidden        = errors.New("forbidden")
 	ErrUnsupportedEvent = errors.New("unsupported event type")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrNotSubscribed    = errors.New("not subscribed to room")
 )
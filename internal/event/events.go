@@ -25,10 +25,16 @@ func mapErrorCode(err error) (code string, message string) {
 		return "invalid_payload", err.Error()
 	case errors.Is(err, ErrNotRoomMember):
 		return "not_room_member", err.Error()
-	case errors.Is(err, ErrForbidden):
-		return "forbidden", err.Error()
+	case errors.Is(err, ErrForbidden), errors.Is(err, models.ErrForbidden):
+		return "forbidden", ErrForbidden.Error()
+	case errors.Is(err, models.ErrNotFound):
+		return "not_found", models.ErrNotFound.Error()
 	case errors.Is(err, ErrUnsupportedEvent):
 		return "unsupported_event", err.Error()
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, models.ErrUnauthorized):
+		return "unauthorized", ErrUnauthorized.Error()
+	case errors.Is(err, ErrNotSubscribed):
+		return "not_subscribed", err.Error()
 	default:
 		return "internal_error", "something went wrong"
 	}
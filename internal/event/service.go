@@ -25,6 +25,8 @@ type EventService struct {
 	roomStore       room.RoomStore
 	messageStore    message.MessageStore
 	roomMemberStore room.RoomMemberStore
+	messageService  *message.MessageService
+	permissions     *room.Permissions
 
 	handlers map[models.IncomingEventType]eventHandler
 }
@@ -34,12 +36,15 @@ func NewEventService(
 	roomStore room.RoomStore,
 	messageStore message.MessageStore,
 	roomMemberStore room.RoomMemberStore,
+	messageService *message.MessageService,
 ) *EventService {
 	srv := &EventService{
 		userStore:       userStore,
 		roomStore:       roomStore,
 		messageStore:    messageStore,
 		roomMemberStore: roomMemberStore,
+		messageService:  messageService,
+		permissions:     room.NewPermissions(roomMemberStore),
 		handlers:        make(map[models.IncomingEventType]eventHandler),
 	}
 
@@ -50,16 +55,23 @@ func NewEventService(
 	srv.handlers[models.EventDeleteMessage] = srv.handleDeleteMessage
 	srv.handlers[models.EventStartTyping] = srv.handleStartTyping
 	srv.handlers[models.EventStopTyping] = srv.handleStopTyping
+	srv.handlers[models.EventAckMessage] = srv.handleAckMessage
+	srv.handlers[models.EventReadMessage] = srv.handleReadMessage
+	srv.handlers[models.EventReactMessage] = srv.handleReactMessage
+	srv.handlers[models.EventUnreactMessage] = srv.handleUnreactMessage
 
 	return srv
 }
 
+// HandleIncoming dispatches a command to its handler, routed on the room
+// named by the event. A nil event means there is nothing to broadcast.
 func (srv *EventService) HandleIncoming(
 	ctx context.Context,
-	roomID models.RoomId,
 	userID models.UserId,
 	data models.IncomingEvent,
 ) (models.ChatEvent, error) {
+	roomID := data.RoomId
+
 	if _, err := srv.roomStore.GetById(ctx, roomID); err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			return nil, ErrForbidden
@@ -82,6 +94,23 @@ func (srv *EventService) HandleIncoming(
 	return handler(ctx, roomID, userID, data)
 }
 
+// AuthorizeRoom checks that the room exists and that the user is a member
+// of it before a socket is allowed to receive the room's events.
+func (srv *EventService) AuthorizeRoom(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+) error {
+	if _, err := srv.roomStore.GetById(ctx, roomID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return ErrForbidden
+		}
+		return fmt.Errorf("ws authorize get room id=%d: %w", roomID, err)
+	}
+
+	return srv.ensureMember(ctx, roomID, userID)
+}
+
 func decodePayload(data models.IncomingEvent, v any) error {
 	if err := json.Unmarshal(data.Data, v); err != nil {
 		return ErrInvalidPayload
@@ -104,6 +133,25 @@ func (srv *EventService) ensureMember(
 	return nil
 }
 
+// require checks that the user's role in the room grants the permission.
+func (srv *EventService) require(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	permission room.Permission,
+) error {
+	_, err := srv.permissions.Require(ctx, roomID, userID, permission)
+	switch {
+	case errors.Is(err, models.ErrUnauthorized):
+		return ErrNotRoomMember
+	case errors.Is(err, models.ErrForbidden):
+		return ErrForbidden
+	case err != nil:
+		return fmt.Errorf("ws check permission: %w", err)
+	}
+	return nil
+}
+
 func (srv *EventService) handleJoinRoom(
 	ctx context.Context,
 	roomID models.RoomId,
@@ -138,40 +186,54 @@ func (srv *EventService) handleSendMessage(
 	userID models.UserId,
 	data models.IncomingEvent,
 ) (models.ChatEvent, error) {
-	if err := srv.ensureMember(ctx, roomID, userID); err != nil {
+	if err := srv.require(ctx, roomID, userID, room.PermissionSendMessage); err != nil {
 		return nil, err
 	}
 
 	var payload struct {
-		Content string `json:"content"`
-		Nonce   string `json:"nonce"`
+		Content       string                `json:"content"`
+		Nonce         string                `json:"nonce"`
+		ParentId      *models.MessageId     `json:"parentId"`
+		AttachmentIds []models.AttachmentId `json:"attachmentIds"`
 	}
 
 	if err := decodePayload(data, &payload); err != nil {
 		return nil, err
 	}
 
-	if strings.TrimSpace(payload.Content) == "" {
+	if strings.TrimSpace(payload.Content) == "" && len(payload.AttachmentIds) == 0 {
 		return nil, ErrInvalidPayload
 	}
 
-	msgID, err := srv.messageStore.Create(ctx, roomID, userID, payload.Content)
-	if err != nil {
-		return nil, fmt.Errorf("ws create message: %w", err)
+	// The message service broadcasts the message and the unread counts
+	if payload.ParentId != nil {
+		_, err := srv.messageService.HandleSendReply(ctx, message.SendReplyPayload{
+			UserId:        userID,
+			RoomId:        roomID,
+			ParentId:      *payload.ParentId,
+			Content:       payload.Content,
+			Nonce:         &payload.Nonce,
+			AttachmentIds: payload.AttachmentIds,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ws send reply: %w", err)
+		}
+
+		return nil, nil
 	}
 
-	msg, err := srv.messageStore.GetResponseById(ctx, msgID)
+	_, err := srv.messageService.HandleSendMessage(ctx, message.SendMessagePayload{
+		UserId:        userID,
+		RoomId:        roomID,
+		Content:       payload.Content,
+		Nonce:         &payload.Nonce,
+		AttachmentIds: payload.AttachmentIds,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ws get response message: %w", err)
+		return nil, fmt.Errorf("ws send message: %w", err)
 	}
 
-	msg.Nonce = &payload.Nonce
-
-	return &models.MessageCreatedEvent{
-		Data: models.MessageCreatedPayload{
-			Message: msg,
-		},
-	}, nil
+	return nil, nil
 }
 
 func (srv *EventService) handleEditMessage(
@@ -197,37 +259,23 @@ func (srv *EventService) handleEditMessage(
 		return nil, ErrInvalidPayload
 	}
 
-	msg, err := srv.messageStore.GetById(ctx, payload.MessageID)
+	// The message service checks the user wrote the message or may moderate
+	// the room, re-resolves mentions and broadcasts the update
+	_, err := srv.messageService.HandleEditMessage(ctx, message.EditMessagePayload{
+		UserId:    userID,
+		MessageId: payload.MessageID,
+		RoomId:    roomID,
+		Content:   payload.Content,
+	})
 	if err != nil {
-		if errors.Is(err, models.ErrNotFound) {
+		if errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrUnauthorized) || errors.Is(err, models.ErrForbidden) {
 			return nil, ErrForbidden
 		}
 
-		return nil, fmt.Errorf("edit ws get message=%d: %w", payload.MessageID, err)
+		return nil, fmt.Errorf("ws edit message=%d: %w", payload.MessageID, err)
 	}
 
-	if msg.UserId != userID {
-		return nil, ErrForbidden
-	}
-
-	if err := srv.messageStore.UpdateContent(ctx, payload.MessageID, payload.Content); err != nil {
-		return nil, fmt.Errorf("edit ws update content: %w", err)
-	}
-
-	updatedMsg, err := srv.messageStore.GetResponseById(ctx, payload.MessageID)
-	if err != nil {
-		if errors.Is(err, models.ErrNotFound) {
-			return nil, ErrForbidden
-		}
-
-		return nil, fmt.Errorf("edit ws get response message: %w", err)
-	}
-
-	return &models.MessageUpdatedEvent{
-		Data: models.MessageUpdatedPayload{
-			Message: updatedMsg,
-		},
-	}, nil
+	return nil, nil
 }
 
 func (srv *EventService) handleDeleteMessage(
@@ -248,33 +296,22 @@ func (srv *EventService) handleDeleteMessage(
 		return nil, err
 	}
 
-	msg, err := srv.messageStore.GetById(ctx, payload.MessageID)
+	// The message service checks the user wrote the message or may moderate
+	// the room, leaves a tombstone and broadcasts the deletion
+	err := srv.messageService.HandleDeleteMessage(ctx, message.DeleteMessagePayload{
+		UserId:    userID,
+		MessageId: payload.MessageID,
+		RoomId:    roomID,
+	})
 	if err != nil {
-		if errors.Is(err, models.ErrNotFound) {
+		if errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrUnauthorized) || errors.Is(err, models.ErrForbidden) {
 			return nil, ErrForbidden
 		}
 
-		return nil, fmt.Errorf("delete ws get message=%d: %w", payload.MessageID, err)
-	}
-
-	if msg.UserId != userID {
-		return nil, ErrForbidden
+		return nil, fmt.Errorf("ws delete message=%d: %w", payload.MessageID, err)
 	}
 
-	if err := srv.messageStore.DeleteById(ctx, payload.MessageID); err != nil {
-		if errors.Is(err, models.ErrNotFound) {
-			return nil, ErrForbidden
-		}
-
-		return nil, fmt.Errorf("delete ws delete message=%d: %w", payload.MessageID, err)
-	}
-
-	return &models.MessageDeletedEvent{
-		Data: models.MessageDeletedPayload{
-			MessageID: payload.MessageID,
-			RoomID:    roomID,
-		},
-	}, nil
+	return nil, nil
 }
 
 func (srv *EventService) handleStartTyping(
@@ -311,3 +348,109 @@ func (srv *EventService) handleStopTyping(
 		},
 	}, nil
 }
+
+func (srv *EventService) handleAckMessage(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	data models.IncomingEvent,
+) (models.ChatEvent, error) {
+	var payload struct {
+		MessageID models.MessageId `json:"messageId"`
+	}
+
+	if err := decodePayload(data, &payload); err != nil {
+		return nil, err
+	}
+
+	// The sender is told directly, nothing goes to the room
+	err := srv.messageService.HandleAckMessage(ctx, message.AckMessagePayload{
+		UserId:    userID,
+		MessageId: payload.MessageID,
+		RoomId:    roomID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ws ack message=%d: %w", payload.MessageID, err)
+	}
+
+	return nil, nil
+}
+
+func (srv *EventService) handleReadMessage(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	data models.IncomingEvent,
+) (models.ChatEvent, error) {
+	var payload struct {
+		MessageID models.MessageId `json:"messageId"`
+	}
+
+	if err := decodePayload(data, &payload); err != nil {
+		return nil, err
+	}
+
+	// The message service broadcasts the receipt when the marker moves
+	err := srv.messageService.HandleMarkAsRead(ctx, message.MarkAsReadPayload{
+		UserId:    userID,
+		MessageId: payload.MessageID,
+		RoomId:    roomID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ws read message=%d: %w", payload.MessageID, err)
+	}
+
+	return nil, nil
+}
+
+func (srv *EventService) handleReactMessage(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	data models.IncomingEvent,
+) (models.ChatEvent, error) {
+	return srv.updateReaction(ctx, roomID, userID, data, srv.messageService.HandleReact)
+}
+
+func (srv *EventService) handleUnreactMessage(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	data models.IncomingEvent,
+) (models.ChatEvent, error) {
+	return srv.updateReaction(ctx, roomID, userID, data, srv.messageService.HandleUnreact)
+}
+
+func (srv *EventService) updateReaction(
+	ctx context.Context,
+	roomID models.RoomId,
+	userID models.UserId,
+	data models.IncomingEvent,
+	update func(context.Context, message.ReactionPayload) error,
+) (models.ChatEvent, error) {
+	var payload struct {
+		MessageID models.MessageId `json:"messageId"`
+		Emoji     string           `json:"emoji"`
+	}
+
+	if err := decodePayload(data, &payload); err != nil {
+		return nil, err
+	}
+
+	if !message.ValidEmoji(payload.Emoji) {
+		return nil, ErrInvalidPayload
+	}
+
+	// The message service broadcasts the new count when it changed
+	err := update(ctx, message.ReactionPayload{
+		UserId:    userID,
+		MessageId: payload.MessageID,
+		RoomId:    roomID,
+		Emoji:     payload.Emoji,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ws reaction on message=%d: %w", payload.MessageID, err)
+	}
+
+	return nil, nil
+}
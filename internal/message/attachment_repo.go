@@ -0,0 +1,92 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type AttachmentStore interface {
+	Create(ctx context.Context, attachment *models.Attachment) (models.AttachmentId, error)
+	GetById(ctx context.Context, id models.AttachmentId) (*models.Attachment, error)
+	GetByIds(ctx context.Context, ids []models.AttachmentId) ([]models.Attachment, error)
+	GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Attachment, error)
+	// DeleteOrphans removes attachments uploaded before the given time that
+	// belong to no message, returning them so their blobs can be removed
+	DeleteOrphans(ctx context.Context, before time.Time) ([]models.Attachment, error)
+	// GetByRoomId lists every attachment uploaded to the room
+	GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Attachment, error)
+}
+
+const attachmentColumns = `id, room_id, uploaded_by, message_id, file_name, content_type, size,
+	storage_key, thumbnail_key, width, height, created_at`
+
+func scanAttachment(row rowScanner) (*models.Attachment, error) {
+	var attachment models.Attachment
+	var messageId, width, height sql.NullInt64
+	var thumbnailKey sql.NullString
+
+	err := row.Scan(
+		&attachment.Id,
+		&attachment.RoomId,
+		&attachment.UploadedBy,
+		&messageId,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&thumbnailKey,
+		&width,
+		&height,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageId.Valid {
+		attachment.MessageId = &messageId.Int64
+	}
+	if thumbnailKey.Valid {
+		attachment.ThumbnailKey = &thumbnailKey.String
+	}
+	if width.Valid && height.Valid {
+		w, h := int(width.Int64), int(height.Int64)
+		attachment.Width = &w
+		attachment.Height = &h
+	}
+
+	return &attachment, nil
+}
+
+func scanAttachments(rows *sql.Rows) ([]models.Attachment, error) {
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning attachment: %w", err)
+		}
+
+		attachments = append(attachments, *attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+func groupAttachments(attachments []models.Attachment) map[models.MessageId][]models.Attachment {
+	grouped := make(map[models.MessageId][]models.Attachment)
+	for _, attachment := range attachments {
+		if attachment.MessageId != nil {
+			grouped[*attachment.MessageId] = append(grouped[*attachment.MessageId], attachment)
+		}
+	}
+
+	return grouped
+}
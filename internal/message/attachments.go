@@ -0,0 +1,87 @@
+package message
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+const (
+	// MaxAttachmentSize is the largest file that can be uploaded, in bytes
+	MaxAttachmentSize = 10 << 20
+	maxAttachments    = 10
+	maxFileNameLength = 255
+)
+
+// attachmentTypes are the content types uploads may have, as sniffed from
+// their first bytes. Those mapped to true get a thumbnail.
+var attachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      false,
+	"application/pdf": false,
+	"application/zip": false,
+	"text/plain":      false,
+	"audio/mpeg":      false,
+	"video/mp4":       false,
+}
+
+// detectAttachmentType sniffs the content type from the first bytes of a
+// file, ignoring whatever the client claimed, and reports whether it may
+// be uploaded.
+func detectAttachmentType(head []byte) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "", false
+	}
+
+	_, ok := attachmentTypes[mediaType]
+	return mediaType, ok
+}
+
+// cleanFileName keeps the base name of an uploaded file, without control
+// characters and short enough to store.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+
+	return name
+}
+
+func responseAttachments(attachments []models.Attachment) []models.ResponseAttachment {
+	res := make([]models.ResponseAttachment, len(attachments))
+	for i, attachment := range attachments {
+		res[i] = models.ResponseAttachment{
+			Id:           attachment.Id,
+			FileName:     attachment.FileName,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+			Width:        attachment.Width,
+			Height:       attachment.Height,
+			HasThumbnail: attachment.ThumbnailKey != nil,
+		}
+	}
+
+	return res
+}
@@ -1,26 +1,43 @@
 package message
 
 import (
+	"io"
+	"time"
+
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
 
+// PageQuery picks a window of history. At most one of Before, After and
+// Around is set; with none the page holds the newest messages. Around
+// centres the page on that message, which is included.
+type PageQuery struct {
+	Limit  int
+	Before *models.MessageId
+	After  *models.MessageId
+	Around *models.MessageId
+}
+
 type GetMessagesPayload struct {
 	UserId models.UserId `json:"userId"`
 	RoomId models.RoomId `json:"roomId"`
-	Limit  int           `json:"limit"`
-	Cursor *string       `json:"cursor"`
+	Page   PageQuery     `json:"page"`
 }
 
+// GetMessagesResponse holds a page of messages, oldest first. PrevCursor is
+// passed as before to load older messages and NextCursor as after to load
+// newer ones; each is nil when there is nothing further that way.
 type GetMessagesResponse struct {
 	Messages   []models.ResponseMessage `json:"messages"`
+	PrevCursor *string                  `json:"prevCursor"`
 	NextCursor *string                  `json:"nextCursor"`
 }
 
 type SendMessagePayload struct {
-	UserId  models.UserId
-	RoomId  models.RoomId
-	Content string
-	Nonce   *string
+	UserId        models.UserId
+	RoomId        models.RoomId
+	Content       string
+	Nonce         *string
+	AttachmentIds []models.AttachmentId
 }
 
 type EditMessagePayload struct {
@@ -35,3 +52,172 @@ type DeleteMessagePayload struct {
 	MessageId models.MessageId
 	RoomId    models.RoomId
 }
+
+type AckMessagePayload struct {
+	UserId    models.UserId
+	MessageId models.MessageId
+	RoomId    models.RoomId
+}
+
+type MarkAsReadPayload struct {
+	UserId    models.UserId
+	MessageId models.MessageId
+	RoomId    models.RoomId
+}
+
+type SendReplyPayload struct {
+	UserId        models.UserId
+	RoomId        models.RoomId
+	ParentId      models.MessageId
+	Content       string
+	Nonce         *string
+	AttachmentIds []models.AttachmentId
+}
+
+type GetRepliesPayload struct {
+	UserId    models.UserId    `json:"userId"`
+	RoomId    models.RoomId    `json:"roomId"`
+	MessageId models.MessageId `json:"messageId"`
+	Page      PageQuery        `json:"page"`
+}
+
+type ReactionPayload struct {
+	UserId    models.UserId
+	MessageId models.MessageId
+	RoomId    models.RoomId
+	Emoji     string
+}
+
+type GetHistoryPayload struct {
+	UserId    models.UserId
+	MessageId models.MessageId
+	RoomId    models.RoomId
+}
+
+type GetHistoryResponse struct {
+	MessageId models.MessageId         `json:"messageId"`
+	Revisions []models.MessageRevision `json:"revisions"`
+}
+
+// NewMessage is a message to store together with its mentions and the
+// already claimed attachments it links; a reply sets ParentId to its thread.
+type NewMessage struct {
+	RoomId        models.RoomId
+	UserId        models.UserId
+	ParentId      *models.MessageId
+	Content       string
+	Mentions      []models.Mention
+	AttachmentIds []models.AttachmentId
+}
+
+// SearchMessagesPayload searches the rooms UserId is a member of, narrowed
+// by the optional filters. From and To bound the sent time, inclusive.
+type SearchMessagesPayload struct {
+	UserId   models.UserId
+	Query    string
+	RoomId   *models.RoomId
+	SenderId *models.UserId
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Cursor   *models.MessageId
+}
+
+// SearchResult is one matching message. Snippet is an HTML-escaped excerpt
+// of its content with the matched terms wrapped in <mark></mark>.
+type SearchResult struct {
+	MessageId  models.MessageId  `json:"messageId"`
+	RoomId     models.RoomId     `json:"roomId"`
+	RoomName   string            `json:"roomName"`
+	ParentId   *models.MessageId `json:"parentId"`
+	SenderId   models.UserId     `json:"senderId"`
+	SenderName string            `json:"senderName"`
+	Snippet    string            `json:"snippet"`
+	SentAt     time.Time         `json:"sentAt"`
+}
+
+type SearchMessagesResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor *string        `json:"nextCursor"`
+}
+
+// UploadAttachmentPayload carries one uploaded file, whose Body holds Size
+// bytes.
+type UploadAttachmentPayload struct {
+	UserId   models.UserId
+	RoomId   models.RoomId
+	FileName string
+	Size     int64
+	Body     io.Reader
+}
+
+type GetAttachmentPayload struct {
+	UserId       models.UserId
+	AttachmentId models.AttachmentId
+	Thumbnail    bool
+}
+
+// AttachmentContent is a file being downloaded. Size is 0 when unknown, and
+// the caller closes Body.
+type AttachmentContent struct {
+	Attachment  *models.Attachment
+	ContentType string
+	Size        int64
+	Body        io.ReadCloser
+}
+
+type PinPayload struct {
+	UserId    models.UserId
+	RoomId    models.RoomId
+	MessageId models.MessageId
+}
+
+type GetPinsPayload struct {
+	UserId models.UserId
+	RoomId models.RoomId
+}
+
+type PinnedMessage struct {
+	Message  models.ResponseMessage `json:"message"`
+	PinnedBy *models.UserId         `json:"pinnedBy"`
+	PinnedAt time.Time              `json:"pinnedAt"`
+}
+
+// GetPinsResponse lists a room's pinned messages, most recently pinned
+// first.
+type GetPinsResponse struct {
+	Pins []PinnedMessage `json:"pins"`
+}
+
+type ScheduleMessagePayload struct {
+	UserId  models.UserId
+	RoomId  models.RoomId
+	Content string
+	SendAt  time.Time
+}
+
+type GetScheduledPayload struct {
+	UserId models.UserId
+	RoomId models.RoomId
+}
+
+// EditScheduledPayload changes whichever of Content and SendAt is set.
+type EditScheduledPayload struct {
+	UserId      models.UserId
+	RoomId      models.RoomId
+	ScheduledId models.ScheduledMessageId
+	Content     *string
+	SendAt      *time.Time
+}
+
+type CancelScheduledPayload struct {
+	UserId      models.UserId
+	RoomId      models.RoomId
+	ScheduledId models.ScheduledMessageId
+}
+
+// GetScheduledResponse lists the caller's scheduled messages in a room,
+// soonest first.
+type GetScheduledResponse struct {
+	Messages []models.ScheduledMessage `json:"messages"`
+}
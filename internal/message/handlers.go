@@ -2,16 +2,71 @@ package message
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/auth"
+	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 	"github.com/ayushgpt01/chatRoomGo/utils"
 )
 
+// parsePageQuery reads limit and one of the before, after or around message
+// ids from the query string. The older cursor parameter pages forward and is
+// read as after.
+func parsePageQuery(r *http.Request) (PageQuery, error) {
+	query := r.URL.Query()
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	if limit > 100 {
+		return PageQuery{}, errors.New("Limit should be under 100")
+	}
+
+	page := PageQuery{Limit: limit}
+
+	anchors := []struct {
+		name string
+		dest **models.MessageId
+	}{
+		{"before", &page.Before},
+		{"after", &page.After},
+		{"cursor", &page.After},
+		{"around", &page.Around},
+	}
+
+	set := 0
+	for _, anchor := range anchors {
+		value := query.Get(anchor.name)
+		if value == "" {
+			continue
+		}
+
+		id, err := models.ParseMessageId(value)
+		if err != nil {
+			return PageQuery{}, fmt.Errorf("Invalid %s message id", anchor.name)
+		}
+
+		*anchor.dest = &id
+		set++
+	}
+
+	if set > 1 {
+		return PageQuery{}, errors.New("Use only one of before, after and around")
+	}
+
+	return page, nil
+}
+
 func HandleGetMessages(srv *MessageService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
@@ -20,24 +75,12 @@ func HandleGetMessages(srv *MessageService) http.Handler {
 			return
 		}
 
-		query := r.URL.Query()
-
-		limitStr := query.Get("limit")
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit <= 0 {
-			limit = 10
-		}
-
-		if limit > 100 {
-			http.Error(w, "Limit should be under 100", http.StatusBadRequest)
+		page, err := parsePageQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var cursor *string
-		if c := query.Get("cursor"); c != "" {
-			cursor = &c
-		}
-
 		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
 		if !ok {
 			http.Error(w, "Server error", http.StatusInternalServerError)
@@ -47,8 +90,7 @@ func HandleGetMessages(srv *MessageService) http.Handler {
 		res, err := srv.HandleGetMessages(r.Context(), GetMessagesPayload{
 			UserId: currentUserId,
 			RoomId: roomId,
-			Limit:  limit,
-			Cursor: cursor,
+			Page:   page,
 		})
 
 		if err != nil {
@@ -64,13 +106,14 @@ func HandleGetMessages(srv *MessageService) http.Handler {
 }
 
 type request struct {
-	Content string  `json:"content"`
-	Nonce   *string `json:"nonce,omitempty"`
+	Content       string                `json:"content"`
+	Nonce         *string               `json:"nonce,omitempty"`
+	AttachmentIds []models.AttachmentId `json:"attachmentIds,omitempty"`
 }
 
 func (s request) Valid(ctx context.Context) map[string]string {
 	problems := map[string]string{}
-	if strings.TrimSpace(s.Content) == "" {
+	if strings.TrimSpace(s.Content) == "" && len(s.AttachmentIds) == 0 {
 		problems["content"] = "Content cannot be empty"
 	}
 	if len(s.Content) > 2000 {
@@ -100,10 +143,11 @@ func HandleSendMessage(srv *MessageService) http.Handler {
 		}
 
 		res, err := srv.HandleSendMessage(r.Context(), SendMessagePayload{
-			UserId:  currentUserId,
-			RoomId:  roomId,
-			Content: body.Content,
-			Nonce:   body.Nonce,
+			UserId:        currentUserId,
+			RoomId:        roomId,
+			Content:       body.Content,
+			Nonce:         body.Nonce,
+			AttachmentIds: body.AttachmentIds,
 		})
 
 		if err != nil {
@@ -117,6 +161,133 @@ func HandleSendMessage(srv *MessageService) http.Handler {
 	})
 }
 
+func HandleSendReply(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		messageId, err := models.ParseMessageId(r.PathValue("messageId"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[request](w, r)
+		if !ok {
+			return
+		}
+
+		res, err := srv.HandleSendReply(r.Context(), SendReplyPayload{
+			UserId:        currentUserId,
+			RoomId:        roomId,
+			ParentId:      messageId,
+			Content:       body.Content,
+			Nonce:         body.Nonce,
+			AttachmentIds: body.AttachmentIds,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /room/{roomId}/messages/{messageId}/replies", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusCreated, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleGetReplies(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		messageId, err := models.ParseMessageId(r.PathValue("messageId"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetReplies(r.Context(), GetRepliesPayload{
+			UserId:    currentUserId,
+			RoomId:    roomId,
+			MessageId: messageId,
+			Page:      page,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, fmt.Sprintf("GET /room/%d/messages/%d/replies", roomId, messageId), err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleGetHistory(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		messageId, err := models.ParseMessageId(r.PathValue("messageId"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetHistory(r.Context(), GetHistoryPayload{
+			UserId:    currentUserId,
+			MessageId: messageId,
+			RoomId:    roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, fmt.Sprintf("GET /room/%d/messages/%d/history", roomId, messageId), err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
 func HandleEditMessage(srv *MessageService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
@@ -194,3 +365,577 @@ func HandleDeleteMessage(srv *MessageService) http.Handler {
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+type readRequest struct {
+	MessageId models.MessageId `json:"messageId"`
+}
+
+func (s readRequest) Valid(ctx context.Context) map[string]string {
+	problems := map[string]string{}
+	if s.MessageId <= 0 {
+		problems["messageId"] = "Message Id is required"
+	}
+	return problems
+}
+
+func HandleMarkAsRead(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[readRequest](w, r)
+		if !ok {
+			return
+		}
+
+		err = srv.HandleMarkAsRead(r.Context(), MarkAsReadPayload{
+			UserId:    currentUserId,
+			MessageId: body.MessageId,
+			RoomId:    roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /room/{roomId}/read", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func HandleReact(srv *MessageService) http.Handler {
+	return handleReaction(srv.HandleReact, "PUT /room/{roomId}/messages/{messageId}/reactions/{emoji}")
+}
+
+func HandleUnreact(srv *MessageService) http.Handler {
+	return handleReaction(srv.HandleUnreact, "DELETE /room/{roomId}/messages/{messageId}/reactions/{emoji}")
+}
+
+// handleReaction serves both reaction routes, which differ only in whether
+// the emoji is added or removed.
+func handleReaction(update func(context.Context, ReactionPayload) error, route string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		messageId, err := models.ParseMessageId(r.PathValue("messageId"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		emoji := r.PathValue("emoji")
+		if !ValidEmoji(emoji) {
+			http.Error(w, "Invalid emoji", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = update(r.Context(), ReactionPayload{
+			UserId:    currentUserId,
+			MessageId: messageId,
+			RoomId:    roomId,
+			Emoji:     emoji,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, route, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleSearchMessages serves GET /search/messages?q=, optionally narrowed
+// with roomId, senderId and an RFC 3339 from/to range.
+func HandleSearchMessages(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		q := strings.TrimSpace(query.Get("q"))
+		if q == "" {
+			http.Error(w, "Search query is required", http.StatusBadRequest)
+			return
+		}
+
+		if len(q) > 200 {
+			http.Error(w, "Search query too long", http.StatusBadRequest)
+			return
+		}
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+
+		if limit > 100 {
+			http.Error(w, "Limit should be under 100", http.StatusBadRequest)
+			return
+		}
+
+		payload := SearchMessagesPayload{Query: q, Limit: limit}
+
+		if v := query.Get("cursor"); v != "" {
+			cursor, err := models.ParseMessageId(v)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			payload.Cursor = &cursor
+		}
+
+		if v := query.Get("roomId"); v != "" {
+			roomId, err := models.ParseRoomId(v)
+			if err != nil {
+				http.Error(w, "Invalid room id", http.StatusBadRequest)
+				return
+			}
+			payload.RoomId = &roomId
+		}
+
+		if v := query.Get("senderId"); v != "" {
+			senderId, err := models.ParseUserId(v)
+			if err != nil {
+				http.Error(w, "Invalid sender id", http.StatusBadRequest)
+				return
+			}
+			payload.SenderId = &senderId
+		}
+
+		if v := query.Get("from"); v != "" {
+			from, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid from date", http.StatusBadRequest)
+				return
+			}
+			payload.From = &from
+		}
+
+		if v := query.Get("to"); v != "" {
+			to, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid to date", http.StatusBadRequest)
+				return
+			}
+			payload.To = &to
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		payload.UserId = currentUserId
+
+		res, err := srv.HandleSearchMessages(r.Context(), payload)
+		if err != nil {
+			utils.HandleServiceError(w, "GET /search/messages", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleUploadAttachment(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Leave room for the multipart headers around the file
+		r.Body = http.MaxBytesReader(w, r.Body, MaxAttachmentSize+64<<10)
+
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "File is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		if header.Size > MaxAttachmentSize {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		res, err := srv.HandleUploadAttachment(r.Context(), UploadAttachmentPayload{
+			UserId:   currentUserId,
+			RoomId:   roomId,
+			FileName: header.Filename,
+			Size:     header.Size,
+			Body:     file,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /room/{roomId}/attachments", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusCreated, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+// HandleDownloadAttachment serves an attachment's file, or its thumbnail.
+// Only images are shown inline; everything else downloads.
+func HandleDownloadAttachment(srv *MessageService, thumbnail bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attachmentId, err := models.ParseAttachmentId(r.PathValue("attachmentId"))
+		if err != nil {
+			http.Error(w, "Invalid attachment id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		content, err := srv.HandleGetAttachment(r.Context(), GetAttachmentPayload{
+			UserId:       currentUserId,
+			AttachmentId: attachmentId,
+			Thumbnail:    thumbnail,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "GET /attachments/{attachmentId}", err)
+			return
+		}
+		defer content.Body.Close()
+
+		disposition := "attachment"
+		if strings.HasPrefix(content.ContentType, "image/") {
+			disposition = "inline"
+		}
+
+		w.Header().Set("Content-Type", content.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+			"filename": content.Attachment.FileName,
+		}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		if content.Size > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(content.Size, 10))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, content.Body); err != nil {
+			logger.Warn("attachment_download_interrupted", "attachment_id", attachmentId, "error", err)
+		}
+	})
+}
+
+// handlePin serves both pinning and unpinning a message
+func handlePin(srv *MessageService, pin bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		messageId, err := models.ParseMessageId(r.PathValue("messageId"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		payload := PinPayload{
+			UserId:    currentUserId,
+			RoomId:    roomId,
+			MessageId: messageId,
+		}
+
+		if !pin {
+			if err := srv.HandleUnpin(r.Context(), payload); err != nil {
+				utils.HandleServiceError(w, "DELETE /room/{roomId}/messages/{messageId}/pin", err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res, err := srv.HandlePin(r.Context(), payload)
+		if err != nil {
+			utils.HandleServiceError(w, "PUT /room/{roomId}/messages/{messageId}/pin", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandlePin(srv *MessageService) http.Handler {
+	return handlePin(srv, true)
+}
+
+func HandleUnpin(srv *MessageService) http.Handler {
+	return handlePin(srv, false)
+}
+
+func HandleGetPins(srv *MessageService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetPins(r.Context(), GetPinsPayload{
+			UserId: currentUserId,
+			RoomId: roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "GET /room/{roomId}/pins", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+type scheduleRequest struct {
+	Content string    `json:"content"`
+	SendAt  time.Time `json:"sendAt"`
+}
+
+func (s scheduleRequest) Valid(ctx context.Context) map[string]string {
+	problems := map[string]string{}
+	if strings.TrimSpace(s.Content) == "" {
+		problems["content"] = "Content cannot be empty"
+	}
+	if len(s.Content) > 2000 {
+		problems["content"] = "Content too long"
+	}
+	if !s.SendAt.After(time.Now()) {
+		problems["sendAt"] = "Send time must be in the future"
+	}
+	return problems
+}
+
+func HandleScheduleMessage(srv *ScheduleService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[scheduleRequest](w, r)
+		if !ok {
+			return
+		}
+
+		res, err := srv.HandleSchedule(r.Context(), ScheduleMessagePayload{
+			UserId:  currentUserId,
+			RoomId:  roomId,
+			Content: body.Content,
+			SendAt:  body.SendAt,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /room/{roomId}/scheduled", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusCreated, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleGetScheduled(srv *ScheduleService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetScheduled(r.Context(), GetScheduledPayload{
+			UserId: currentUserId,
+			RoomId: roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "GET /room/{roomId}/scheduled", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+type editScheduledRequest struct {
+	Content *string    `json:"content,omitempty"`
+	SendAt  *time.Time `json:"sendAt,omitempty"`
+}
+
+func (s editScheduledRequest) Valid(ctx context.Context) map[string]string {
+	problems := map[string]string{}
+	if s.Content == nil && s.SendAt == nil {
+		problems["content"] = "Nothing to change"
+	}
+	if s.Content != nil && strings.TrimSpace(*s.Content) == "" {
+		problems["content"] = "Content cannot be empty"
+	}
+	if s.Content != nil && len(*s.Content) > 2000 {
+		problems["content"] = "Content too long"
+	}
+	if s.SendAt != nil && !s.SendAt.After(time.Now()) {
+		problems["sendAt"] = "Send time must be in the future"
+	}
+	return problems
+}
+
+func HandleEditScheduled(srv *ScheduleService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		scheduledId, err := models.ParseScheduledMessageId(r.PathValue("scheduledId"))
+		if err != nil {
+			http.Error(w, "Invalid scheduled message id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[editScheduledRequest](w, r)
+		if !ok {
+			return
+		}
+
+		res, err := srv.HandleEditScheduled(r.Context(), EditScheduledPayload{
+			UserId:      currentUserId,
+			RoomId:      roomId,
+			ScheduledId: scheduledId,
+			Content:     body.Content,
+			SendAt:      body.SendAt,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "PATCH /room/{roomId}/scheduled/{scheduledId}", err)
+			return
+		}
+
+		if err := utils.Encode(w, r, http.StatusOK, res); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleCancelScheduled(srv *ScheduleService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		scheduledId, err := models.ParseScheduledMessageId(r.PathValue("scheduledId"))
+		if err != nil {
+			http.Error(w, "Invalid scheduled message id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = srv.HandleCancelScheduled(r.Context(), CancelScheduledPayload{
+			UserId:      currentUserId,
+			RoomId:      roomId,
+			ScheduledId: scheduledId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "DELETE /room/{roomId}/scheduled/{scheduledId}", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,37 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type MentionStore interface {
+	GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Mention, error)
+}
+
+// scanMentions collects (message_id, kind, user_id, start, end) rows.
+func scanMentions(rows *sql.Rows, mentions map[models.MessageId][]models.Mention) (map[models.MessageId][]models.Mention, error) {
+	for rows.Next() {
+		var messageId models.MessageId
+		var mention models.Mention
+		var userId sql.NullInt64
+		if err := rows.Scan(&messageId, &mention.Kind, &userId, &mention.Start, &mention.End); err != nil {
+			return nil, fmt.Errorf("scanning mention: %w", err)
+		}
+
+		if userId.Valid {
+			mention.UserId = &userId.Int64
+		}
+
+		mentions[messageId] = append(mentions[messageId], mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating mentions: %w", err)
+	}
+
+	return mentions, nil
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// maxMentions caps the @tokens in one message so a single send cannot page
+// an arbitrary number of people.
+const maxMentions = 50
+
+// mentionToken is an @name found in message content. Start and End are
+// offsets in UTF-16 code units, the way the web client indexes strings, and
+// cover the leading @.
+type mentionToken struct {
+	name  string
+	start int
+	end   int
+}
+
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
+
+// parseMentions finds the @name tokens in content. An @ directly after a
+// letter or digit, as in an email address, does not start a mention.
+func parseMentions(content string) []mentionToken {
+	var tokens []mentionToken
+
+	runes := []rune(content)
+	offset := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if r != '@' || (i > 0 && (unicode.IsLetter(runes[i-1]) || unicode.IsDigit(runes[i-1]) || runes[i-1] == '_')) {
+			offset += utf16.RuneLen(r)
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isMentionRune(runes[j]) {
+			j++
+		}
+
+		// A sentence ending right after the name is not part of it
+		for j > i+1 && runes[j-1] == '.' {
+			j--
+		}
+
+		start := offset
+		for _, r := range runes[i:j] {
+			offset += utf16.RuneLen(r)
+		}
+
+		if j > i+1 {
+			tokens = append(tokens, mentionToken{
+				name:  string(runes[i+1 : j]),
+				start: start,
+				end:   offset,
+			})
+		}
+
+		i = j
+	}
+
+	return tokens
+}
+
+// resolveMentions keeps the tokens that name a room member, or @room and
+// @here, matching usernames case-insensitively. Anything else stays plain
+// text.
+func resolveMentions(tokens []mentionToken, members []*models.User) []models.Mention {
+	mentions := []models.Mention{}
+
+	for _, token := range tokens {
+		switch strings.ToLower(token.name) {
+		case string(models.MentionRoom):
+			mentions = append(mentions, models.Mention{Kind: models.MentionRoom, Start: token.start, End: token.end})
+			continue
+		case string(models.MentionHere):
+			mentions = append(mentions, models.Mention{Kind: models.MentionHere, Start: token.start, End: token.end})
+			continue
+		}
+
+		for _, member := range members {
+			if strings.EqualFold(member.Username, token.name) {
+				userId := member.Id
+				mentions = append(mentions, models.Mention{
+					Kind:   models.MentionUser,
+					UserId: &userId,
+					Start:  token.start,
+					End:    token.end,
+				})
+				break
+			}
+		}
+	}
+
+	return mentions
+}
+
+// mentionRecipients lists who a message's mentions should notify, once
+// each and never the sender. isOnline decides who @here reaches.
+func mentionRecipients(mentions []models.Mention, members []*models.User, senderId models.UserId, isOnline func(models.UserId) bool) []models.UserId {
+	seen := map[models.UserId]bool{senderId: true}
+	recipients := []models.UserId{}
+
+	add := func(userId models.UserId) {
+		if !seen[userId] {
+			seen[userId] = true
+			recipients = append(recipients, userId)
+		}
+	}
+
+	for _, mention := range mentions {
+		switch mention.Kind {
+		case models.MentionUser:
+			add(*mention.UserId)
+		case models.MentionRoom, models.MentionHere:
+			for _, member := range members {
+				if mention.Kind == models.MentionHere && !isOnline(member.Id) {
+					continue
+				}
+				add(member.Id)
+			}
+		}
+	}
+
+	return recipients
+}
@@ -0,0 +1,76 @@
+package message
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []mentionToken
+	}{
+		{"hello world", nil},
+		{"@alice hi", []mentionToken{{"alice", 0, 6}}},
+		{"thanks @bob.", []mentionToken{{"bob", 7, 11}}},
+		{"mail me at me@example.com", nil},
+		{"@ alone", nil},
+		{"ping @room and @a.b-c_d", []mentionToken{{"room", 5, 10}, {"a.b-c_d", 15, 23}}},
+		// The emoji is two UTF-16 code units
+		{"😀 @zoë", []mentionToken{{"zoë", 3, 7}}},
+	}
+
+	for _, tt := range tests {
+		got := parseMentions(tt.content)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestResolveMentions(t *testing.T) {
+	members := []*models.User{
+		{Id: 1, Username: "alice"},
+		{Id: 2, Username: "Bob"},
+	}
+
+	mentions := resolveMentions(parseMentions("@bob @carol @HERE @alice"), members)
+
+	if len(mentions) != 3 {
+		t.Fatalf("expected 3 mentions, got %d: %+v", len(mentions), mentions)
+	}
+
+	if mentions[0].Kind != models.MentionUser || *mentions[0].UserId != 2 {
+		t.Errorf("expected @bob to resolve to user 2, got %+v", mentions[0])
+	}
+
+	if mentions[1].Kind != models.MentionHere {
+		t.Errorf("expected @HERE to resolve to here, got %+v", mentions[1])
+	}
+
+	if mentions[2].Kind != models.MentionUser || *mentions[2].UserId != 1 {
+		t.Errorf("expected @alice to resolve to user 1, got %+v", mentions[2])
+	}
+}
+
+func TestMentionRecipients(t *testing.T) {
+	members := []*models.User{{Id: 1}, {Id: 2}, {Id: 3}}
+	bob := models.UserId(2)
+	online := func(userId models.UserId) bool { return userId != 3 }
+
+	got := mentionRecipients([]models.Mention{
+		{Kind: models.MentionUser, UserId: &bob},
+		{Kind: models.MentionHere},
+	}, members, 1, online)
+
+	if !slices.Equal(got, []models.UserId{2}) {
+		t.Errorf("expected only user 2 to be notified, got %v", got)
+	}
+
+	got = mentionRecipients([]models.Mention{{Kind: models.MentionRoom}}, members, 1, online)
+	if !slices.Equal(got, []models.UserId{2, 3}) {
+		t.Errorf("expected @room to reach users 2 and 3, got %v", got)
+	}
+}
@@ -2,16 +2,255 @@ package message
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
 
 type MessageStore interface {
 	GetById(ctx context.Context, id models.MessageId) (*models.Message, error)
-	Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string) (models.MessageId, error)
-	DeleteById(ctx context.Context, id models.MessageId) error
-	UpdateContent(ctx context.Context, id models.MessageId, content string) error
+	// Create stores the message, its mentions and its attachment links in one
+	// transaction. It fails with ErrConflict, storing nothing, when another
+	// message linked one of the attachments first.
+	Create(ctx context.Context, msg NewMessage) (models.MessageId, error)
+	// DeleteById turns the message into a tombstone: its content is cleared
+	// and who deleted it and when are recorded.
+	DeleteById(ctx context.Context, id models.MessageId, deletedBy models.UserId) error
+	// PurgeDeleted hard-deletes tombstones older than before, except those
+	// still holding live replies.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// UpdateContent replaces the message's content and mentions, keeping the
+	// old content as a revision. Unchanged content leaves the message as is.
+	UpdateContent(ctx context.Context, id models.MessageId, editedBy models.UserId, content string, mentions []models.Mention) error
+	GetRevisionsById(ctx context.Context, id models.MessageId) ([]models.MessageRevision, error)
 	GetResponseById(ctx context.Context, id models.MessageId) (*models.ResponseMessage, error)
-	GetMessagesById(ctx context.Context, roomId models.RoomId, limit int, cursor *string) (*GetMessagesResponse, error)
+	GetMessagesById(ctx context.Context, roomId models.RoomId, page PageQuery) (*GetMessagesResponse, error)
+	GetRepliesById(ctx context.Context, parentId models.MessageId, page PageQuery) (*GetMessagesResponse, error)
 	MarkAsDelivered(ctx context.Context, messageId models.MessageId) error
+	MarkDeliveredTo(ctx context.Context, messageId models.MessageId, userId models.UserId) (bool, error)
+	CountUndelivered(ctx context.Context, messageId models.MessageId) (int, error)
+	// ReserveNonce claims the user's nonce for a message about to be sent.
+	// When the nonce was already claimed since the given time it reports
+	// false with the message sent under it, nil while that send is still
+	// in flight. Claims left in flight since staleBefore are taken over.
+	ReserveNonce(ctx context.Context, userId models.UserId, nonce string, since time.Time, staleBefore time.Time) (bool, *models.MessageId, error)
+	CompleteNonce(ctx context.Context, userId models.UserId, nonce string, messageId models.MessageId) error
+	// ReleaseNonce frees a reserved nonce whose send failed
+	ReleaseNonce(ctx context.Context, userId models.UserId, nonce string) error
+	PurgeNonces(ctx context.Context, before time.Time) (int64, error)
+	// SearchMessages finds messages matching the query in the caller's rooms,
+	// newest first.
+	SearchMessages(ctx context.Context, payload SearchMessagesPayload) (*SearchMessagesResponse, error)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanResponseMessage reads a row selected with the response message
+// columns, followed by any backend specific extra columns.
+func scanResponseMessage(row rowScanner, extra ...any) (*models.ResponseMessage, error) {
+	var msg models.ResponseMessage
+	var editedAt sql.NullTime
+	var parentId, deletedBy sql.NullInt64
+	var deletedAt sql.NullTime
+	var replyId, replySenderId sql.NullInt64
+	var replyContent, replySenderName sql.NullString
+	var replySentAt sql.NullTime
+
+	dest := []any{
+		&msg.Id,
+		&msg.Content,
+		&editedAt,
+		&msg.SenderId,
+		&msg.SenderName,
+		&msg.SentAt,
+		&msg.RoomId,
+		&msg.Delivered,
+		&parentId,
+		&deletedAt,
+		&deletedBy,
+		&msg.RevisionCount,
+		&msg.ReplyCount,
+		&replyId,
+		&replyContent,
+		&replySenderId,
+		&replySenderName,
+		&replySentAt,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+
+	if parentId.Valid {
+		msg.ParentId = &parentId.Int64
+	}
+
+	if deletedAt.Valid {
+		msg.DeletedAt = &deletedAt.Time
+	}
+
+	if deletedBy.Valid {
+		msg.DeletedBy = &deletedBy.Int64
+	}
+
+	if replyId.Valid {
+		msg.LatestReply = &models.MessagePreview{
+			Id:         replyId.Int64,
+			Content:    replyContent.String,
+			SenderId:   replySenderId.Int64,
+			SenderName: replySenderName.String,
+			SentAt:     replySentAt.Time,
+		}
+	}
+
+	msg.Reactions = []models.ReactionSummary{}
+	msg.Mentions = []models.Mention{}
+	msg.Attachments = []models.ResponseAttachment{}
+
+	return &msg, nil
+}
+
+// The stores wrap matched terms in these private use characters rather than
+// in markup, so the snippet can be escaped before the marks are put in.
+const (
+	snippetStartSel = "\uE000"
+	snippetStopSel  = "\uE001"
+)
+
+var snippetMarks = strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>")
+
+// highlightSnippet escapes a snippet for HTML and marks its matched terms.
+func highlightSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+// scanSearchResults reads rows of (id, room_id, room name, parent_id, sender
+// id, sender name, snippet, created_at), paging on the id of the extra row.
+func scanSearchResults(rows *sql.Rows, limit int) (*SearchMessagesResponse, error) {
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		var parentId sql.NullInt64
+
+		err := rows.Scan(
+			&result.MessageId,
+			&result.RoomId,
+			&result.RoomName,
+			&parentId,
+			&result.SenderId,
+			&result.SenderName,
+			&result.Snippet,
+			&result.SentAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning search result: %w", err)
+		}
+
+		if parentId.Valid {
+			result.ParentId = &parentId.Int64
+		}
+
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating search results: %w", err)
+	}
+
+	var nextCursor *string
+	if len(results) > limit {
+		c := fmt.Sprintf("%d", results[limit-1].MessageId)
+		nextCursor = &c
+		results = results[:limit]
+	}
+
+	return &SearchMessagesResponse{Results: results, NextCursor: nextCursor}, nil
+}
+
+// pageFetcher loads up to limit messages whose id compares to anchor with op
+// ("<", ">", ">=", or "" for no bound), newest first when asked.
+type pageFetcher func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error)
+
+// pageMessages builds the page a PageQuery asks for out of one or two
+// fetches, each reading one extra row to tell whether more lie beyond it.
+func pageMessages(page PageQuery, fetch pageFetcher) (*GetMessagesResponse, error) {
+	var messages []models.ResponseMessage
+	var hasOlder, hasNewer bool
+
+	switch {
+	case page.Around != nil:
+		// Read a full page each way so a window near either end of the
+		// history still fills up from the other side
+		older, err := fetch("<", *page.Around, true, page.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+		newer, err := fetch(">=", *page.Around, false, page.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+
+		olderCount := min(len(older), max(page.Limit/2, page.Limit-len(newer)))
+		newerCount := min(len(newer), page.Limit-olderCount)
+
+		hasOlder = len(older) > olderCount
+		hasNewer = len(newer) > newerCount
+		older = older[:olderCount]
+		slices.Reverse(older)
+		messages = append(older, newer[:newerCount]...)
+
+	case page.After != nil:
+		newer, err := fetch(">", *page.After, false, page.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+
+		hasOlder = true
+		hasNewer = len(newer) > page.Limit
+		messages = newer[:min(len(newer), page.Limit)]
+
+	default:
+		op, anchor := "", models.MessageId(0)
+		if page.Before != nil {
+			op, anchor = "<", *page.Before
+			hasNewer = true
+		}
+
+		older, err := fetch(op, anchor, true, page.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+
+		hasOlder = len(older) > page.Limit
+		messages = older[:min(len(older), page.Limit)]
+		slices.Reverse(messages)
+	}
+
+	res := &GetMessagesResponse{Messages: messages}
+	if len(messages) == 0 {
+		return res, nil
+	}
+
+	if hasOlder {
+		c := fmt.Sprintf("%d", messages[0].Id)
+		res.PrevCursor = &c
+	}
+	if hasNewer {
+		c := fmt.Sprintf("%d", messages[len(messages)-1].Id)
+		res.NextCursor = &c
+	}
+
+	return res, nil
 }
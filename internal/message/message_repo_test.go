@@ -0,0 +1,96 @@
+package message
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// fakeHistory serves pageMessages from ids 1..n the way the stores do.
+func fakeHistory(n int) pageFetcher {
+	return func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+		var messages []models.ResponseMessage
+		for id := models.MessageId(1); id <= models.MessageId(n); id++ {
+			if (op == "<" && id >= anchor) || (op == ">" && id <= anchor) || (op == ">=" && id < anchor) {
+				continue
+			}
+			messages = append(messages, models.ResponseMessage{Id: id})
+		}
+
+		if newestFirst {
+			slices.Reverse(messages)
+		}
+
+		return messages[:min(len(messages), limit)], nil
+	}
+}
+
+func TestPageMessages(t *testing.T) {
+	id := func(i models.MessageId) *models.MessageId { return &i }
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name       string
+		page       PageQuery
+		want       []models.MessageId
+		prev, next *string
+	}{
+		{"latest", PageQuery{Limit: 3}, []models.MessageId{8, 9, 10}, str("8"), nil},
+		{"before", PageQuery{Limit: 3, Before: id(8)}, []models.MessageId{5, 6, 7}, str("5"), str("7")},
+		{"before start", PageQuery{Limit: 3, Before: id(3)}, []models.MessageId{1, 2}, nil, str("2")},
+		{"after", PageQuery{Limit: 3, After: id(4)}, []models.MessageId{5, 6, 7}, str("5"), str("7")},
+		{"after end", PageQuery{Limit: 3, After: id(8)}, []models.MessageId{9, 10}, str("9"), nil},
+		{"around", PageQuery{Limit: 4, Around: id(5)}, []models.MessageId{3, 4, 5, 6}, str("3"), str("6")},
+		{"around start", PageQuery{Limit: 4, Around: id(1)}, []models.MessageId{1, 2, 3, 4}, nil, str("4")},
+		{"around end", PageQuery{Limit: 4, Around: id(10)}, []models.MessageId{7, 8, 9, 10}, str("7"), nil},
+		{"empty", PageQuery{Limit: 3, After: id(10)}, nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := pageMessages(tt.page, fakeHistory(10))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []models.MessageId
+			for _, m := range res.Messages {
+				got = append(got, m.Id)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("messages = %v, want %v", got, tt.want)
+			}
+			if !equalCursor(res.PrevCursor, tt.prev) {
+				t.Errorf("prev cursor = %v, want %v", deref(res.PrevCursor), deref(tt.prev))
+			}
+			if !equalCursor(res.NextCursor, tt.next) {
+				t.Errorf("next cursor = %v, want %v", deref(res.NextCursor), deref(tt.next))
+			}
+		})
+	}
+}
+
+func equalCursor(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return "nil"
+	}
+	return *s
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "<b>" + snippetStartSel + "hello" + snippetStopSel + " & <script>"
+	want := "&lt;b&gt;<mark>hello</mark> &amp; &lt;script&gt;"
+
+	if got := highlightSnippet(snippet); got != want {
+		t.Errorf("highlightSnippet = %q, want %q", got, want)
+	}
+}
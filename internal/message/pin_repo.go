@@ -0,0 +1,41 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PinStore interface {
+	// Pin reports false when the message was already pinned. It fails with
+	// ErrConflict when the room already holds limit pins.
+	Pin(ctx context.Context, roomId models.RoomId, messageId models.MessageId, pinnedBy models.UserId, limit int) (bool, error)
+	Unpin(ctx context.Context, roomId models.RoomId, messageId models.MessageId) (bool, error)
+	// GetByRoomId lists a room's pins, most recently pinned first
+	GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Pin, error)
+}
+
+func scanPins(rows *sql.Rows) ([]models.Pin, error) {
+	pins := []models.Pin{}
+	for rows.Next() {
+		var pin models.Pin
+		var pinnedBy sql.NullInt64
+		if err := rows.Scan(&pin.RoomId, &pin.MessageId, &pinnedBy, &pin.PinnedAt); err != nil {
+			return nil, fmt.Errorf("scanning pin: %w", err)
+		}
+
+		if pinnedBy.Valid {
+			pin.PinnedBy = &pinnedBy.Int64
+		}
+
+		pins = append(pins, pin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating pins: %w", err)
+	}
+
+	return pins, nil
+}
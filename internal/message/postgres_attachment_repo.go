@@ -0,0 +1,109 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresAttachmentRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresAttachmentRepo(ctx context.Context, db *sql.DB) *PostgresAttachmentRepo {
+	return &PostgresAttachmentRepo{db}
+}
+
+func (s *PostgresAttachmentRepo) Create(ctx context.Context, attachment *models.Attachment) (models.AttachmentId, error) {
+	var id models.AttachmentId
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO message_attachments(room_id, uploaded_by, file_name, content_type, size,
+			storage_key, thumbnail_key, width, height)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		attachment.RoomId, attachment.UploadedBy, attachment.FileName, attachment.ContentType, attachment.Size,
+		attachment.StorageKey, attachment.ThumbnailKey, attachment.Width, attachment.Height).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("inserting attachment in room %d: %w", attachment.RoomId, err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresAttachmentRepo) GetById(ctx context.Context, id models.AttachmentId) (*models.Attachment, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE id = $1", id)
+
+	attachment, err := scanAttachment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting attachment %d: %w", id, err)
+	}
+
+	return attachment, nil
+}
+
+func (s *PostgresAttachmentRepo) GetByIds(ctx context.Context, ids []models.AttachmentId) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return []models.Attachment{}, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+func (s *PostgresAttachmentRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Attachment, error) {
+	if len(messageIds) == 0 {
+		return make(map[models.MessageId][]models.Attachment), nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE message_id = ANY($1) ORDER BY message_id, id",
+		messageIds)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupAttachments(attachments), nil
+}
+
+func (s *PostgresAttachmentRepo) DeleteOrphans(ctx context.Context, before time.Time) ([]models.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"DELETE FROM message_attachments WHERE message_id IS NULL AND created_at < $1 RETURNING "+attachmentColumns,
+		before)
+	if err != nil {
+		return nil, fmt.Errorf("deleting orphaned attachments before %s: %w", before, err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+func (s *PostgresAttachmentRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE room_id = $1 ORDER BY id", roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments for room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
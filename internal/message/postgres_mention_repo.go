@@ -0,0 +1,35 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresMentionRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresMentionRepo(ctx context.Context, db *sql.DB) *PostgresMentionRepo {
+	return &PostgresMentionRepo{db}
+}
+
+func (s *PostgresMentionRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Mention, error) {
+	mentions := make(map[models.MessageId][]models.Mention)
+	if len(messageIds) == 0 {
+		return mentions, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT message_id, kind, user_id, start_offset, end_offset
+	FROM message_mentions
+	WHERE message_id = ANY($1)
+	ORDER BY message_id, start_offset`, messageIds)
+	if err != nil {
+		return nil, fmt.Errorf("querying mentions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMentions(rows, mentions)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
@@ -21,10 +22,12 @@ func NewPostgresMessageRepo(ctx context.Context, db *sql.DB) *PostgresMessageRep
 func (s *PostgresMessageRepo) GetById(ctx context.Context, id models.MessageId) (*models.Message, error) {
 	var message models.Message
 	var updatedAt sql.NullTime
+	var parentId, deletedBy sql.NullInt64
+	var deletedAt sql.NullTime
 
-	query := `SELECT id, content, user_id, room_id, created_at, updated_at, delivered
+	query := `SELECT id, content, user_id, room_id, parent_id, created_at, updated_at, delivered, deleted_at, deleted_by
 	FROM messages
-	WHERE id = $1 AND deleted_at IS NULL`
+	WHERE id = $1`
 
 	row := s.db.QueryRowContext(ctx, query, id)
 
@@ -33,15 +36,30 @@ func (s *PostgresMessageRepo) GetById(ctx context.Context, id models.MessageId)
 		&message.Content,
 		&message.UserId,
 		&message.RoomId,
+		&parentId,
 		&message.CreatedAt,
 		&updatedAt,
 		&message.Delivered,
+		&deletedAt,
+		&deletedBy,
 	)
 
 	if updatedAt.Valid {
 		message.UpdatedAt = &updatedAt.Time
 	}
 
+	if parentId.Valid {
+		message.ParentId = &parentId.Int64
+	}
+
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+
+	if deletedBy.Valid {
+		message.DeletedBy = &deletedBy.Int64
+	}
+
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting message by id %d: %w", id, models.ErrNotFound)
@@ -52,20 +70,61 @@ func (s *PostgresMessageRepo) GetById(ctx context.Context, id models.MessageId)
 	return &message, nil
 }
 
-func (s *PostgresMessageRepo) Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string) (models.MessageId, error) {
-	var messageId models.MessageId
-	query := "INSERT INTO messages(user_id, room_id, content) VALUES($1, $2, $3) RETURNING id"
+func (s *PostgresMessageRepo) Create(ctx context.Context, msg NewMessage) (models.MessageId, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin inserting message into room %d: %w", msg.RoomId, err)
+	}
+	defer tx.Rollback()
 
-	err := s.db.QueryRowContext(ctx, query, userId, roomId, content).Scan(&messageId)
+	var messageId models.MessageId
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO messages(user_id, room_id, parent_id, content) VALUES($1, $2, $3, $4) RETURNING id",
+		msg.UserId, msg.RoomId, msg.ParentId, msg.Content).Scan(&messageId)
 	if err != nil {
-		return 0, fmt.Errorf("inserting message into room %d: %w", roomId, err)
+		return 0, fmt.Errorf("inserting message into room %d: %w", msg.RoomId, err)
+	}
+
+	for _, mention := range msg.Mentions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO message_mentions(message_id, kind, user_id, start_offset, end_offset) VALUES($1, $2, $3, $4, $5)",
+			messageId, mention.Kind, mention.UserId, mention.Start, mention.End)
+		if err != nil {
+			return 0, fmt.Errorf("inserting mention of message %d: %w", messageId, err)
+		}
+	}
+
+	if len(msg.AttachmentIds) > 0 {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE message_attachments SET message_id = $1 WHERE id = ANY($2) AND message_id IS NULL",
+			messageId, msg.AttachmentIds)
+		if err != nil {
+			return 0, fmt.Errorf("linking attachments to message %d: %w", messageId, err)
+		}
+
+		count, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("checking rows affected for attachments on message %d: %w", messageId, err)
+		}
+
+		// Another message claimed some of them in the meantime
+		if count != int64(len(msg.AttachmentIds)) {
+			return 0, fmt.Errorf("linked %d of %d attachments to message %d: %w", count, len(msg.AttachmentIds), messageId, models.ErrConflict)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit message %d: %w", messageId, err)
 	}
 
 	return messageId, nil
 }
 
-func (s *PostgresMessageRepo) DeleteById(ctx context.Context, id models.MessageId) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+func (s *PostgresMessageRepo) DeleteById(ctx context.Context, id models.MessageId, deletedBy models.UserId) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET content = '', deleted_at = CURRENT_TIMESTAMP, deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL`,
+		id, deletedBy)
 	if err != nil {
 		return fmt.Errorf("soft deleting message by id %d: %w", id, err)
 	}
@@ -82,8 +141,35 @@ func (s *PostgresMessageRepo) DeleteById(ctx context.Context, id models.MessageI
 	return nil
 }
 
-func (s *PostgresMessageRepo) UpdateContent(ctx context.Context, id models.MessageId, content string) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE messages SET content = $1 WHERE id = $2", content, id)
+func (s *PostgresMessageRepo) UpdateContent(ctx context.Context, id models.MessageId, editedBy models.UserId, content string, mentions []models.Mention) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin updating message content for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("updating message content for id %d: %w", id, models.ErrNotFound)
+		}
+		return fmt.Errorf("reading content of message %d: %w", id, err)
+	}
+
+	// Nothing changes, so there is no revision to keep or edit to show
+	if current == content {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO message_revisions(message_id, content, edited_by) VALUES($1, $2, $3)",
+		id, current, editedBy)
+	if err != nil {
+		return fmt.Errorf("saving revision of message %d: %w", id, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE messages SET content = $1, edited_at = CURRENT_TIMESTAMP WHERE id = $2 AND deleted_at IS NULL", content, id)
 	if err != nil {
 		return fmt.Errorf("updating message content for id %d: %w", id, err)
 	}
@@ -97,9 +183,52 @@ func (s *PostgresMessageRepo) UpdateContent(ctx context.Context, id models.Messa
 		return fmt.Errorf("updating message content for id %d: %w", id, models.ErrNotFound)
 	}
 
+	if _, err := tx.ExecContext(ctx, "DELETE FROM message_mentions WHERE message_id = $1", id); err != nil {
+		return fmt.Errorf("clearing mentions of message %d: %w", id, err)
+	}
+
+	for _, mention := range mentions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO message_mentions(message_id, kind, user_id, start_offset, end_offset) VALUES($1, $2, $3, $4, $5)",
+			id, mention.Kind, mention.UserId, mention.Start, mention.End)
+		if err != nil {
+			return fmt.Errorf("inserting mention of message %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit message content for id %d: %w", id, err)
+	}
+
 	return nil
 }
 
+func (s *PostgresMessageRepo) GetRevisionsById(ctx context.Context, id models.MessageId) ([]models.MessageRevision, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, message_id, content, edited_by, replaced_at
+	FROM message_revisions
+	WHERE message_id = $1
+	ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting revisions of message %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	revisions := []models.MessageRevision{}
+	for rows.Next() {
+		var revision models.MessageRevision
+		if err := rows.Scan(&revision.Id, &revision.MessageId, &revision.Content, &revision.EditedBy, &revision.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("scanning revision of message %d: %w", id, err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating revisions of message %d: %w", id, err)
+	}
+
+	return revisions, nil
+}
+
 func (s *PostgresMessageRepo) GetMessageReaders(ctx context.Context, messageId models.MessageId, roomId models.RoomId) ([]models.UserId, error) {
 	query := `SELECT rm.user_id 
 	FROM room_members rm 
@@ -127,12 +256,18 @@ func (s *PostgresMessageRepo) GetMessageReaders(ctx context.Context, messageId m
 	return readers, nil
 }
 
-func (s *PostgresMessageRepo) GetResponseById(ctx context.Context, id models.MessageId) (*models.ResponseMessage, error) {
-	var message models.ResponseMessage
-	var updatedAt sql.NullTime
-	var readByJSON []byte
-
-	row := s.db.QueryRowContext(ctx, `SELECT m.id, m.content, m.updated_at, u.id, u.name, m.created_at, m.room_id, m.delivered,
+// responseMessageQuery selects messages, tombstones included, in their
+// response shape: sender, thread summary and, last, who has read them.
+const responseMessageQuery = `SELECT m.id, m.content, m.edited_at, u.id, u.name, m.created_at, m.room_id, m.delivered, m.parent_id, m.deleted_at, m.deleted_by,
+	(
+		SELECT COUNT(*) FROM message_revisions v
+		WHERE v.message_id = m.id
+	) AS revision_count,
+	(
+		SELECT COUNT(*) FROM messages r
+		WHERE r.parent_id = m.id AND r.deleted_at IS NULL
+	) AS reply_count,
+	lr.id, lr.content, lr.user_id, lru.name, lr.created_at,
 	COALESCE((
 		SELECT json_agg(rm.user_id) 
 		FROM room_members rm 
@@ -140,24 +275,35 @@ func (s *PostgresMessageRepo) GetResponseById(ctx context.Context, id models.Mes
 	), '[]'::json) as read_by
 	FROM messages m
 	JOIN users u ON m.user_id = u.id
-	WHERE m.id = $1 AND m.deleted_at IS NULL`, id)
+	LEFT JOIN LATERAL (
+		SELECT r.id, r.content, r.user_id, r.created_at
+		FROM messages r
+		WHERE r.parent_id = m.id AND r.deleted_at IS NULL
+		ORDER BY r.id DESC
+		LIMIT 1
+	) lr ON TRUE
+	LEFT JOIN users lru ON lru.id = lr.user_id`
+
+func scanPostgresResponseMessage(row rowScanner) (*models.ResponseMessage, error) {
+	var readByJSON []byte
 
-	err := row.Scan(
-		&message.Id,
-		&message.Content,
-		&updatedAt,
-		&message.SenderId,
-		&message.SenderName,
-		&message.SentAt,
-		&message.RoomId,
-		&message.Delivered,
-		&readByJSON,
-	)
+	msg, err := scanResponseMessage(row, &readByJSON)
+	if err != nil {
+		return nil, err
+	}
 
-	if updatedAt.Valid {
-		message.EditedAt = &updatedAt.Time
+	if err := json.Unmarshal(readByJSON, &msg.ReadBy); err != nil {
+		msg.ReadBy = []models.UserId{}
 	}
 
+	return msg, nil
+}
+
+func (s *PostgresMessageRepo) GetResponseById(ctx context.Context, id models.MessageId) (*models.ResponseMessage, error) {
+	row := s.db.QueryRowContext(ctx, responseMessageQuery+`
+	WHERE m.id = $1`, id)
+
+	message, err := scanPostgresResponseMessage(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting response message by id %d: %w", id, models.ErrNotFound)
@@ -165,90 +311,77 @@ func (s *PostgresMessageRepo) GetResponseById(ctx context.Context, id models.Mes
 		return nil, fmt.Errorf("scanning response message by id %d: %w", id, err)
 	}
 
-	if err := json.Unmarshal(readByJSON, &message.ReadBy); err != nil {
-		message.ReadBy = []models.UserId{}
+	return message, nil
+}
+
+// GetMessagesById pages through the room's top level messages, replies are
+// fetched per thread with GetRepliesById. Tombstones stay in the page so
+// threads and read markers keep their place.
+func (s *PostgresMessageRepo) GetMessagesById(ctx context.Context, roomId models.RoomId, page PageQuery) (*GetMessagesResponse, error) {
+	res, err := pageMessages(page, func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+		return s.queryMessages(ctx, "m.room_id = $1 AND m.parent_id IS NULL", roomId, op, anchor, newestFirst, limit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("messages for room %d: %w", roomId, err)
 	}
 
-	return &message, nil
+	return res, nil
 }
 
-func (s *PostgresMessageRepo) GetMessagesById(ctx context.Context, roomId models.RoomId, limit int, cursor *string) (*GetMessagesResponse, error) {
-	query := `SELECT m.id, m.content, m.updated_at, u.id, u.name, m.created_at, m.room_id, m.delivered,
-	COALESCE((
-		SELECT json_agg(rm.user_id) 
-		FROM room_members rm 
-		WHERE rm.room_id = m.room_id AND rm.last_message_read_id >= m.id
-	), '[]'::json) as read_by
-	FROM messages m
-	JOIN users u ON m.user_id = u.id
-	WHERE m.room_id = $1 AND m.deleted_at IS NULL`
+func (s *PostgresMessageRepo) GetRepliesById(ctx context.Context, parentId models.MessageId, page PageQuery) (*GetMessagesResponse, error) {
+	res, err := pageMessages(page, func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+		return s.queryMessages(ctx, "m.parent_id = $1", parentId, op, anchor, newestFirst, limit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replies to message %d: %w", parentId, err)
+	}
+
+	return res, nil
+}
+
+// queryMessages loads the messages matching filter, which takes its one
+// argument as $1, bounded by op against anchor as pageMessages asks.
+func (s *PostgresMessageRepo) queryMessages(ctx context.Context, filter string, arg any, op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+	query := responseMessageQuery + `
+	WHERE ` + filter
 
-	args := []any{roomId}
-	placeholderCount := 1
+	args := []any{arg}
 
-	if cursor != nil && *cursor != "" {
-		placeholderCount++
-		query += fmt.Sprintf(" AND m.id > $%d ", placeholderCount)
-		args = append(args, *cursor)
+	if op != "" {
+		args = append(args, anchor)
+		query += fmt.Sprintf(" AND m.id %s $%d", op, len(args))
 	}
 
-	placeholderCount++
-	query += fmt.Sprintf(" ORDER BY m.id ASC LIMIT $%d", placeholderCount)
-	args = append(args, limit+1)
+	order := "ASC"
+	if newestFirst {
+		order = "DESC"
+	}
+
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY m.id %s LIMIT $%d", order, len(args))
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("querying messages for room %d: %w", roomId, err)
+		return nil, fmt.Errorf("querying: %w", err)
 	}
 
 	defer rows.Close()
 
 	messages := []models.ResponseMessage{}
 	for rows.Next() {
-		var msg models.ResponseMessage
-		var updatedAt sql.NullTime
-		var readByJSON []byte
-
-		err := rows.Scan(
-			&msg.Id,
-			&msg.Content,
-			&updatedAt,
-			&msg.SenderId,
-			&msg.SenderName,
-			&msg.SentAt,
-			&msg.RoomId,
-			&msg.Delivered,
-			&readByJSON,
-		)
-
-		if updatedAt.Valid {
-			msg.EditedAt = &updatedAt.Time
-		}
-
+		msg, err := scanPostgresResponseMessage(rows)
 		if err != nil {
-			return nil, fmt.Errorf("scanning messages for room %d: %w", roomId, err)
-		}
-
-		if err := json.Unmarshal(readByJSON, &msg.ReadBy); err != nil {
-			msg.ReadBy = []models.UserId{}
+			return nil, fmt.Errorf("scanning: %w", err)
 		}
 
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterating messages for room %d: %w", roomId, err)
+		return nil, fmt.Errorf("iterating: %w", err)
 	}
 
-	var nextCursor *string
-	if len(messages) > limit {
-		lastRoom := messages[limit]
-		c := fmt.Sprintf("%d", lastRoom.Id)
-		nextCursor = &c
-		messages = messages[:limit]
-	}
-
-	return &GetMessagesResponse{Messages: messages, NextCursor: nextCursor}, nil
+	return messages, nil
 }
 
 func (s *PostgresMessageRepo) MarkAsDelivered(ctx context.Context, messageId models.MessageId) error {
@@ -270,3 +403,188 @@ func (s *PostgresMessageRepo) MarkAsDelivered(ctx context.Context, messageId mod
 
 	return nil
 }
+
+func (s *PostgresMessageRepo) MarkDeliveredTo(ctx context.Context, messageId models.MessageId, userId models.UserId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_deliveries(message_id, user_id) VALUES($1, $2)
+		ON CONFLICT (message_id, user_id) DO NOTHING`,
+		messageId, userId)
+	if err != nil {
+		return false, fmt.Errorf("recording delivery of message %d to user %d: %w", messageId, userId, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for delivery of message %d: %w", messageId, err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CountUndelivered counts the members, other than the sender, who were in
+// the room when the message was sent and have not acknowledged it yet.
+func (s *PostgresMessageRepo) CountUndelivered(ctx context.Context, messageId models.MessageId) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*)
+	FROM messages m
+	JOIN room_members rm ON rm.room_id = m.room_id
+	WHERE m.id = $1
+		AND rm.user_id <> m.user_id
+		AND rm.joined_at <= m.created_at
+		AND NOT EXISTS (
+			SELECT 1 FROM message_deliveries d
+			WHERE d.message_id = m.id AND d.user_id = rm.user_id
+		)`, messageId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting undelivered recipients of message %d: %w", messageId, err)
+	}
+
+	return count, nil
+}
+
+func (s *PostgresMessageRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM messages m
+	WHERE m.deleted_at IS NOT NULL AND m.deleted_at < $1
+		AND NOT EXISTS (
+			SELECT 1 FROM messages r
+			WHERE r.parent_id = m.id AND r.deleted_at IS NULL
+		)`, before)
+	if err != nil {
+		return 0, fmt.Errorf("purging deleted messages before %s: %w", before, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking rows affected for purge: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *PostgresMessageRepo) SearchMessages(ctx context.Context, payload SearchMessagesPayload) (*SearchMessagesResponse, error) {
+	query := `SELECT m.id, m.room_id, r.name, m.parent_id, u.id, u.name,
+		ts_headline('simple', m.content, q, $3),
+		m.created_at
+	FROM messages m
+	CROSS JOIN websearch_to_tsquery('simple', $2) q
+	JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = $1
+	JOIN rooms r ON r.id = m.room_id
+	JOIN users u ON u.id = m.user_id
+	WHERE m.search_vector @@ q AND m.deleted_at IS NULL`
+
+	args := []any{
+		payload.UserId,
+		payload.Query,
+		fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10", snippetStartSel, snippetStopSel),
+	}
+
+	addFilter := func(clause string, arg any) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+clause, len(args))
+	}
+
+	if payload.RoomId != nil {
+		addFilter("m.room_id = $%d", *payload.RoomId)
+	}
+	if payload.SenderId != nil {
+		addFilter("m.user_id = $%d", *payload.SenderId)
+	}
+	if payload.From != nil {
+		addFilter("m.created_at >= $%d", *payload.From)
+	}
+	if payload.To != nil {
+		addFilter("m.created_at <= $%d", *payload.To)
+	}
+	if payload.Cursor != nil {
+		addFilter("m.id < $%d", *payload.Cursor)
+	}
+
+	args = append(args, payload.Limit+1)
+	query += fmt.Sprintf(" ORDER BY m.id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("searching messages for user %d: %w", payload.UserId, err)
+	}
+	defer rows.Close()
+
+	res, err := scanSearchResults(rows, payload.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("searching messages for user %d: %w", payload.UserId, err)
+	}
+
+	return res, nil
+}
+
+func (s *PostgresMessageRepo) ReserveNonce(ctx context.Context, userId models.UserId, nonce string, since time.Time, staleBefore time.Time) (bool, *models.MessageId, error) {
+	// A nonce last used before the window, or whose send never finished, is
+	// free to claim again
+	res, err := s.db.ExecContext(ctx, `INSERT INTO message_nonces(user_id, nonce) VALUES($1, $2)
+	ON CONFLICT (user_id, nonce) DO UPDATE SET message_id = NULL, created_at = CURRENT_TIMESTAMP
+	WHERE message_nonces.created_at < $3
+		OR (message_nonces.message_id IS NULL AND message_nonces.created_at < $4)`, userId, nonce, since, staleBefore)
+	if err != nil {
+		return false, nil, fmt.Errorf("reserving nonce for user %d: %w", userId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, nil, fmt.Errorf("checking rows affected for nonce of user %d: %w", userId, err)
+	}
+
+	if count > 0 {
+		return true, nil, nil
+	}
+
+	var messageId sql.NullInt64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT message_id FROM message_nonces WHERE user_id = $1 AND nonce = $2",
+		userId, nonce).Scan(&messageId)
+	if err != nil {
+		return false, nil, fmt.Errorf("getting message for nonce of user %d: %w", userId, err)
+	}
+
+	if !messageId.Valid {
+		return false, nil, nil
+	}
+
+	return false, &messageId.Int64, nil
+}
+
+func (s *PostgresMessageRepo) CompleteNonce(ctx context.Context, userId models.UserId, nonce string, messageId models.MessageId) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE message_nonces SET message_id = $1 WHERE user_id = $2 AND nonce = $3",
+		messageId, userId, nonce)
+	if err != nil {
+		return fmt.Errorf("recording nonce of message %d: %w", messageId, err)
+	}
+
+	return nil
+}
+
+func (s *PostgresMessageRepo) ReleaseNonce(ctx context.Context, userId models.UserId, nonce string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_nonces WHERE user_id = $1 AND nonce = $2 AND message_id IS NULL",
+		userId, nonce)
+	if err != nil {
+		return fmt.Errorf("releasing nonce of user %d: %w", userId, err)
+	}
+
+	return nil
+}
+
+func (s *PostgresMessageRepo) PurgeNonces(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_nonces WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("purging nonces before %s: %w", before, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking rows affected for nonce purge: %w", err)
+	}
+
+	return count, nil
+}
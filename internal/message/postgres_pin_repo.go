@@ -0,0 +1,94 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresPinRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresPinRepo(ctx context.Context, db *sql.DB) *PostgresPinRepo {
+	return &PostgresPinRepo{db}
+}
+
+func (s *PostgresPinRepo) Pin(ctx context.Context, roomId models.RoomId, messageId models.MessageId, pinnedBy models.UserId, limit int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin pinning message %d in room %d: %w", messageId, roomId, err)
+	}
+	defer tx.Rollback()
+
+	// Holding the room row makes concurrent pins count one after another
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM rooms WHERE id = $1 FOR UPDATE", roomId); err != nil {
+		return false, fmt.Errorf("locking room %d for pin: %w", roomId, err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO room_pins(room_id, message_id, pinned_by)
+		SELECT $1, $2, $3
+		WHERE (SELECT COUNT(*) FROM room_pins WHERE room_id = $1) < $4
+		ON CONFLICT (room_id, message_id) DO NOTHING`,
+		roomId, messageId, pinnedBy, limit)
+	if err != nil {
+		return false, fmt.Errorf("pinning message %d in room %d: %w", messageId, roomId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for pin of message %d: %w", messageId, err)
+	}
+
+	if count == 0 {
+		var pinned bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM room_pins WHERE room_id = $1 AND message_id = $2)",
+			roomId, messageId).Scan(&pinned)
+		if err != nil {
+			return false, fmt.Errorf("checking pin of message %d in room %d: %w", messageId, roomId, err)
+		}
+
+		if !pinned {
+			return false, fmt.Errorf("room %d has %d pins: %w", roomId, limit, models.ErrConflict)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit pin of message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresPinRepo) Unpin(ctx context.Context, roomId models.RoomId, messageId models.MessageId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM room_pins WHERE room_id = $1 AND message_id = $2",
+		roomId, messageId)
+	if err != nil {
+		return false, fmt.Errorf("unpinning message %d in room %d: %w", messageId, roomId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for pin of message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresPinRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Pin, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT room_id, message_id, pinned_by, pinned_at
+	FROM room_pins
+	WHERE room_id = $1
+	ORDER BY pinned_at DESC, message_id DESC`, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying pins in room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanPins(rows)
+}
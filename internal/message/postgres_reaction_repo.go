@@ -0,0 +1,83 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresReactionRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresReactionRepo(ctx context.Context, db *sql.DB) *PostgresReactionRepo {
+	return &PostgresReactionRepo{db}
+}
+
+func (s *PostgresReactionRepo) Add(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_reactions(message_id, user_id, emoji) VALUES($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING`,
+		messageId, userId, emoji)
+	if err != nil {
+		return false, fmt.Errorf("adding reaction to message %d: %w", messageId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for reaction on message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresReactionRepo) Remove(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3",
+		messageId, userId, emoji)
+	if err != nil {
+		return false, fmt.Errorf("removing reaction from message %d: %w", messageId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for reaction on message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresReactionRepo) CountByEmoji(ctx context.Context, messageId models.MessageId, emoji string) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2",
+		messageId, emoji).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting %s reactions on message %d: %w", emoji, messageId, err)
+	}
+
+	return count, nil
+}
+
+// GetByMessageIds groups the reactions on each message by emoji, in the
+// order each emoji was first used.
+func (s *PostgresReactionRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Reaction, error) {
+	reactions := make(map[models.MessageId][]models.Reaction)
+	if len(messageIds) == 0 {
+		return reactions, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT message_id, emoji, user_id
+	FROM message_reactions
+	WHERE message_id = ANY($1)
+	ORDER BY message_id, created_at, user_id`, messageIds)
+	if err != nil {
+		return nil, fmt.Errorf("querying reactions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReactions(rows, reactions)
+}
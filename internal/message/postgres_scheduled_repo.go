@@ -0,0 +1,159 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresScheduledMessageRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduledMessageRepo(ctx context.Context, db *sql.DB) *PostgresScheduledMessageRepo {
+	return &PostgresScheduledMessageRepo{db}
+}
+
+func (s *PostgresScheduledMessageRepo) Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string, sendAt time.Time) (models.ScheduledMessageId, error) {
+	var id models.ScheduledMessageId
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO scheduled_messages(room_id, user_id, content, send_at)
+		VALUES($1, $2, $3, $4) RETURNING id`,
+		roomId, userId, content, sendAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("scheduling message in room %d: %w", roomId, err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresScheduledMessageRepo) GetById(ctx context.Context, id models.ScheduledMessageId) (*models.ScheduledMessage, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+scheduledColumns+" FROM scheduled_messages WHERE id = $1", id)
+
+	msg, err := scanScheduledMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting scheduled message %d: %w", id, err)
+	}
+
+	return msg, nil
+}
+
+func (s *PostgresScheduledMessageRepo) GetByUserId(ctx context.Context, roomId models.RoomId, userId models.UserId) ([]models.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+scheduledColumns+`
+	FROM scheduled_messages
+	WHERE room_id = $1 AND user_id = $2
+	ORDER BY send_at, id`, roomId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("querying scheduled messages of user %d in room %d: %w", userId, roomId, err)
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+func (s *PostgresScheduledMessageRepo) CountByUserId(ctx context.Context, userId models.UserId) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM scheduled_messages WHERE user_id = $1", userId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting scheduled messages of user %d: %w", userId, err)
+	}
+
+	return count, nil
+}
+
+func (s *PostgresScheduledMessageRepo) Update(ctx context.Context, id models.ScheduledMessageId, content string, sendAt time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_messages
+		SET content = $1, send_at = $2, status = 'pending', failure = NULL, claimed_at = NULL, updated_at = NOW()
+		WHERE id = $3 AND status IN ('pending', 'failed')`,
+		content, sendAt, id)
+	if err != nil {
+		return false, fmt.Errorf("updating scheduled message %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for scheduled message %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresScheduledMessageRepo) Delete(ctx context.Context, id models.ScheduledMessageId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM scheduled_messages WHERE id = $1 AND status IN ('pending', 'failed')", id)
+	if err != nil {
+		return false, fmt.Errorf("deleting scheduled message %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for scheduled message %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresScheduledMessageRepo) ClaimDue(ctx context.Context, now time.Time, staleBefore time.Time, limit int) ([]models.ScheduledMessage, error) {
+	// SKIP LOCKED lets every replica run a scheduler without two of them
+	// claiming the same message
+	rows, err := s.db.QueryContext(ctx, `UPDATE scheduled_messages
+	SET status = 'sending', claimed_at = $1
+	WHERE id IN (
+		SELECT id FROM scheduled_messages
+		WHERE (status = 'pending' AND send_at <= $1)
+			OR (status = 'sending' AND claimed_at < $2)
+		ORDER BY send_at, id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+scheduledColumns, now, staleBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claiming due scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+func (s *PostgresScheduledMessageRepo) Complete(ctx context.Context, id models.ScheduledMessageId) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE id = $1", id); err != nil {
+		return fmt.Errorf("completing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *PostgresScheduledMessageRepo) Fail(ctx context.Context, id models.ScheduledMessageId, failure string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_messages
+		SET status = 'failed', failure = $1, claimed_at = NULL, updated_at = NOW()
+		WHERE id = $2 AND status = 'sending'`,
+		failure, id)
+	if err != nil {
+		return fmt.Errorf("failing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *PostgresScheduledMessageRepo) Release(ctx context.Context, id models.ScheduledMessageId) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE scheduled_messages SET status = 'pending', claimed_at = NULL WHERE id = $1 AND status = 'sending'", id)
+	if err != nil {
+		return fmt.Errorf("releasing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
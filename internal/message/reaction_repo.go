@@ -0,0 +1,48 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type ReactionStore interface {
+	Add(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error)
+	Remove(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error)
+	CountByEmoji(ctx context.Context, messageId models.MessageId, emoji string) (int, error)
+	GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Reaction, error)
+}
+
+// scanReactions groups (message_id, emoji, user_id) rows into reactions.
+func scanReactions(rows *sql.Rows, reactions map[models.MessageId][]models.Reaction) (map[models.MessageId][]models.Reaction, error) {
+	for rows.Next() {
+		var messageId models.MessageId
+		var emoji string
+		var userId models.UserId
+		if err := rows.Scan(&messageId, &emoji, &userId); err != nil {
+			return nil, fmt.Errorf("scanning reaction: %w", err)
+		}
+
+		list := reactions[messageId]
+		found := false
+		for i := range list {
+			if list[i].Emoji == emoji {
+				list[i].UserIds = append(list[i].UserIds, userId)
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, models.Reaction{Emoji: emoji, UserIds: []models.UserId{userId}})
+		}
+		reactions[messageId] = list
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating reactions: %w", err)
+	}
+
+	return reactions, nil
+}
@@ -0,0 +1,251 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/logger"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/internal/room"
+)
+
+const (
+	// maxScheduled caps how many messages one user may have waiting
+	maxScheduled = 100
+	// maxScheduleAhead is how far in the future a message may be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// scheduledClaimTimeout is how long a claimed message may stay sending
+	// before another scheduler takes it over, as when a server died mid-send
+	scheduledClaimTimeout = 5 * time.Minute
+	scheduledBatchSize    = 50
+)
+
+// ScheduleService keeps messages written now to be posted later. Due
+// messages are posted through the MessageService, so they are stored and
+// broadcast like any other message.
+type ScheduleService struct {
+	scheduledStore  ScheduledMessageStore
+	roomMemberStore room.RoomMemberStore
+	messageService  *MessageService
+}
+
+func NewScheduleService(scheduledStore ScheduledMessageStore, roomMemberStore room.RoomMemberStore, messageService *MessageService) *ScheduleService {
+	return &ScheduleService{
+		scheduledStore:  scheduledStore,
+		roomMemberStore: roomMemberStore,
+		messageService:  messageService,
+	}
+}
+
+func validateScheduled(content string, sendAt time.Time) error {
+	if strings.TrimSpace(content) == "" || len(content) > 2000 {
+		return models.ErrInvalidInput
+	}
+
+	now := time.Now()
+	if !sendAt.After(now) || sendAt.After(now.Add(maxScheduleAhead)) {
+		return models.ErrInvalidInput
+	}
+
+	return nil
+}
+
+func (srv *ScheduleService) ensureMember(ctx context.Context, roomId models.RoomId, userId models.UserId) error {
+	exists, err := srv.roomMemberStore.Exists(ctx, roomId, userId)
+	if err != nil {
+		return fmt.Errorf("ensure member user_id=%d exists in room_id=%d: %w", userId, roomId, err)
+	}
+
+	if !exists {
+		return models.ErrUnauthorized
+	}
+
+	return nil
+}
+
+// getOwn loads a scheduled message of the user's in the room. Anyone
+// else's is reported as not found, as scheduled messages are private.
+func (srv *ScheduleService) getOwn(ctx context.Context, userId models.UserId, roomId models.RoomId, id models.ScheduledMessageId) (*models.ScheduledMessage, error) {
+	msg, err := srv.scheduledStore.GetById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get scheduled message id=%d: %w", id, err)
+	}
+
+	if msg.UserId != userId || msg.RoomId != roomId {
+		return nil, models.ErrNotFound
+	}
+
+	return msg, nil
+}
+
+func (srv *ScheduleService) HandleSchedule(ctx context.Context, payload ScheduleMessagePayload) (*models.ScheduledMessage, error) {
+	if err := srv.ensureMember(ctx, payload.RoomId, payload.UserId); err != nil {
+		return nil, fmt.Errorf("schedule message: %w", err)
+	}
+
+	if err := validateScheduled(payload.Content, payload.SendAt); err != nil {
+		return nil, err
+	}
+
+	count, err := srv.scheduledStore.CountByUserId(ctx, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("schedule message: %w", err)
+	}
+
+	if count >= maxScheduled {
+		return nil, fmt.Errorf("user_id=%d has %d scheduled messages: %w", payload.UserId, count, models.ErrConflict)
+	}
+
+	id, err := srv.scheduledStore.Create(ctx, payload.RoomId, payload.UserId, payload.Content, payload.SendAt)
+	if err != nil {
+		return nil, fmt.Errorf("schedule message: %w", err)
+	}
+
+	msg, err := srv.scheduledStore.GetById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get scheduled message id=%d: %w", id, err)
+	}
+
+	return msg, nil
+}
+
+func (srv *ScheduleService) HandleGetScheduled(ctx context.Context, payload GetScheduledPayload) (*GetScheduledResponse, error) {
+	messages, err := srv.scheduledStore.GetByUserId(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("get scheduled messages: %w", err)
+	}
+
+	return &GetScheduledResponse{Messages: messages}, nil
+}
+
+func (srv *ScheduleService) HandleEditScheduled(ctx context.Context, payload EditScheduledPayload) (*models.ScheduledMessage, error) {
+	if err := srv.ensureMember(ctx, payload.RoomId, payload.UserId); err != nil {
+		return nil, fmt.Errorf("edit scheduled message: %w", err)
+	}
+
+	msg, err := srv.getOwn(ctx, payload.UserId, payload.RoomId, payload.ScheduledId)
+	if err != nil {
+		return nil, err
+	}
+
+	content, sendAt := msg.Content, msg.SendAt
+	if payload.Content != nil {
+		content = *payload.Content
+	}
+	if payload.SendAt != nil {
+		sendAt = *payload.SendAt
+	}
+
+	if err := validateScheduled(content, sendAt); err != nil {
+		return nil, err
+	}
+
+	updated, err := srv.scheduledStore.Update(ctx, msg.Id, content, sendAt)
+	if err != nil {
+		return nil, fmt.Errorf("edit scheduled message: %w", err)
+	}
+
+	// The scheduler claimed it in the meantime; it is being posted as it was
+	if !updated {
+		return nil, fmt.Errorf("scheduled message id=%d is being sent: %w", msg.Id, models.ErrConflict)
+	}
+
+	msg, err = srv.scheduledStore.GetById(ctx, msg.Id)
+	if err != nil {
+		return nil, fmt.Errorf("get scheduled message id=%d: %w", payload.ScheduledId, err)
+	}
+
+	return msg, nil
+}
+
+func (srv *ScheduleService) HandleCancelScheduled(ctx context.Context, payload CancelScheduledPayload) error {
+	msg, err := srv.getOwn(ctx, payload.UserId, payload.RoomId, payload.ScheduledId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := srv.scheduledStore.Delete(ctx, msg.Id)
+	if err != nil {
+		return fmt.Errorf("cancel scheduled message: %w", err)
+	}
+
+	if !deleted {
+		return fmt.Errorf("scheduled message id=%d is being sent: %w", msg.Id, models.ErrConflict)
+	}
+
+	return nil
+}
+
+// HandlePublishDue posts every scheduled message that has come due. A
+// message that can never be posted, such as when its author has left the
+// room, is marked failed; one that hit a passing error is retried on the
+// next run.
+func (srv *ScheduleService) HandlePublishDue(ctx context.Context) error {
+	for {
+		now := time.Now()
+		due, err := srv.scheduledStore.ClaimDue(ctx, now, now.Add(-scheduledClaimTimeout), scheduledBatchSize)
+		if err != nil {
+			return fmt.Errorf("publish scheduled messages: %w", err)
+		}
+
+		for _, msg := range due {
+			srv.publish(ctx, msg)
+		}
+
+		if len(due) < scheduledBatchSize {
+			return nil
+		}
+	}
+}
+
+func (srv *ScheduleService) publish(ctx context.Context, msg models.ScheduledMessage) {
+	// The nonce makes posting idempotent, so a message claimed again after
+	// a crash mid-send is not posted twice
+	nonce := "scheduled:" + strconv.FormatInt(msg.Id, 10)
+
+	res, err := srv.messageService.HandleSendMessage(ctx, SendMessagePayload{
+		UserId:  msg.UserId,
+		RoomId:  msg.RoomId,
+		Content: msg.Content,
+		Nonce:   &nonce,
+	})
+
+	if err == nil {
+		if err := srv.scheduledStore.Complete(ctx, msg.Id); err != nil {
+			logger.Error("Failed to complete scheduled message", "scheduled_id", msg.Id, "error", err)
+		}
+
+		logger.Info("scheduled_message_sent", "scheduled_id", msg.Id, "message_id", res.Id, "room_id", msg.RoomId)
+		return
+	}
+
+	if failure := scheduledFailure(err); failure != "" {
+		logger.Warn("Scheduled message failed", "scheduled_id", msg.Id, "room_id", msg.RoomId, "error", err)
+		if err := srv.scheduledStore.Fail(ctx, msg.Id, failure); err != nil {
+			logger.Error("Failed to mark scheduled message failed", "scheduled_id", msg.Id, "error", err)
+		}
+		return
+	}
+
+	logger.Error("Failed to send scheduled message, will retry", "scheduled_id", msg.Id, "error", err)
+	if err := srv.scheduledStore.Release(ctx, msg.Id); err != nil {
+		logger.Error("Failed to release scheduled message", "scheduled_id", msg.Id, "error", err)
+	}
+}
+
+// scheduledFailure describes why a message could never be posted, or is
+// empty when the error may pass and posting should be retried.
+func scheduledFailure(err error) string {
+	switch {
+	case errors.Is(err, models.ErrUnauthorized), errors.Is(err, models.ErrForbidden):
+		return "No longer a member of the room"
+	case errors.Is(err, models.ErrInvalidInput), errors.Is(err, models.ErrNotFound), errors.Is(err, models.ErrConflict):
+		return "Message could not be sent"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,29 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+func TestScheduledFailure(t *testing.T) {
+	tests := []struct {
+		err   error
+		retry bool
+	}{
+		{models.ErrUnauthorized, false},
+		{fmt.Errorf("send message: %w", models.ErrInvalidInput), false},
+		{models.ErrConflict, false},
+		{errors.New("connection refused"), true},
+		{context.DeadlineExceeded, true},
+	}
+
+	for _, tt := range tests {
+		if got := scheduledFailure(tt.err) == ""; got != tt.retry {
+			t.Errorf("scheduledFailure(%v) retries = %v, want %v", tt.err, got, tt.retry)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type ScheduledMessageStore interface {
+	Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string, sendAt time.Time) (models.ScheduledMessageId, error)
+	GetById(ctx context.Context, id models.ScheduledMessageId) (*models.ScheduledMessage, error)
+	// GetByUserId lists a user's scheduled messages in a room, soonest first
+	GetByUserId(ctx context.Context, roomId models.RoomId, userId models.UserId) ([]models.ScheduledMessage, error)
+	CountByUserId(ctx context.Context, userId models.UserId) (int, error)
+	// Update changes a pending or failed message and sets it pending again.
+	// It reports false when the message is being sent or is gone
+	Update(ctx context.Context, id models.ScheduledMessageId, content string, sendAt time.Time) (bool, error)
+	// Delete removes a pending or failed message, reporting false when the
+	// message is being sent or is gone
+	Delete(ctx context.Context, id models.ScheduledMessageId) (bool, error)
+	// ClaimDue marks up to limit messages due by now as sending and returns
+	// them. Messages left sending since before staleBefore are claimed again
+	ClaimDue(ctx context.Context, now time.Time, staleBefore time.Time, limit int) ([]models.ScheduledMessage, error)
+	// Complete removes a message once it has been posted
+	Complete(ctx context.Context, id models.ScheduledMessageId) error
+	Fail(ctx context.Context, id models.ScheduledMessageId, failure string) error
+	// Release sets a claimed message pending again so it is retried
+	Release(ctx context.Context, id models.ScheduledMessageId) error
+}
+
+const scheduledColumns = "id, room_id, user_id, content, send_at, status, failure, created_at, updated_at"
+
+func scanScheduledMessage(row rowScanner) (*models.ScheduledMessage, error) {
+	var msg models.ScheduledMessage
+	var failure sql.NullString
+
+	err := row.Scan(&msg.Id, &msg.RoomId, &msg.UserId, &msg.Content, &msg.SendAt,
+		&msg.Status, &failure, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if failure.Valid {
+		msg.Failure = &failure.String
+	}
+
+	return &msg, nil
+}
+
+func scanScheduledMessages(rows *sql.Rows) ([]models.ScheduledMessage, error) {
+	messages := []models.ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning scheduled message: %w", err)
+		}
+
+		messages = append(messages, *msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating scheduled messages: %w", err)
+	}
+
+	return messages, nil
+}
@@ -1,22 +1,62 @@
 package message
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/ayushgpt01/chatRoomGo/internal/blob"
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 	"github.com/ayushgpt01/chatRoomGo/internal/room"
+	"github.com/google/uuid"
 )
 
 type MessageService struct {
 	messageStore    MessageStore
+	reactionStore   ReactionStore
+	mentionStore    MentionStore
+	attachmentStore AttachmentStore
+	pinStore        PinStore
+	blobs           blob.Store
 	roomMemberStore room.RoomMemberStore
 	hub             models.HubBroadcaster
+	presence        PresenceLookup
+	permissions     *room.Permissions
 }
 
-func NewMessageService(messageStore MessageStore, roomMemberStore room.RoomMemberStore, hub models.HubBroadcaster) *MessageService {
-	return &MessageService{messageStore, roomMemberStore, hub}
+// PresenceLookup tells whether a user is active right now, which decides
+// who an @here mention reaches.
+type PresenceLookup interface {
+	IsOnline(userId models.UserId) bool
+}
+
+func NewMessageService(messageStore MessageStore, reactionStore ReactionStore, mentionStore MentionStore, attachmentStore AttachmentStore, pinStore PinStore, blobs blob.Store, roomMemberStore room.RoomMemberStore, hub models.HubBroadcaster) *MessageService {
+	return &MessageService{
+		messageStore:    messageStore,
+		reactionStore:   reactionStore,
+		mentionStore:    mentionStore,
+		attachmentStore: attachmentStore,
+		pinStore:        pinStore,
+		blobs:           blobs,
+		roomMemberStore: roomMemberStore,
+		hub:             hub,
+		permissions:     room.NewPermissions(roomMemberStore),
+	}
+}
+
+// TrackPresence sets where @here looks up who is online. Without it @here
+// reaches every member, like @room.
+func (srv *MessageService) TrackPresence(presence PresenceLookup) {
+	srv.presence = presence
 }
 
 func (srv *MessageService) ensureMember(
@@ -42,11 +82,38 @@ func (srv *MessageService) HandleGetMessages(ctx context.Context, payload GetMes
 		return &GetMessagesResponse{}, models.ErrUnauthorized
 	}
 
-	response, err := srv.messageStore.GetMessagesById(ctx, payload.RoomId, payload.Limit, payload.Cursor)
+	if payload.Page.Around != nil {
+		anchor, err := srv.messageStore.GetById(ctx, *payload.Page.Around)
+		if err != nil {
+			return &GetMessagesResponse{}, fmt.Errorf("get anchor message id=%d: %w", *payload.Page.Around, err)
+		}
+
+		if anchor.RoomId != payload.RoomId || anchor.ParentId != nil {
+			return &GetMessagesResponse{}, models.ErrNotFound
+		}
+	}
+
+	response, err := srv.messageStore.GetMessagesById(ctx, payload.RoomId, payload.Page)
 	if err != nil {
 		return &GetMessagesResponse{}, fmt.Errorf("get messages by room_id=%d: %w", payload.RoomId, err)
 	}
 
+	if err := srv.attachReactions(ctx, payload.UserId, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get messages: %w", err)
+	}
+
+	if err := srv.attachMentions(ctx, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get messages: %w", err)
+	}
+
+	if err := srv.attachAttachments(ctx, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get messages: %w", err)
+	}
+
+	if err := srv.attachPins(ctx, payload.RoomId, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get messages: %w", err)
+	}
+
 	return response, nil
 }
 
@@ -55,25 +122,61 @@ func (srv *MessageService) HandleSendMessage(
 	payload SendMessagePayload,
 ) (*models.ResponseMessage, error) {
 
-	exists, err := srv.ensureMember(ctx, payload.RoomId, payload.UserId)
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, room.PermissionSendMessage); err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
+	}
+
+	if strings.TrimSpace(payload.Content) == "" && len(payload.AttachmentIds) == 0 {
+		return nil, models.ErrInvalidInput
+	}
+
+	nonce, replay, err := srv.reserveNonce(ctx, payload.UserId, payload.RoomId, payload.Nonce)
 	if err != nil {
 		return nil, fmt.Errorf("send message: %w", err)
 	}
-	if !exists {
-		return nil, models.ErrUnauthorized
+	if replay != nil {
+		return replay, nil
+	}
+
+	sent := false
+	defer func() {
+		if !sent {
+			srv.releaseNonce(ctx, payload.UserId, nonce)
+		}
+	}()
+
+	attachments, err := srv.claimAttachments(ctx, payload.UserId, payload.RoomId, payload.AttachmentIds)
+	if err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
+	}
+
+	members, mentions, err := srv.resolveMentions(ctx, payload.RoomId, payload.Content)
+	if err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
 	}
 
-	id, err := srv.messageStore.Create(ctx, payload.RoomId, payload.UserId, payload.Content)
+	id, err := srv.messageStore.Create(ctx, NewMessage{
+		RoomId:        payload.RoomId,
+		UserId:        payload.UserId,
+		Content:       payload.Content,
+		Mentions:      mentions,
+		AttachmentIds: attachmentIds(attachments),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create message: %w", err)
 	}
 
+	sent = true
+	srv.completeNonce(ctx, payload.UserId, nonce, id)
+
 	res, err := srv.messageStore.GetResponseById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("get response message id=%d: %w", id, err)
 	}
 
 	res.Nonce = payload.Nonce
+	res.Mentions = mentions
+	res.Attachments = responseAttachments(attachments)
 
 	srv.hub.Broadcast(payload.RoomId, &models.MessageCreatedEvent{
 		Data: models.MessageCreatedPayload{
@@ -81,28 +184,225 @@ func (srv *MessageService) HandleSendMessage(
 		},
 	})
 
+	srv.notifyMentioned(payload.RoomId, res, mentionRecipients(mentions, members, payload.UserId, srv.isOnline))
+
+	srv.notifyUnread(ctx, payload.RoomId, &models.MessagePreview{
+		Id:         res.Id,
+		Content:    res.Content,
+		SenderId:   res.SenderId,
+		SenderName: res.SenderName,
+		SentAt:     res.SentAt,
+	})
+
+	return res, nil
+}
+
+// notifyUnread pushes each member's new unread count in the room to their
+// own sockets, skipping the sender of the message that changed it.
+func (srv *MessageService) notifyUnread(ctx context.Context, roomId models.RoomId, last *models.MessagePreview) {
+	counts, err := srv.roomMemberStore.CountUnreadByRoomId(ctx, roomId)
+	if err != nil {
+		logger.Error("unread_count_failed", "room_id", roomId, "error", err)
+		return
+	}
+
+	for userId, count := range counts {
+		if userId == last.SenderId {
+			continue
+		}
+
+		srv.hub.BroadcastToUser(userId, &models.UnreadChangedEvent{
+			Data: models.UnreadChangedPayload{
+				RoomId:      roomId,
+				UnreadCount: count,
+				LastMessage: last,
+			},
+		})
+	}
+}
+
+// notifyReaderUnread tells a user their unread count after their read
+// marker moved, so their other tabs catch up.
+func (srv *MessageService) notifyReaderUnread(ctx context.Context, roomId models.RoomId, userId models.UserId) {
+	counts, err := srv.roomMemberStore.CountUnreadByRoomId(ctx, roomId)
+	if err != nil {
+		logger.Error("unread_count_failed", "room_id", roomId, "error", err)
+		return
+	}
+
+	srv.hub.BroadcastToUser(userId, &models.UnreadChangedEvent{
+		Data: models.UnreadChangedPayload{
+			RoomId:      roomId,
+			UnreadCount: counts[userId],
+		},
+	})
+}
+
+// HandleSendReply adds a reply to a message's thread. Threads are one level
+// deep, so replying to a reply lands in the same thread.
+func (srv *MessageService) HandleSendReply(
+	ctx context.Context,
+	payload SendReplyPayload,
+) (*models.ResponseMessage, error) {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, room.PermissionSendMessage); err != nil {
+		return nil, fmt.Errorf("send reply: %w", err)
+	}
+
+	parent, err := srv.messageStore.GetById(ctx, payload.ParentId)
+	if err != nil {
+		return nil, fmt.Errorf("get parent message id=%d: %w", payload.ParentId, err)
+	}
+
+	if parent.RoomId != payload.RoomId || parent.DeletedAt != nil {
+		return nil, models.ErrNotFound
+	}
+
+	threadId := parent.Id
+	if parent.ParentId != nil {
+		threadId = *parent.ParentId
+	}
+
+	if strings.TrimSpace(payload.Content) == "" && len(payload.AttachmentIds) == 0 {
+		return nil, models.ErrInvalidInput
+	}
+
+	nonce, replay, err := srv.reserveNonce(ctx, payload.UserId, payload.RoomId, payload.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("send reply: %w", err)
+	}
+	if replay != nil {
+		return replay, nil
+	}
+
+	sent := false
+	defer func() {
+		if !sent {
+			srv.releaseNonce(ctx, payload.UserId, nonce)
+		}
+	}()
+
+	attachments, err := srv.claimAttachments(ctx, payload.UserId, payload.RoomId, payload.AttachmentIds)
+	if err != nil {
+		return nil, fmt.Errorf("send reply: %w", err)
+	}
+
+	members, mentions, err := srv.resolveMentions(ctx, payload.RoomId, payload.Content)
+	if err != nil {
+		return nil, fmt.Errorf("send reply: %w", err)
+	}
+
+	id, err := srv.messageStore.Create(ctx, NewMessage{
+		RoomId:        payload.RoomId,
+		UserId:        payload.UserId,
+		ParentId:      &threadId,
+		Content:       payload.Content,
+		Mentions:      mentions,
+		AttachmentIds: attachmentIds(attachments),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create reply: %w", err)
+	}
+
+	sent = true
+	srv.completeNonce(ctx, payload.UserId, nonce, id)
+
+	res, err := srv.messageStore.GetResponseById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get response message id=%d: %w", id, err)
+	}
+
+	res.Nonce = payload.Nonce
+	res.Mentions = mentions
+	res.Attachments = responseAttachments(attachments)
+
+	thread, err := srv.messageStore.GetResponseById(ctx, threadId)
+	if err != nil {
+		return nil, fmt.Errorf("get thread message id=%d: %w", threadId, err)
+	}
+
+	srv.hub.Broadcast(payload.RoomId, &models.MessageCreatedEvent{
+		Data: models.MessageCreatedPayload{
+			Message:    res,
+			ThreadId:   &threadId,
+			ReplyCount: thread.ReplyCount,
+		},
+	})
+
+	srv.notifyMentioned(payload.RoomId, res, mentionRecipients(mentions, members, payload.UserId, srv.isOnline))
+
 	return res, nil
 }
 
+func (srv *MessageService) HandleGetReplies(ctx context.Context, payload GetRepliesPayload) (*GetMessagesResponse, error) {
+	exists, err := srv.ensureMember(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies: %w", err)
+	}
+
+	if !exists {
+		return &GetMessagesResponse{}, models.ErrUnauthorized
+	}
+
+	parent, err := srv.messageStore.GetById(ctx, payload.MessageId)
+	if err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get parent message id=%d: %w", payload.MessageId, err)
+	}
+
+	if parent.RoomId != payload.RoomId {
+		return &GetMessagesResponse{}, models.ErrNotFound
+	}
+
+	if payload.Page.Around != nil {
+		anchor, err := srv.messageStore.GetById(ctx, *payload.Page.Around)
+		if err != nil {
+			return &GetMessagesResponse{}, fmt.Errorf("get anchor reply id=%d: %w", *payload.Page.Around, err)
+		}
+
+		if anchor.ParentId == nil || *anchor.ParentId != payload.MessageId {
+			return &GetMessagesResponse{}, models.ErrNotFound
+		}
+	}
+
+	response, err := srv.messageStore.GetRepliesById(ctx, payload.MessageId, payload.Page)
+	if err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies by message_id=%d: %w", payload.MessageId, err)
+	}
+
+	if err := srv.attachReactions(ctx, payload.UserId, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies: %w", err)
+	}
+
+	if err := srv.attachMentions(ctx, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies: %w", err)
+	}
+
+	if err := srv.attachAttachments(ctx, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies: %w", err)
+	}
+
+	if err := srv.attachPins(ctx, payload.RoomId, response.Messages); err != nil {
+		return &GetMessagesResponse{}, fmt.Errorf("get replies: %w", err)
+	}
+
+	return response, nil
+}
+
 func (srv *MessageService) HandleEditMessage(
 	ctx context.Context,
 	payload EditMessagePayload,
 ) (*models.ResponseMessage, error) {
 	logger.GetLogger().Debug("HandleEditMessage called")
 
+	// Attachments stay as sent, so an edit always needs some text
+	if strings.TrimSpace(payload.Content) == "" {
+		return nil, models.ErrInvalidInput
+	}
+
 	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
 	if err != nil {
 		return nil, fmt.Errorf("get message id=%d: %w", payload.MessageId, err)
 	}
 
-	if msg.UserId != payload.UserId {
-		logger.GetLogger().Debug("user_not_matching",
-			"message_user", msg.UserId,
-			"payload_user", payload.UserId,
-		)
-		return nil, models.ErrUnauthorized
-	}
-
 	if msg.RoomId != payload.RoomId {
 		logger.GetLogger().Debug("room_not_matching",
 			"message_room", msg.RoomId,
@@ -111,7 +411,37 @@ func (srv *MessageService) HandleEditMessage(
 		return nil, models.ErrNotFound
 	}
 
-	err = srv.messageStore.UpdateContent(ctx, payload.MessageId, payload.Content)
+	if msg.DeletedAt != nil {
+		return nil, models.ErrNotFound
+	}
+
+	// Moderators may edit anyone's message in their room
+	if msg.UserId != payload.UserId {
+		moderator, err := srv.isModerator(ctx, msg.RoomId, payload.UserId)
+		if err != nil {
+			return nil, fmt.Errorf("edit message: %w", err)
+		}
+
+		if !moderator {
+			logger.GetLogger().Debug("user_not_matching",
+				"message_user", msg.UserId,
+				"payload_user", payload.UserId,
+			)
+			return nil, models.ErrForbidden
+		}
+	}
+
+	members, mentions, err := srv.resolveMentions(ctx, msg.RoomId, payload.Content)
+	if err != nil {
+		return nil, fmt.Errorf("edit message: %w", err)
+	}
+
+	previous, err := srv.mentionStore.GetByMessageIds(ctx, []models.MessageId{payload.MessageId})
+	if err != nil {
+		return nil, fmt.Errorf("get mentions of message id=%d: %w", payload.MessageId, err)
+	}
+
+	err = srv.messageStore.UpdateContent(ctx, payload.MessageId, payload.UserId, payload.Content, mentions)
 	if err != nil {
 		logger.GetLogger().Debug("room_not_matching",
 			"message_room", msg.RoomId,
@@ -125,12 +455,31 @@ func (srv *MessageService) HandleEditMessage(
 		return nil, fmt.Errorf("get response message id=%d: %w", payload.MessageId, err)
 	}
 
+	res.Mentions = mentions
+
+	messages := []models.ResponseMessage{*res}
+	if err := srv.attachAttachments(ctx, messages); err != nil {
+		return nil, fmt.Errorf("edit message: %w", err)
+	}
+	if err := srv.attachPins(ctx, payload.RoomId, messages); err != nil {
+		return nil, fmt.Errorf("edit message: %w", err)
+	}
+	res.Attachments = messages[0].Attachments
+	res.Pinned = messages[0].Pinned
+
 	srv.hub.Broadcast(payload.RoomId, &models.MessageUpdatedEvent{
 		Data: models.MessageUpdatedPayload{
 			Message: res,
 		},
 	})
 
+	// Only people the edit newly mentions hear about it
+	alreadyNotified := mentionRecipients(previous[payload.MessageId], members, msg.UserId, srv.isOnline)
+	recipients := slices.DeleteFunc(mentionRecipients(mentions, members, msg.UserId, srv.isOnline), func(userId models.UserId) bool {
+		return slices.Contains(alreadyNotified, userId)
+	})
+	srv.notifyMentioned(payload.RoomId, res, recipients)
+
 	return res, nil
 }
 
@@ -143,15 +492,23 @@ func (srv *MessageService) HandleDeleteMessage(
 		return fmt.Errorf("get message id=%d: %w", payload.MessageId, err)
 	}
 
-	if msg.UserId != payload.UserId {
-		return models.ErrUnauthorized
+	if msg.RoomId != payload.RoomId || msg.DeletedAt != nil {
+		return models.ErrNotFound
 	}
 
-	if msg.RoomId != payload.RoomId {
-		return models.ErrNotFound
+	// Moderators may delete anyone's message in their room
+	if msg.UserId != payload.UserId {
+		moderator, err := srv.isModerator(ctx, msg.RoomId, payload.UserId)
+		if err != nil {
+			return fmt.Errorf("delete message: %w", err)
+		}
+
+		if !moderator {
+			return models.ErrForbidden
+		}
 	}
 
-	err = srv.messageStore.DeleteById(ctx, payload.MessageId)
+	err = srv.messageStore.DeleteById(ctx, payload.MessageId, payload.UserId)
 	if err != nil {
 		return fmt.Errorf("delete message id=%d: %w", payload.MessageId, err)
 	}
@@ -160,23 +517,168 @@ func (srv *MessageService) HandleDeleteMessage(
 		Data: models.MessageDeletedPayload{
 			MessageID: payload.MessageId,
 			RoomID:    payload.RoomId,
+			DeletedBy: payload.UserId,
 		},
 	})
 
+	// A tombstone has nothing left to pin
+	unpinned, err := srv.pinStore.Unpin(ctx, payload.RoomId, payload.MessageId)
+	if err != nil {
+		logger.Error("unpin_deleted_failed", "message_id", payload.MessageId, "error", err)
+	} else if unpinned {
+		srv.hub.Broadcast(payload.RoomId, &models.MessageUnpinnedEvent{
+			Data: models.MessageUnpinnedPayload{
+				RoomId:    payload.RoomId,
+				MessageId: payload.MessageId,
+			},
+		})
+	}
+
+	return nil
+}
+
+// HandleSearchMessages searches the messages of every room the user is a
+// member of, or of one room when the payload names it.
+func (srv *MessageService) HandleSearchMessages(ctx context.Context, payload SearchMessagesPayload) (*SearchMessagesResponse, error) {
+	payload.Query = strings.TrimSpace(payload.Query)
+	if payload.Query == "" || len(payload.Query) > 200 {
+		return nil, models.ErrInvalidInput
+	}
+
+	if payload.RoomId != nil {
+		exists, err := srv.ensureMember(ctx, *payload.RoomId, payload.UserId)
+		if err != nil {
+			return nil, fmt.Errorf("search messages: %w", err)
+		}
+
+		if !exists {
+			return nil, models.ErrUnauthorized
+		}
+	}
+
+	res, err := srv.messageStore.SearchMessages(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("search messages for user_id=%d: %w", payload.UserId, err)
+	}
+
+	return res, nil
+}
+
+// HandleGetHistory lists the earlier versions of a message, oldest first.
+// Senders see the history of their own messages; moderators see any,
+// including the history of deleted messages.
+func (srv *MessageService) HandleGetHistory(ctx context.Context, payload GetHistoryPayload) (*GetHistoryResponse, error) {
+	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
+	if err != nil {
+		return nil, fmt.Errorf("get message for history id=%d: %w", payload.MessageId, err)
+	}
+
+	if msg.RoomId != payload.RoomId {
+		return nil, models.ErrNotFound
+	}
+
+	moderator, err := srv.isModerator(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+
+	if !moderator && (msg.UserId != payload.UserId || msg.DeletedAt != nil) {
+		return nil, models.ErrForbidden
+	}
+
+	revisions, err := srv.messageStore.GetRevisionsById(ctx, payload.MessageId)
+	if err != nil {
+		return nil, fmt.Errorf("get revisions of message id=%d: %w", payload.MessageId, err)
+	}
+
+	return &GetHistoryResponse{MessageId: payload.MessageId, Revisions: revisions}, nil
+}
+
+// isModerator reports whether the user's role in the room lets them
+// moderate others' messages. Someone who is not a member cannot.
+func (srv *MessageService) isModerator(ctx context.Context, roomId models.RoomId, userId models.UserId) (bool, error) {
+	role, err := srv.permissions.Role(ctx, roomId, userId)
+	if errors.Is(err, models.ErrUnauthorized) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return room.Can(role, room.PermissionModerateMessages), nil
+}
+
+// HandlePurgeDeleted hard-deletes tombstones older than the retention
+// period. Tombstones under a thread with live replies are kept.
+func (srv *MessageService) HandlePurgeDeleted(ctx context.Context, retention time.Duration) error {
+	purged, err := srv.messageStore.PurgeDeleted(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("purge deleted messages: %w", err)
+	}
+
+	if purged > 0 {
+		logger.Info("deleted_messages_purged", "count", purged)
+	}
+
+	return nil
+}
+
+// HandlePurgeAttachments removes attachments older than maxAge that belong
+// to no message, either because they were never sent or because their
+// message was purged, along with their blobs.
+func (srv *MessageService) HandlePurgeAttachments(ctx context.Context, maxAge time.Duration) error {
+	orphans, err := srv.attachmentStore.DeleteOrphans(ctx, time.Now().Add(-maxAge))
+	if err != nil {
+		return fmt.Errorf("purge attachments: %w", err)
+	}
+
+	for _, attachment := range orphans {
+		srv.deleteBlobs(ctx, attachment.StorageKey, attachment.ThumbnailKey)
+	}
+
+	if len(orphans) > 0 {
+		logger.Info("orphaned_attachments_purged", "count", len(orphans))
+	}
+
 	return nil
 }
 
+// HandleGetRoomAttachments lists every attachment of a room, so their blobs
+// can be removed once the room is deleted.
+func (srv *MessageService) HandleGetRoomAttachments(ctx context.Context, roomId models.RoomId) ([]models.Attachment, error) {
+	attachments, err := srv.attachmentStore.GetByRoomId(ctx, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("get room attachments room=%d: %w", roomId, err)
+	}
+
+	return attachments, nil
+}
+
+// HandleDeleteAttachmentBlobs removes the blobs of attachments whose rows
+// are already gone. Failures are logged and skipped.
+func (srv *MessageService) HandleDeleteAttachmentBlobs(ctx context.Context, attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		srv.deleteBlobs(ctx, attachment.StorageKey, attachment.ThumbnailKey)
+	}
+}
+
+// HandleMarkAsRead moves the user's read marker in the room up to the given
+// message and lets the other members know. Older messages and thread
+// replies are ignored.
 func (srv *MessageService) HandleMarkAsRead(
 	ctx context.Context,
-	messageId models.MessageId,
-	userId models.UserId,
+	payload MarkAsReadPayload,
 ) error {
-	msg, err := srv.messageStore.GetById(ctx, messageId)
+	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
 	if err != nil {
-		return fmt.Errorf("get message for read receipt id=%d: %w", messageId, err)
+		return fmt.Errorf("get message for read receipt id=%d: %w", payload.MessageId, err)
+	}
+
+	if msg.RoomId != payload.RoomId {
+		return models.ErrNotFound
 	}
 
-	exists, err := srv.ensureMember(ctx, msg.RoomId, userId)
+	exists, err := srv.ensureMember(ctx, msg.RoomId, payload.UserId)
 	if err != nil {
 		return fmt.Errorf("check membership for read receipt: %w", err)
 	}
@@ -184,19 +686,758 @@ func (srv *MessageService) HandleMarkAsRead(
 		return models.ErrUnauthorized
 	}
 
-	if err := srv.roomMemberStore.UpdateLastMessageRead(ctx, msg.RoomId, userId, messageId); err != nil {
+	// The read marker follows the main timeline, which replies are not on
+	if msg.ParentId != nil {
+		return nil
+	}
+
+	moved, err := srv.roomMemberStore.UpdateLastMessageRead(ctx, msg.RoomId, payload.UserId, payload.MessageId)
+	if err != nil {
 		return fmt.Errorf("update last message read: %w", err)
 	}
 
+	if !moved {
+		return nil
+	}
+
+	srv.hub.Broadcast(msg.RoomId, &models.ReadReceiptUpdatedEvent{
+		Data: models.ReadReceiptUpdatedPayload{
+			RoomId:            msg.RoomId,
+			UserId:            payload.UserId,
+			LastReadMessageId: payload.MessageId,
+		},
+	})
+
+	srv.notifyReaderUnread(ctx, msg.RoomId, payload.UserId)
+
 	return nil
 }
 
-func (srv *MessageService) HandleMarkAsDelivered(
+// HandleAckMessage records that a member's client has rendered a message and
+// tells the sender, flagging the message delivered once every member has.
+func (srv *MessageService) HandleAckMessage(
 	ctx context.Context,
-	messageId models.MessageId,
+	payload AckMessagePayload,
 ) error {
-	if err := srv.messageStore.MarkAsDelivered(ctx, messageId); err != nil {
-		return fmt.Errorf("mark message as delivered id=%d: %w", messageId, err)
+	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
+	if err != nil {
+		return fmt.Errorf("get message for ack id=%d: %w", payload.MessageId, err)
+	}
+
+	if msg.RoomId != payload.RoomId {
+		return models.ErrNotFound
+	}
+
+	// Senders see their own messages straight away, there is nothing to ack
+	if msg.UserId == payload.UserId {
+		return nil
+	}
+
+	exists, err := srv.ensureMember(ctx, msg.RoomId, payload.UserId)
+	if err != nil {
+		return fmt.Errorf("check membership for ack: %w", err)
+	}
+	if !exists {
+		return models.ErrUnauthorized
+	}
+
+	recorded, err := srv.messageStore.MarkDeliveredTo(ctx, payload.MessageId, payload.UserId)
+	if err != nil {
+		return fmt.Errorf("mark message delivered: %w", err)
+	}
+
+	// Repeated acks, e.g. after a reconnect, are not news to the sender
+	if !recorded {
+		return nil
+	}
+
+	pending, err := srv.messageStore.CountUndelivered(ctx, payload.MessageId)
+	if err != nil {
+		return fmt.Errorf("count undelivered: %w", err)
+	}
+
+	if pending == 0 {
+		if err := srv.messageStore.MarkAsDelivered(ctx, payload.MessageId); err != nil {
+			return fmt.Errorf("mark message as delivered id=%d: %w", payload.MessageId, err)
+		}
+	}
+
+	srv.hub.BroadcastToUser(msg.UserId, &models.MessageDeliveredEvent{
+		Data: models.MessageDeliveredPayload{
+			MessageId:    payload.MessageId,
+			RoomId:       msg.RoomId,
+			UserId:       payload.UserId,
+			DeliveredAt:  time.Now(),
+			AllDelivered: pending == 0,
+		},
+	})
+
+	return nil
+}
+
+// attachReactions fills in the reaction counts on a page of messages as the
+// given user sees them.
+func (srv *MessageService) attachReactions(ctx context.Context, userId models.UserId, messages []models.ResponseMessage) error {
+	ids := make([]models.MessageId, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.Id
+	}
+
+	reactions, err := srv.reactionStore.GetByMessageIds(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("get reactions: %w", err)
+	}
+
+	for i := range messages {
+		if messages[i].DeletedAt != nil {
+			continue
+		}
+
+		summaries := []models.ReactionSummary{}
+		for _, reaction := range reactions[messages[i].Id] {
+			summaries = append(summaries, models.ReactionSummary{
+				Emoji:       reaction.Emoji,
+				Count:       len(reaction.UserIds),
+				ReactedByMe: slices.Contains(reaction.UserIds, userId),
+			})
+		}
+		messages[i].Reactions = summaries
+	}
+
+	return nil
+}
+
+// attachMentions fills in the stored mentions on a page of messages.
+func (srv *MessageService) attachMentions(ctx context.Context, messages []models.ResponseMessage) error {
+	ids := make([]models.MessageId, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.Id
+	}
+
+	mentions, err := srv.mentionStore.GetByMessageIds(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("get mentions: %w", err)
+	}
+
+	for i := range messages {
+		if messages[i].DeletedAt != nil {
+			continue
+		}
+
+		if found, ok := mentions[messages[i].Id]; ok {
+			messages[i].Mentions = found
+		}
+	}
+
+	return nil
+}
+
+// resolveMentions parses the @tokens in content against the room's members,
+// returning the members too so the caller can work out who to notify.
+func (srv *MessageService) resolveMentions(ctx context.Context, roomId models.RoomId, content string) ([]*models.User, []models.Mention, error) {
+	tokens := parseMentions(content)
+	if len(tokens) > maxMentions {
+		return nil, nil, fmt.Errorf("%d mentions: %w", len(tokens), models.ErrInvalidInput)
+	}
+
+	if len(tokens) == 0 {
+		return nil, []models.Mention{}, nil
+	}
+
+	members, err := srv.roomMemberStore.GetRoomMembers(ctx, roomId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get members of room_id=%d for mentions: %w", roomId, err)
+	}
+
+	return members, resolveMentions(tokens, members), nil
+}
+
+func (srv *MessageService) isOnline(userId models.UserId) bool {
+	if srv.presence == nil {
+		return true
+	}
+
+	return srv.presence.IsOnline(userId)
+}
+
+// notifyMentioned sends the message to each mentioned user's own sockets, so
+// they hear about it from whichever room they have open.
+func (srv *MessageService) notifyMentioned(roomId models.RoomId, msg *models.ResponseMessage, recipients []models.UserId) {
+	for _, userId := range recipients {
+		srv.hub.BroadcastToUser(userId, &models.MentionedEvent{
+			Data: models.MentionedPayload{
+				RoomId:  roomId,
+				Message: msg,
+			},
+		})
+	}
+}
+
+// HandleReact adds the user's emoji to a message, telling the room only when
+// it was not already there.
+func (srv *MessageService) HandleReact(ctx context.Context, payload ReactionPayload) error {
+	return srv.updateReaction(ctx, payload, true)
+}
+
+// HandleUnreact takes the user's emoji off a message.
+func (srv *MessageService) HandleUnreact(ctx context.Context, payload ReactionPayload) error {
+	return srv.updateReaction(ctx, payload, false)
+}
+
+func (srv *MessageService) updateReaction(ctx context.Context, payload ReactionPayload, add bool) error {
+	if !ValidEmoji(payload.Emoji) {
+		return models.ErrInvalidInput
+	}
+
+	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
+	if err != nil {
+		return fmt.Errorf("get message for reaction id=%d: %w", payload.MessageId, err)
+	}
+
+	if msg.RoomId != payload.RoomId || msg.DeletedAt != nil {
+		return models.ErrNotFound
+	}
+
+	exists, err := srv.ensureMember(ctx, msg.RoomId, payload.UserId)
+	if err != nil {
+		return fmt.Errorf("check membership for reaction: %w", err)
+	}
+	if !exists {
+		return models.ErrUnauthorized
+	}
+
+	var changed bool
+	if add {
+		changed, err = srv.reactionStore.Add(ctx, payload.MessageId, payload.UserId, payload.Emoji)
+	} else {
+		changed, err = srv.reactionStore.Remove(ctx, payload.MessageId, payload.UserId, payload.Emoji)
+	}
+	if err != nil {
+		return fmt.Errorf("update reaction: %w", err)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	count, err := srv.reactionStore.CountByEmoji(ctx, payload.MessageId, payload.Emoji)
+	if err != nil {
+		return fmt.Errorf("count reactions: %w", err)
+	}
+
+	srv.hub.Broadcast(msg.RoomId, &models.ReactionUpdatedEvent{
+		Data: models.ReactionUpdatedPayload{
+			MessageId: payload.MessageId,
+			RoomId:    msg.RoomId,
+			UserId:    payload.UserId,
+			Emoji:     payload.Emoji,
+			Count:     count,
+			Added:     add,
+		},
+	})
+
+	return nil
+}
+
+// ValidEmoji keeps reactions to a single short token; the client decides
+// what counts as an emoji.
+func ValidEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > 32 || !utf8.ValidString(emoji) {
+		return false
+	}
+
+	return !strings.ContainsFunc(emoji, unicode.IsSpace)
+}
+
+// HandleUploadAttachment stores a file uploaded to a room, ready to be sent
+// with a message. Its type is sniffed from the content, and images get a
+// thumbnail.
+func (srv *MessageService) HandleUploadAttachment(ctx context.Context, payload UploadAttachmentPayload) (*models.ResponseAttachment, error) {
+	exists, err := srv.ensureMember(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("upload attachment: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrUnauthorized
+	}
+
+	if payload.Size <= 0 || payload.Size > MaxAttachmentSize {
+		return nil, fmt.Errorf("attachment of %d bytes: %w", payload.Size, models.ErrInvalidInput)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(payload.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("reading upload: %w", err)
+	}
+	head = head[:n]
+
+	contentType, ok := detectAttachmentType(head)
+	if !ok {
+		return nil, fmt.Errorf("attachment type %q: %w", http.DetectContentType(head), models.ErrInvalidInput)
+	}
+
+	attachment := &models.Attachment{
+		RoomId:      payload.RoomId,
+		UploadedBy:  payload.UserId,
+		FileName:    cleanFileName(payload.FileName),
+		ContentType: contentType,
+		Size:        payload.Size,
+		StorageKey:  fmt.Sprintf("rooms/%d/%s", payload.RoomId, uuid.NewString()),
+	}
+
+	body := io.MultiReader(bytes.NewReader(head), payload.Body)
+
+	var thumbnail []byte
+	if attachmentTypes[contentType] {
+		// Images are small enough to hold while the thumbnail is made
+		data, err := io.ReadAll(io.LimitReader(body, payload.Size))
+		if err != nil {
+			return nil, fmt.Errorf("reading upload: %w", err)
+		}
+		body = bytes.NewReader(data)
+
+		thumb, width, height, err := makeThumbnail(data)
+		if err != nil {
+			logger.Warn("thumbnail_failed", "room_id", payload.RoomId, "error", err)
+		} else {
+			thumbnail = thumb
+			attachment.Width = &width
+			attachment.Height = &height
+		}
+	}
+
+	if err := srv.blobs.Put(ctx, attachment.StorageKey, body, payload.Size, contentType); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+
+	if thumbnail != nil {
+		thumbnailKey := attachment.StorageKey + "-thumb"
+		if err := srv.blobs.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			logger.Warn("thumbnail_store_failed", "room_id", payload.RoomId, "error", err)
+		} else {
+			attachment.ThumbnailKey = &thumbnailKey
+		}
+	}
+
+	id, err := srv.attachmentStore.Create(ctx, attachment)
+	if err != nil {
+		srv.deleteBlobs(ctx, attachment.StorageKey, attachment.ThumbnailKey)
+		return nil, fmt.Errorf("create attachment: %w", err)
+	}
+	attachment.Id = id
+
+	return &responseAttachments([]models.Attachment{*attachment})[0], nil
+}
+
+// HandleGetAttachment opens an attachment, or its thumbnail, for a member
+// of its room. Attachments not yet sent are only visible to the uploader,
+// and those on deleted messages to nobody.
+func (srv *MessageService) HandleGetAttachment(ctx context.Context, payload GetAttachmentPayload) (*AttachmentContent, error) {
+	attachment, err := srv.attachmentStore.GetById(ctx, payload.AttachmentId)
+	if err != nil {
+		return nil, fmt.Errorf("get attachment id=%d: %w", payload.AttachmentId, err)
+	}
+
+	exists, err := srv.ensureMember(ctx, attachment.RoomId, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrUnauthorized
+	}
+
+	if attachment.MessageId == nil {
+		if attachment.UploadedBy != payload.UserId {
+			return nil, models.ErrNotFound
+		}
+	} else {
+		msg, err := srv.messageStore.GetById(ctx, *attachment.MessageId)
+		if err != nil {
+			return nil, fmt.Errorf("get message of attachment id=%d: %w", attachment.Id, err)
+		}
+
+		if msg.DeletedAt != nil {
+			return nil, models.ErrNotFound
+		}
+	}
+
+	content := &AttachmentContent{
+		Attachment:  attachment,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+	}
+
+	key := attachment.StorageKey
+	if payload.Thumbnail {
+		if attachment.ThumbnailKey == nil {
+			return nil, models.ErrNotFound
+		}
+
+		key = *attachment.ThumbnailKey
+		content.ContentType = "image/jpeg"
+		content.Size = 0
+	}
+
+	content.Body, err = srv.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("open attachment id=%d: %w", attachment.Id, err)
+	}
+
+	return content, nil
+}
+
+// claimAttachments checks that the user uploaded the given attachments to
+// the room and has not sent them yet, before a message is created with
+// them.
+func (srv *MessageService) claimAttachments(ctx context.Context, userId models.UserId, roomId models.RoomId, ids []models.AttachmentId) ([]models.Attachment, error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	if len(ids) > maxAttachments {
+		return nil, fmt.Errorf("%d attachments: %w", len(ids), models.ErrInvalidInput)
+	}
+
+	attachments, err := srv.attachmentStore.GetByIds(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get attachments: %w", err)
+	}
+
+	if len(attachments) != len(ids) {
+		return nil, fmt.Errorf("unknown attachment: %w", models.ErrInvalidInput)
+	}
+
+	for _, attachment := range attachments {
+		if attachment.UploadedBy != userId || attachment.RoomId != roomId || attachment.MessageId != nil {
+			return nil, fmt.Errorf("attachment id=%d not available: %w", attachment.Id, models.ErrInvalidInput)
+		}
+	}
+
+	return attachments, nil
+}
+
+// attachmentIds lists the ids of claimed attachments, to link on send.
+func attachmentIds(attachments []models.Attachment) []models.AttachmentId {
+	ids := make([]models.AttachmentId, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.Id
+	}
+
+	return ids
+}
+
+// attachAttachments fills in the files on a page of messages.
+func (srv *MessageService) attachAttachments(ctx context.Context, messages []models.ResponseMessage) error {
+	ids := make([]models.MessageId, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.Id
+	}
+
+	attachments, err := srv.attachmentStore.GetByMessageIds(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("get attachments: %w", err)
+	}
+
+	for i := range messages {
+		if messages[i].DeletedAt != nil {
+			continue
+		}
+
+		if found, ok := attachments[messages[i].Id]; ok {
+			messages[i].Attachments = responseAttachments(found)
+		}
+	}
+
+	return nil
+}
+
+// deleteBlobs removes an attachment's stored files, logging failures since
+// the rows pointing at them are already gone.
+func (srv *MessageService) deleteBlobs(ctx context.Context, storageKey string, thumbnailKey *string) {
+	keys := []string{storageKey}
+	if thumbnailKey != nil {
+		keys = append(keys, *thumbnailKey)
+	}
+
+	for _, key := range keys {
+		if err := srv.blobs.Delete(ctx, key); err != nil {
+			logger.Error("attachment_blob_delete_failed", "key", key, "error", err)
+		}
+	}
+}
+
+// maxPins caps how many messages a room can have pinned
+const maxPins = 50
+
+// HandlePin pins a message in its room for everyone to see. Only
+// moderators pin, and a room holds at most maxPins pins. Pinning a message
+// twice changes nothing.
+func (srv *MessageService) HandlePin(ctx context.Context, payload PinPayload) (*PinnedMessage, error) {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, room.PermissionModerateMessages); err != nil {
+		return nil, fmt.Errorf("pin message: %w", err)
+	}
+
+	msg, err := srv.messageStore.GetById(ctx, payload.MessageId)
+	if err != nil {
+		return nil, fmt.Errorf("get message to pin id=%d: %w", payload.MessageId, err)
+	}
+
+	if msg.RoomId != payload.RoomId || msg.DeletedAt != nil {
+		return nil, models.ErrNotFound
+	}
+
+	pinned, err := srv.pinStore.Pin(ctx, payload.RoomId, payload.MessageId, payload.UserId, maxPins)
+	if err != nil {
+		return nil, fmt.Errorf("pin message id=%d: %w", payload.MessageId, err)
+	}
+
+	pins, err := srv.getPins(ctx, payload.UserId, payload.RoomId)
+	if err != nil {
+		return nil, fmt.Errorf("pin message: %w", err)
+	}
+
+	idx := slices.IndexFunc(pins, func(pin PinnedMessage) bool {
+		return pin.Message.Id == payload.MessageId
+	})
+	if idx < 0 {
+		return nil, models.ErrNotFound
+	}
+
+	if pinned {
+		srv.hub.Broadcast(payload.RoomId, &models.MessagePinnedEvent{
+			Data: models.MessagePinnedPayload{
+				RoomId:   payload.RoomId,
+				Message:  &pins[idx].Message,
+				PinnedBy: payload.UserId,
+				PinnedAt: pins[idx].PinnedAt,
+			},
+		})
+	}
+
+	return &pins[idx], nil
+}
+
+func (srv *MessageService) HandleUnpin(ctx context.Context, payload PinPayload) error {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, room.PermissionModerateMessages); err != nil {
+		return fmt.Errorf("unpin message: %w", err)
+	}
+
+	unpinned, err := srv.pinStore.Unpin(ctx, payload.RoomId, payload.MessageId)
+	if err != nil {
+		return fmt.Errorf("unpin message id=%d: %w", payload.MessageId, err)
+	}
+
+	if !unpinned {
+		return models.ErrNotFound
+	}
+
+	srv.hub.Broadcast(payload.RoomId, &models.MessageUnpinnedEvent{
+		Data: models.MessageUnpinnedPayload{
+			RoomId:     payload.RoomId,
+			MessageId:  payload.MessageId,
+			UnpinnedBy: &payload.UserId,
+		},
+	})
+
+	return nil
+}
+
+func (srv *MessageService) HandleGetPins(ctx context.Context, payload GetPinsPayload) (*GetPinsResponse, error) {
+	exists, err := srv.ensureMember(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("get pins: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrUnauthorized
+	}
+
+	pins, err := srv.getPins(ctx, payload.UserId, payload.RoomId)
+	if err != nil {
+		return nil, fmt.Errorf("get pins: %w", err)
+	}
+
+	return &GetPinsResponse{Pins: pins}, nil
+}
+
+// getPins loads the room's pinned messages as the given user sees them.
+func (srv *MessageService) getPins(ctx context.Context, userId models.UserId, roomId models.RoomId) ([]PinnedMessage, error) {
+	pins, err := srv.pinStore.GetByRoomId(ctx, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("get pins of room_id=%d: %w", roomId, err)
+	}
+
+	messages := make([]models.ResponseMessage, 0, len(pins))
+	for _, pin := range pins {
+		msg, err := srv.messageStore.GetResponseById(ctx, pin.MessageId)
+		if err != nil {
+			return nil, fmt.Errorf("get pinned message id=%d: %w", pin.MessageId, err)
+		}
+
+		msg.Pinned = true
+		messages = append(messages, *msg)
+	}
+
+	if err := srv.attachReactions(ctx, userId, messages); err != nil {
+		return nil, err
+	}
+	if err := srv.attachMentions(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := srv.attachAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+
+	res := make([]PinnedMessage, len(pins))
+	for i, pin := range pins {
+		res[i] = PinnedMessage{
+			Message:  messages[i],
+			PinnedBy: pin.PinnedBy,
+			PinnedAt: pin.PinnedAt,
+		}
+	}
+
+	return res, nil
+}
+
+// attachPins flags the pinned messages on a page of the room's messages.
+func (srv *MessageService) attachPins(ctx context.Context, roomId models.RoomId, messages []models.ResponseMessage) error {
+	pins, err := srv.pinStore.GetByRoomId(ctx, roomId)
+	if err != nil {
+		return fmt.Errorf("get pins: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].Pinned = slices.ContainsFunc(pins, func(pin models.Pin) bool {
+			return pin.MessageId == messages[i].Id
+		})
+	}
+
+	return nil
+}
+
+const (
+	// nonceWindow is how long a nonce keeps a retried send from creating a
+	// second message
+	nonceWindow = 24 * time.Hour
+	// nonceInFlight is how long a send may hold its nonce before a retry
+	// is let through, in case the first send died midway
+	nonceInFlight  = time.Minute
+	maxNonceLength = 128
+)
+
+// reserveNonce claims the nonce a message is being sent with, returning it
+// for completeNonce. When the nonce was already used it returns the message
+// sent with it instead, and the send should stop there.
+func (srv *MessageService) reserveNonce(ctx context.Context, userId models.UserId, roomId models.RoomId, nonce *string) (string, *models.ResponseMessage, error) {
+	if nonce == nil || *nonce == "" {
+		return "", nil, nil
+	}
+
+	if len(*nonce) > maxNonceLength {
+		return "", nil, fmt.Errorf("nonce of %d bytes: %w", len(*nonce), models.ErrInvalidInput)
+	}
+
+	now := time.Now()
+	reserved, messageId, err := srv.messageStore.ReserveNonce(ctx, userId, *nonce, now.Add(-nonceWindow), now.Add(-nonceInFlight))
+	if err != nil {
+		return "", nil, fmt.Errorf("reserve nonce: %w", err)
+	}
+
+	if reserved {
+		return *nonce, nil, nil
+	}
+
+	// The first send with this nonce has not finished yet
+	if messageId == nil {
+		return "", nil, fmt.Errorf("nonce still in flight: %w", models.ErrConflict)
+	}
+
+	res, err := srv.replayMessage(ctx, userId, roomId, *messageId, *nonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "", res, nil
+}
+
+// replayMessage answers a repeated send with the message the first one
+// created. The room already has it, so only the sender's sockets hear of
+// it again, in case the first event never reached them.
+func (srv *MessageService) replayMessage(ctx context.Context, userId models.UserId, roomId models.RoomId, messageId models.MessageId, nonce string) (*models.ResponseMessage, error) {
+	res, err := srv.messageStore.GetResponseById(ctx, messageId)
+	if err != nil {
+		return nil, fmt.Errorf("get replayed message id=%d: %w", messageId, err)
+	}
+
+	if res.RoomId != roomId {
+		return nil, fmt.Errorf("nonce used in room_id=%d: %w", res.RoomId, models.ErrConflict)
+	}
+
+	messages := []models.ResponseMessage{*res}
+	if err := srv.attachReactions(ctx, userId, messages); err != nil {
+		return nil, err
+	}
+	if err := srv.attachMentions(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := srv.attachAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := srv.attachPins(ctx, roomId, messages); err != nil {
+		return nil, err
+	}
+
+	res = &messages[0]
+	res.Nonce = &nonce
+
+	event := models.MessageCreatedPayload{Message: res}
+	if res.ParentId != nil {
+		thread, err := srv.messageStore.GetResponseById(ctx, *res.ParentId)
+		if err != nil {
+			return nil, fmt.Errorf("get thread message id=%d: %w", *res.ParentId, err)
+		}
+
+		event.ThreadId = res.ParentId
+		event.ReplyCount = thread.ReplyCount
+	}
+
+	srv.hub.BroadcastToUser(userId, &models.MessageCreatedEvent{Data: event})
+
+	return res, nil
+}
+
+// completeNonce ties a reserved nonce to the message sent with it. A
+// failure leaves the nonce reserved, so retries are refused rather than
+// duplicated until the window passes.
+func (srv *MessageService) completeNonce(ctx context.Context, userId models.UserId, nonce string, messageId models.MessageId) {
+	if nonce == "" {
+		return
+	}
+
+	// The message exists even if the client has gone, so record it anyway
+	if err := srv.messageStore.CompleteNonce(context.WithoutCancel(ctx), userId, nonce, messageId); err != nil {
+		logger.Error("nonce_complete_failed", "message_id", messageId, "error", err)
+	}
+}
+
+// releaseNonce frees the nonce of a send that failed so it can be retried.
+func (srv *MessageService) releaseNonce(ctx context.Context, userId models.UserId, nonce string) {
+	if nonce == "" {
+		return
+	}
+
+	if err := srv.messageStore.ReleaseNonce(context.WithoutCancel(ctx), userId, nonce); err != nil {
+		logger.Error("nonce_release_failed", "user_id", userId, "error", err)
+	}
+}
+
+// HandlePurgeNonces forgets nonces older than the window they guard.
+func (srv *MessageService) HandlePurgeNonces(ctx context.Context) error {
+	purged, err := srv.messageStore.PurgeNonces(ctx, time.Now().Add(-nonceWindow))
+	if err != nil {
+		return fmt.Errorf("purge nonces: %w", err)
+	}
+
+	if purged > 0 {
+		logger.Info("message_nonces_purged", "count", purged)
 	}
 
 	return nil
@@ -0,0 +1,167 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteAttachmentRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteAttachmentRepo(ctx context.Context, db *sql.DB) (*SQLiteAttachmentRepo, error) {
+	store := SQLiteAttachmentRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing message_attachments table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLiteAttachmentRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS message_attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		uploaded_by INTEGER NOT NULL,
+		message_id INTEGER DEFAULT NULL,
+		file_name TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		storage_key TEXT NOT NULL UNIQUE,
+		thumbnail_key TEXT DEFAULT NULL,
+		width INTEGER DEFAULT NULL,
+		height INTEGER DEFAULT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+		FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE SET NULL
+	);`
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating message_attachments table: %w", err)
+	}
+
+	createIndexSQL := `CREATE INDEX IF NOT EXISTS idx_message_attachments_message_id
+	ON message_attachments(message_id, id);`
+
+	if _, err := s.db.ExecContext(ctx, createIndexSQL); err != nil {
+		return fmt.Errorf("creating message_attachments index: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteAttachmentRepo) Create(ctx context.Context, attachment *models.Attachment) (models.AttachmentId, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_attachments(room_id, uploaded_by, file_name, content_type, size,
+			storage_key, thumbnail_key, width, height)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.RoomId, attachment.UploadedBy, attachment.FileName, attachment.ContentType, attachment.Size,
+		attachment.StorageKey, attachment.ThumbnailKey, attachment.Width, attachment.Height)
+	if err != nil {
+		return 0, fmt.Errorf("inserting attachment in room %d: %w", attachment.RoomId, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("getting attachment id: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteAttachmentRepo) GetById(ctx context.Context, id models.AttachmentId) (*models.Attachment, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE id = ?", id)
+
+	attachment, err := scanAttachment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting attachment %d: %w", id, err)
+	}
+
+	return attachment, nil
+}
+
+func (s *SQLiteAttachmentRepo) GetByIds(ctx context.Context, ids []models.AttachmentId) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return []models.Attachment{}, nil
+	}
+
+	placeholders, args := sqliteInList(ids)
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE id IN ("+placeholders+") ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+func (s *SQLiteAttachmentRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Attachment, error) {
+	if len(messageIds) == 0 {
+		return make(map[models.MessageId][]models.Attachment), nil
+	}
+
+	placeholders, args := sqliteInList(messageIds)
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE message_id IN ("+placeholders+") ORDER BY message_id, id",
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupAttachments(attachments), nil
+}
+
+func (s *SQLiteAttachmentRepo) DeleteOrphans(ctx context.Context, before time.Time) ([]models.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"DELETE FROM message_attachments WHERE message_id IS NULL AND created_at < ? RETURNING "+attachmentColumns,
+		before.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, fmt.Errorf("deleting orphaned attachments before %s: %w", before, err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+func (s *SQLiteAttachmentRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM message_attachments WHERE room_id = ? ORDER BY id", roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachments for room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+// sqliteInList builds the placeholders and arguments for an IN (...) list.
+func sqliteInList(ids []int64) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
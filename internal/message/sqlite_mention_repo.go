@@ -0,0 +1,74 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteMentionRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteMentionRepo(ctx context.Context, db *sql.DB) (*SQLiteMentionRepo, error) {
+	store := SQLiteMentionRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing message_mentions table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLiteMentionRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS message_mentions (
+		message_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		user_id INTEGER DEFAULT NULL,
+		start_offset INTEGER NOT NULL,
+		end_offset INTEGER NOT NULL,
+		PRIMARY KEY (message_id, start_offset),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	createUserIdIndexSQL := `CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions(user_id)`
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating message_mentions table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createUserIdIndexSQL); err != nil {
+		return fmt.Errorf("creating message_mentions user_id index: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteMentionRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Mention, error) {
+	mentions := make(map[models.MessageId][]models.Mention)
+	if len(messageIds) == 0 {
+		return mentions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messageIds)), ", ")
+	args := make([]any, len(messageIds))
+	for i, id := range messageIds {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT message_id, kind, user_id, start_offset, end_offset
+	FROM message_mentions
+	WHERE message_id IN (`+placeholders+`)
+	ORDER BY message_id, start_offset`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying mentions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMentions(rows, mentions)
+}
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/utils"
 	_ "modernc.org/sqlite"
 )
 
@@ -32,9 +35,15 @@ func (s *SQLiteMessageRepo) init(ctx context.Context) error {
 		room_id INTEGER NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT NULL,
-		delivered BOOLEAN DEFAULT TRUE,
+		edited_at DATETIME DEFAULT NULL,
+		delivered BOOLEAN DEFAULT FALSE,
+		parent_id INTEGER DEFAULT NULL,
+		deleted_at DATETIME DEFAULT NULL,
+		deleted_by INTEGER DEFAULT NULL,
+		FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE CASCADE,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT,
-		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE RESTRICT
+		FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL,
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
 	);`
 
 	createTriggerSQL := `CREATE TRIGGER IF NOT EXISTS update_message_timestamp
@@ -43,17 +52,122 @@ func (s *SQLiteMessageRepo) init(ctx context.Context) error {
 		UPDATE messages SET updated_at = CURRENT_TIMESTAMP WHERE ID = old.id;
 	END;`
 
+	createDeliveriesTableSQL := `CREATE TABLE IF NOT EXISTS message_deliveries (
+		message_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	createRevisionsTableSQL := `CREATE TABLE IF NOT EXISTS message_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		edited_by INTEGER NOT NULL,
+		replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// message_nonces remembers the nonce each message was sent with, so a
+	// retried send finds the message instead of creating another
+	createNoncesTableSQL := `CREATE TABLE IF NOT EXISTS message_nonces (
+		user_id INTEGER NOT NULL,
+		nonce TEXT NOT NULL,
+		message_id INTEGER DEFAULT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, nonce),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	);`
+
+	// messages_fts indexes message content for search, kept in step with the
+	// messages table by triggers
+	createSearchTableSQL := `CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content,
+		content='messages',
+		content_rowid='id'
+	);`
+
+	createSearchTriggersSQL := []string{
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END;`,
+	}
+
 	createUserIdIndexSQL := `CREATE INDEX IF NOT EXISTS idx_messages_users_id ON messages(user_id)`
 	createRoomIdIndexSQL := `CREATE INDEX IF NOT EXISTS idx_messages_rooms_id ON messages(room_id)`
+	createParentIdIndexSQL := `CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages(parent_id)`
+	createRevisionsIndexSQL := `CREATE INDEX IF NOT EXISTS idx_message_revisions_message_id ON message_revisions(message_id)`
 
 	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
 		return fmt.Errorf("creating messages table: %w", err)
 	}
 
+	// Columns added since the messages table was first created
+	addedColumns := []struct{ name, definition string }{
+		{"edited_at", "DATETIME DEFAULT NULL"},
+		{"parent_id", "INTEGER DEFAULT NULL REFERENCES messages(id) ON DELETE CASCADE"},
+		{"deleted_at", "DATETIME DEFAULT NULL"},
+		{"deleted_by", "INTEGER DEFAULT NULL REFERENCES users(id) ON DELETE SET NULL"},
+	}
+
+	for _, column := range addedColumns {
+		if _, err := utils.EnsureSQLiteColumn(ctx, s.db, "messages", column.name, column.definition); err != nil {
+			return fmt.Errorf("upgrading messages table: %w", err)
+		}
+	}
+
 	if _, err := s.db.ExecContext(ctx, createTriggerSQL); err != nil {
 		return fmt.Errorf("creating update_message_timestamp trigger: %w", err)
 	}
 
+	if _, err := s.db.ExecContext(ctx, createDeliveriesTableSQL); err != nil {
+		return fmt.Errorf("creating message_deliveries table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createRevisionsTableSQL); err != nil {
+		return fmt.Errorf("creating message_revisions table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createNoncesTableSQL); err != nil {
+		return fmt.Errorf("creating message_nonces table: %w", err)
+	}
+
+	var searchTableExists bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts')",
+	).Scan(&searchTableExists)
+	if err != nil {
+		return fmt.Errorf("checking messages_fts table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createSearchTableSQL); err != nil {
+		return fmt.Errorf("creating messages_fts table: %w", err)
+	}
+
+	// Index the messages written before search existed
+	if !searchTableExists {
+		if _, err := s.db.ExecContext(ctx, "INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("building messages_fts index: %w", err)
+		}
+	}
+
+	for _, triggerSQL := range createSearchTriggersSQL {
+		if _, err := s.db.ExecContext(ctx, triggerSQL); err != nil {
+			return fmt.Errorf("creating messages_fts trigger: %w", err)
+		}
+	}
+
 	if _, err := s.db.ExecContext(ctx, createUserIdIndexSQL); err != nil {
 		return fmt.Errorf("creating messages user_id index: %w", err)
 	}
@@ -62,14 +176,24 @@ func (s *SQLiteMessageRepo) init(ctx context.Context) error {
 		return fmt.Errorf("creating messages room_id index: %w", err)
 	}
 
+	if _, err := s.db.ExecContext(ctx, createParentIdIndexSQL); err != nil {
+		return fmt.Errorf("creating messages parent_id index: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createRevisionsIndexSQL); err != nil {
+		return fmt.Errorf("creating message_revisions message_id index: %w", err)
+	}
+
 	return nil
 }
 
 func (s *SQLiteMessageRepo) GetById(ctx context.Context, id models.MessageId) (*models.Message, error) {
 	var message models.Message
 	var updatedAt sql.NullTime
+	var parentId, deletedBy sql.NullInt64
+	var deletedAt sql.NullTime
 
-	row := s.db.QueryRowContext(ctx, `SELECT id, content, user_id, room_id, created_at, updated_at, delivered
+	row := s.db.QueryRowContext(ctx, `SELECT id, content, user_id, room_id, parent_id, created_at, updated_at, delivered, deleted_at, deleted_by
 	FROM messages
 	WHERE id = ?`, id)
 
@@ -78,15 +202,30 @@ func (s *SQLiteMessageRepo) GetById(ctx context.Context, id models.MessageId) (*
 		&message.Content,
 		&message.UserId,
 		&message.RoomId,
+		&parentId,
 		&message.CreatedAt,
 		&updatedAt,
 		&message.Delivered,
+		&deletedAt,
+		&deletedBy,
 	)
 
 	if updatedAt.Valid {
 		message.UpdatedAt = &updatedAt.Time
 	}
 
+	if parentId.Valid {
+		message.ParentId = &parentId.Int64
+	}
+
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+
+	if deletedBy.Valid {
+		message.DeletedBy = &deletedBy.Int64
+	}
+
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting message by id %d: %w", id, models.ErrNotFound)
@@ -97,10 +236,18 @@ func (s *SQLiteMessageRepo) GetById(ctx context.Context, id models.MessageId) (*
 	return &message, nil
 }
 
-func (s *SQLiteMessageRepo) Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string) (models.MessageId, error) {
-	res, err := s.db.ExecContext(ctx, "INSERT INTO messages(user_id, room_id, content) VALUES(?, ?, ?)", userId, roomId, content)
+func (s *SQLiteMessageRepo) Create(ctx context.Context, msg NewMessage) (models.MessageId, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("inserting message into room %d: %w", roomId, err)
+		return 0, fmt.Errorf("begin inserting message into room %d: %w", msg.RoomId, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO messages(user_id, room_id, parent_id, content) VALUES(?, ?, ?, ?)",
+		msg.UserId, msg.RoomId, msg.ParentId, msg.Content)
+	if err != nil {
+		return 0, fmt.Errorf("inserting message into room %d: %w", msg.RoomId, err)
 	}
 
 	messageId, err := res.LastInsertId()
@@ -108,13 +255,50 @@ func (s *SQLiteMessageRepo) Create(ctx context.Context, roomId models.RoomId, us
 		return 0, fmt.Errorf("getting last insert id for message: %w", err)
 	}
 
+	for _, mention := range msg.Mentions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO message_mentions(message_id, kind, user_id, start_offset, end_offset) VALUES(?, ?, ?, ?, ?)",
+			messageId, mention.Kind, mention.UserId, mention.Start, mention.End)
+		if err != nil {
+			return 0, fmt.Errorf("inserting mention of message %d: %w", messageId, err)
+		}
+	}
+
+	if len(msg.AttachmentIds) > 0 {
+		placeholders, args := sqliteInList(msg.AttachmentIds)
+
+		res, err := tx.ExecContext(ctx,
+			"UPDATE message_attachments SET message_id = ? WHERE id IN ("+placeholders+") AND message_id IS NULL",
+			append([]any{messageId}, args...)...)
+		if err != nil {
+			return 0, fmt.Errorf("linking attachments to message %d: %w", messageId, err)
+		}
+
+		count, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("checking rows affected for attachments on message %d: %w", messageId, err)
+		}
+
+		// Another message claimed some of them in the meantime
+		if count != int64(len(msg.AttachmentIds)) {
+			return 0, fmt.Errorf("linked %d of %d attachments to message %d: %w", count, len(msg.AttachmentIds), messageId, models.ErrConflict)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit message %d: %w", messageId, err)
+	}
+
 	return messageId, nil
 }
 
-func (s *SQLiteMessageRepo) DeleteById(ctx context.Context, id models.MessageId) error {
-	res, err := s.db.ExecContext(ctx, "DELETE FROM messages WHERE id = ?", id)
+func (s *SQLiteMessageRepo) DeleteById(ctx context.Context, id models.MessageId, deletedBy models.UserId) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET content = '', deleted_at = CURRENT_TIMESTAMP, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		deletedBy, id)
 	if err != nil {
-		return fmt.Errorf("deleting message by id %d: %w", id, err)
+		return fmt.Errorf("soft deleting message by id %d: %w", id, err)
 	}
 
 	count, err := res.RowsAffected()
@@ -129,8 +313,35 @@ func (s *SQLiteMessageRepo) DeleteById(ctx context.Context, id models.MessageId)
 	return nil
 }
 
-func (s *SQLiteMessageRepo) UpdateContent(ctx context.Context, id models.MessageId, content string) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE messages SET content = ? WHERE id = ?", content, id)
+func (s *SQLiteMessageRepo) UpdateContent(ctx context.Context, id models.MessageId, editedBy models.UserId, content string, mentions []models.Mention) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin updating message content for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT content FROM messages WHERE id = ? AND deleted_at IS NULL", id).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("updating message content for id %d: %w", id, models.ErrNotFound)
+		}
+		return fmt.Errorf("reading content of message %d: %w", id, err)
+	}
+
+	// Nothing changes, so there is no revision to keep or edit to show
+	if current == content {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO message_revisions(message_id, content, edited_by) VALUES(?, ?, ?)",
+		id, current, editedBy)
+	if err != nil {
+		return fmt.Errorf("saving revision of message %d: %w", id, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", content, id)
 	if err != nil {
 		return fmt.Errorf("updating message content for id %d: %w", id, err)
 	}
@@ -144,9 +355,52 @@ func (s *SQLiteMessageRepo) UpdateContent(ctx context.Context, id models.Message
 		return fmt.Errorf("updating message content for id %d: %w", id, models.ErrNotFound)
 	}
 
+	if _, err := tx.ExecContext(ctx, "DELETE FROM message_mentions WHERE message_id = ?", id); err != nil {
+		return fmt.Errorf("clearing mentions of message %d: %w", id, err)
+	}
+
+	for _, mention := range mentions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO message_mentions(message_id, kind, user_id, start_offset, end_offset) VALUES(?, ?, ?, ?, ?)",
+			id, mention.Kind, mention.UserId, mention.Start, mention.End)
+		if err != nil {
+			return fmt.Errorf("inserting mention of message %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit message content for id %d: %w", id, err)
+	}
+
 	return nil
 }
 
+func (s *SQLiteMessageRepo) GetRevisionsById(ctx context.Context, id models.MessageId) ([]models.MessageRevision, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, message_id, content, edited_by, replaced_at
+	FROM message_revisions
+	WHERE message_id = ?
+	ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting revisions of message %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	revisions := []models.MessageRevision{}
+	for rows.Next() {
+		var revision models.MessageRevision
+		if err := rows.Scan(&revision.Id, &revision.MessageId, &revision.Content, &revision.EditedBy, &revision.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("scanning revision of message %d: %w", id, err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating revisions of message %d: %w", id, err)
+	}
+
+	return revisions, nil
+}
+
 func (s *SQLiteMessageRepo) GetMessageReaders(ctx context.Context, messageId models.MessageId, roomId models.RoomId) ([]models.UserId, error) {
 	query := `SELECT rm.user_id 
 	FROM room_members rm 
@@ -174,30 +428,25 @@ func (s *SQLiteMessageRepo) GetMessageReaders(ctx context.Context, messageId mod
 	return readers, nil
 }
 
-func (s *SQLiteMessageRepo) GetResponseById(ctx context.Context, id models.MessageId) (*models.ResponseMessage, error) {
-	var message models.ResponseMessage
-	var updatedAt sql.NullTime
-
-	row := s.db.QueryRowContext(ctx, `SELECT m.id, m.content, m.updated_at, u.id, u.name, m.created_at, m.room_id, m.delivered
+// sqliteResponseMessageQuery selects messages, tombstones included, in their
+// response shape with the sender and thread summary, readers are looked up
+// separately.
+const sqliteResponseMessageQuery = `SELECT m.id, m.content, m.edited_at, u.id, u.name, m.created_at, m.room_id, m.delivered, m.parent_id, m.deleted_at, m.deleted_by,
+	(SELECT COUNT(*) FROM message_revisions v WHERE v.message_id = m.id) AS revision_count,
+	(SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL) AS reply_count,
+	lr.id, lr.content, lr.user_id, lru.name, lr.created_at
 	FROM messages m
 	JOIN users u ON m.user_id = u.id
-	WHERE m.id = ?`, id)
-
-	err := row.Scan(
-		&message.Id,
-		&message.Content,
-		&updatedAt,
-		&message.SenderId,
-		&message.SenderName,
-		&message.SentAt,
-		&message.RoomId,
-		&message.Delivered,
+	LEFT JOIN messages lr ON lr.id = (
+		SELECT MAX(r.id) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL
 	)
+	LEFT JOIN users lru ON lru.id = lr.user_id`
 
-	if updatedAt.Valid {
-		message.EditedAt = &updatedAt.Time
-	}
+func (s *SQLiteMessageRepo) GetResponseById(ctx context.Context, id models.MessageId) (*models.ResponseMessage, error) {
+	row := s.db.QueryRowContext(ctx, sqliteResponseMessageQuery+`
+	WHERE m.id = ?`, id)
 
+	message, err := scanResponseMessage(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting response message by id %d: %w", id, models.ErrNotFound)
@@ -214,80 +463,87 @@ func (s *SQLiteMessageRepo) GetResponseById(ctx context.Context, id models.Messa
 
 	message.ReadBy = readers
 
-	return &message, nil
+	return message, nil
 }
 
-func (s *SQLiteMessageRepo) GetMessagesById(ctx context.Context, roomId models.RoomId, limit int, cursor *string) (*GetMessagesResponse, error) {
-	query := `SELECT m.id, m.content, m.updated_at, u.id, u.name, m.created_at, m.room_id, m.delivered
-	FROM messages m
-	JOIN users u ON m.user_id = u.id
-	WHERE m.room_id = ?`
+// GetMessagesById pages through the room's top level messages, replies are
+// fetched per thread with GetRepliesById. Tombstones stay in the page so
+// threads and read markers keep their place.
+func (s *SQLiteMessageRepo) GetMessagesById(ctx context.Context, roomId models.RoomId, page PageQuery) (*GetMessagesResponse, error) {
+	res, err := pageMessages(page, func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+		return s.queryMessages(ctx, "m.room_id = ? AND m.parent_id IS NULL", roomId, op, anchor, newestFirst, limit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("messages for room %d: %w", roomId, err)
+	}
 
-	args := []any{roomId}
+	return res, nil
+}
 
-	if cursor != nil && *cursor != "" {
-		query += " AND m.id > ? "
-		args = append(args, *cursor)
+func (s *SQLiteMessageRepo) GetRepliesById(ctx context.Context, parentId models.MessageId, page PageQuery) (*GetMessagesResponse, error) {
+	res, err := pageMessages(page, func(op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+		return s.queryMessages(ctx, "m.parent_id = ?", parentId, op, anchor, newestFirst, limit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replies to message %d: %w", parentId, err)
 	}
 
-	query += " ORDER BY m.id ASC LIMIT ?"
-	args = append(args, limit+1)
+	return res, nil
+}
+
+func (s *SQLiteMessageRepo) queryMessages(ctx context.Context, filter string, arg any, op string, anchor models.MessageId, newestFirst bool, limit int) ([]models.ResponseMessage, error) {
+	query := sqliteResponseMessageQuery + `
+	WHERE ` + filter
+
+	args := []any{arg}
+
+	if op != "" {
+		query += " AND m.id " + op + " ? "
+		args = append(args, anchor)
+	}
+
+	if newestFirst {
+		query += " ORDER BY m.id DESC LIMIT ?"
+	} else {
+		query += " ORDER BY m.id ASC LIMIT ?"
+	}
+	args = append(args, limit)
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("querying messages for room %d: %w", roomId, err)
+		return nil, fmt.Errorf("querying: %w", err)
 	}
 
-	defer rows.Close()
-
 	messages := []models.ResponseMessage{}
 	for rows.Next() {
-		var msg models.ResponseMessage
-		var updatedAt sql.NullTime
-
-		err := rows.Scan(
-			&msg.Id,
-			&msg.Content,
-			&updatedAt,
-			&msg.SenderId,
-			&msg.SenderName,
-			&msg.SentAt,
-			&msg.RoomId,
-			&msg.Delivered,
-		)
-
-		if updatedAt.Valid {
-			msg.EditedAt = &updatedAt.Time
-		}
-
-		if err != nil {
-			return nil, fmt.Errorf("scanning messages for room %d: %w", roomId, err)
-		}
-
-		// Get readers for this message
-		readers, err := s.GetMessageReaders(ctx, msg.Id, roomId)
+		msg, err := scanResponseMessage(rows)
 		if err != nil {
-			// Don't fail the entire operation if we can't get readers
-			readers = []models.UserId{}
+			rows.Close()
+			return nil, fmt.Errorf("scanning: %w", err)
 		}
 
-		msg.ReadBy = readers
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterating messages for room %d: %w", roomId, err)
+		rows.Close()
+		return nil, fmt.Errorf("iterating: %w", err)
 	}
+	rows.Close()
+
+	// Readers are looked up once the rows are released, so this works on a
+	// single connection too
+	for i := range messages {
+		readers, err := s.GetMessageReaders(ctx, messages[i].Id, messages[i].RoomId)
+		if err != nil {
+			// Don't fail the entire operation if we can't get readers
+			readers = []models.UserId{}
+		}
 
-	var nextCursor *string
-	if len(messages) > limit {
-		lastRoom := messages[limit]
-		c := fmt.Sprintf("%d", lastRoom.Id)
-		nextCursor = &c
-		messages = messages[:limit]
+		messages[i].ReadBy = readers
 	}
 
-	return &GetMessagesResponse{Messages: messages, NextCursor: nextCursor}, nil
+	return messages, nil
 }
 
 func (s *SQLiteMessageRepo) MarkAsDelivered(ctx context.Context, messageId models.MessageId) error {
@@ -309,3 +565,195 @@ func (s *SQLiteMessageRepo) MarkAsDelivered(ctx context.Context, messageId model
 
 	return nil
 }
+
+func (s *SQLiteMessageRepo) MarkDeliveredTo(ctx context.Context, messageId models.MessageId, userId models.UserId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_deliveries(message_id, user_id) VALUES(?, ?)
+		ON CONFLICT (message_id, user_id) DO NOTHING`,
+		messageId, userId)
+	if err != nil {
+		return false, fmt.Errorf("recording delivery of message %d to user %d: %w", messageId, userId, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for delivery of message %d: %w", messageId, err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CountUndelivered counts the members, other than the sender, who were in
+// the room when the message was sent and have not acknowledged it yet.
+func (s *SQLiteMessageRepo) CountUndelivered(ctx context.Context, messageId models.MessageId) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*)
+	FROM messages m
+	JOIN room_members rm ON rm.room_id = m.room_id
+	WHERE m.id = ?
+		AND rm.user_id <> m.user_id
+		AND rm.joined_at <= m.created_at
+		AND NOT EXISTS (
+			SELECT 1 FROM message_deliveries d
+			WHERE d.message_id = m.id AND d.user_id = rm.user_id
+		)`, messageId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting undelivered recipients of message %d: %w", messageId, err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLiteMessageRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM messages
+	WHERE deleted_at IS NOT NULL AND deleted_at < ?
+		AND NOT EXISTS (
+			SELECT 1 FROM messages r
+			WHERE r.parent_id = messages.id AND r.deleted_at IS NULL
+		)`, before.UTC().Format(time.DateTime))
+	if err != nil {
+		return 0, fmt.Errorf("purging deleted messages before %s: %w", before, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking rows affected for purge: %w", err)
+	}
+
+	return count, nil
+}
+
+// ftsQuery turns free text into an FTS5 query matching every word, quoting
+// each one so operators and punctuation in the input are taken literally.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+func (s *SQLiteMessageRepo) SearchMessages(ctx context.Context, payload SearchMessagesPayload) (*SearchMessagesResponse, error) {
+	query := `SELECT m.id, m.room_id, r.name, m.parent_id, u.id, u.name,
+		snippet(messages_fts, 0, ?, ?, '…', 30),
+		m.created_at
+	FROM messages_fts
+	JOIN messages m ON m.id = messages_fts.rowid
+	JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = ?
+	JOIN rooms r ON r.id = m.room_id
+	JOIN users u ON u.id = m.user_id
+	WHERE messages_fts MATCH ? AND m.deleted_at IS NULL`
+
+	args := []any{snippetStartSel, snippetStopSel, payload.UserId, ftsQuery(payload.Query)}
+
+	if payload.RoomId != nil {
+		query += " AND m.room_id = ?"
+		args = append(args, *payload.RoomId)
+	}
+	if payload.SenderId != nil {
+		query += " AND m.user_id = ?"
+		args = append(args, *payload.SenderId)
+	}
+	if payload.From != nil {
+		query += " AND m.created_at >= ?"
+		args = append(args, payload.From.UTC().Format(time.DateTime))
+	}
+	if payload.To != nil {
+		query += " AND m.created_at <= ?"
+		args = append(args, payload.To.UTC().Format(time.DateTime))
+	}
+	if payload.Cursor != nil {
+		query += " AND m.id < ?"
+		args = append(args, *payload.Cursor)
+	}
+
+	query += " ORDER BY m.id DESC LIMIT ?"
+	args = append(args, payload.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("searching messages for user %d: %w", payload.UserId, err)
+	}
+	defer rows.Close()
+
+	res, err := scanSearchResults(rows, payload.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("searching messages for user %d: %w", payload.UserId, err)
+	}
+
+	return res, nil
+}
+
+func (s *SQLiteMessageRepo) ReserveNonce(ctx context.Context, userId models.UserId, nonce string, since time.Time, staleBefore time.Time) (bool, *models.MessageId, error) {
+	// A nonce last used before the window, or whose send never finished, is
+	// free to claim again
+	res, err := s.db.ExecContext(ctx, `INSERT INTO message_nonces(user_id, nonce) VALUES(?, ?)
+	ON CONFLICT (user_id, nonce) DO UPDATE SET message_id = NULL, created_at = CURRENT_TIMESTAMP
+	WHERE message_nonces.created_at < ?
+		OR (message_nonces.message_id IS NULL AND message_nonces.created_at < ?)`, userId, nonce,
+		since.UTC().Format(time.DateTime), staleBefore.UTC().Format(time.DateTime))
+	if err != nil {
+		return false, nil, fmt.Errorf("reserving nonce for user %d: %w", userId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, nil, fmt.Errorf("checking rows affected for nonce of user %d: %w", userId, err)
+	}
+
+	if count > 0 {
+		return true, nil, nil
+	}
+
+	var messageId sql.NullInt64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT message_id FROM message_nonces WHERE user_id = ? AND nonce = ?",
+		userId, nonce).Scan(&messageId)
+	if err != nil {
+		return false, nil, fmt.Errorf("getting message for nonce of user %d: %w", userId, err)
+	}
+
+	if !messageId.Valid {
+		return false, nil, nil
+	}
+
+	return false, &messageId.Int64, nil
+}
+
+func (s *SQLiteMessageRepo) CompleteNonce(ctx context.Context, userId models.UserId, nonce string, messageId models.MessageId) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE message_nonces SET message_id = ? WHERE user_id = ? AND nonce = ?",
+		messageId, userId, nonce)
+	if err != nil {
+		return fmt.Errorf("recording nonce of message %d: %w", messageId, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteMessageRepo) ReleaseNonce(ctx context.Context, userId models.UserId, nonce string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_nonces WHERE user_id = ? AND nonce = ? AND message_id IS NULL",
+		userId, nonce)
+	if err != nil {
+		return fmt.Errorf("releasing nonce of user %d: %w", userId, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteMessageRepo) PurgeNonces(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_nonces WHERE created_at < ?", before.UTC().Format(time.DateTime))
+	if err != nil {
+		return 0, fmt.Errorf("purging nonces before %s: %w", before, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking rows affected for nonce purge: %w", err)
+	}
+
+	return count, nil
+}
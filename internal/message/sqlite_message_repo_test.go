@@ -0,0 +1,94 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/internal/room"
+	"github.com/ayushgpt01/chatRoomGo/internal/user"
+)
+
+func TestSQLiteMessageRepoUpgradesOldTable(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	users, err := user.NewSqliteUserRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init users: %v", err)
+	}
+	rooms, err := room.NewSQLiteRoomRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init rooms: %v", err)
+	}
+	if _, err := room.NewSQLiteRoomMemberRepo(ctx, db); err != nil {
+		t.Fatalf("failed to init members: %v", err)
+	}
+
+	sender, err := users.Create(ctx, "sender", "Sender", "hash", models.AccountRoleUser)
+	if err != nil {
+		t.Fatalf("create sender failed: %v", err)
+	}
+	r, err := rooms.Create(ctx, "general", models.RoomVisibilityPublic, sender)
+	if err != nil {
+		t.Fatalf("create room failed: %v", err)
+	}
+
+	// The messages table as it was before threads, tombstones and edits
+	_, err = db.ExecContext(ctx, `CREATE TABLE messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		content TEXT,
+		user_id INTEGER NOT NULL,
+		room_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT NULL,
+		delivered BOOLEAN DEFAULT TRUE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT,
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE RESTRICT
+	)`)
+	if err != nil {
+		t.Fatalf("create old messages table failed: %v", err)
+	}
+	res, err := db.ExecContext(ctx, "INSERT INTO messages(user_id, room_id, content) VALUES(?, ?, ?)", sender, r.Id, "hello")
+	if err != nil {
+		t.Fatalf("insert old message failed: %v", err)
+	}
+	old, err := res.LastInsertId()
+	if err != nil {
+		t.Fatalf("last insert id failed: %v", err)
+	}
+
+	messages, err := NewSQLiteMessageRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init messages: %v", err)
+	}
+	if _, err := NewSQLiteMentionRepo(ctx, db); err != nil {
+		t.Fatalf("failed to init mentions: %v", err)
+	}
+
+	reply, err := messages.Create(ctx, NewMessage{RoomId: r.Id, UserId: sender, ParentId: &old, Content: "in thread"})
+	if err != nil {
+		t.Fatalf("create reply failed: %v", err)
+	}
+	if err := messages.UpdateContent(ctx, old, sender, "hello again", nil); err != nil {
+		t.Fatalf("edit failed: %v", err)
+	}
+	if err := messages.DeleteById(ctx, reply, sender); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	msg, err := messages.GetResponseById(ctx, old)
+	if err != nil {
+		t.Fatalf("get message failed: %v", err)
+	}
+	if msg.EditedAt == nil || msg.ReplyCount != 0 {
+		t.Fatalf("expected an edited message with no live replies, got %+v", msg)
+	}
+}
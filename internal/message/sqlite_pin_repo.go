@@ -0,0 +1,108 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLitePinRepo struct {
+	db *sql.DB
+}
+
+func NewSQLitePinRepo(ctx context.Context, db *sql.DB) (*SQLitePinRepo, error) {
+	store := SQLitePinRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing room_pins table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLitePinRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS room_pins (
+		room_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		pinned_by INTEGER DEFAULT NULL,
+		pinned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (room_id, message_id),
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating room_pins table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLitePinRepo) Pin(ctx context.Context, roomId models.RoomId, messageId models.MessageId, pinnedBy models.UserId, limit int) (bool, error) {
+	// A single statement counts and inserts under SQLite's write lock
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO room_pins(room_id, message_id, pinned_by)
+		SELECT ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM room_pins WHERE room_id = ?) < ?
+		ON CONFLICT (room_id, message_id) DO NOTHING`,
+		roomId, messageId, pinnedBy, roomId, limit)
+	if err != nil {
+		return false, fmt.Errorf("pinning message %d in room %d: %w", messageId, roomId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for pin of message %d: %w", messageId, err)
+	}
+
+	if count > 0 {
+		return true, nil
+	}
+
+	var pinned bool
+	err = s.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM room_pins WHERE room_id = ? AND message_id = ?)",
+		roomId, messageId).Scan(&pinned)
+	if err != nil {
+		return false, fmt.Errorf("checking pin of message %d in room %d: %w", messageId, roomId, err)
+	}
+
+	if !pinned {
+		return false, fmt.Errorf("room %d has %d pins: %w", roomId, limit, models.ErrConflict)
+	}
+
+	return false, nil
+}
+
+func (s *SQLitePinRepo) Unpin(ctx context.Context, roomId models.RoomId, messageId models.MessageId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM room_pins WHERE room_id = ? AND message_id = ?",
+		roomId, messageId)
+	if err != nil {
+		return false, fmt.Errorf("unpinning message %d in room %d: %w", messageId, roomId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for pin of message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLitePinRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.Pin, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT room_id, message_id, pinned_by, pinned_at
+	FROM room_pins
+	WHERE room_id = ?
+	ORDER BY pinned_at DESC, message_id DESC`, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying pins in room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanPins(rows)
+}
@@ -0,0 +1,113 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteReactionRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteReactionRepo(ctx context.Context, db *sql.DB) (*SQLiteReactionRepo, error) {
+	store := SQLiteReactionRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing message_reactions table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLiteReactionRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS message_reactions (
+		message_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		emoji TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id, emoji),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating message_reactions table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteReactionRepo) Add(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_reactions(message_id, user_id, emoji) VALUES(?, ?, ?)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING`,
+		messageId, userId, emoji)
+	if err != nil {
+		return false, fmt.Errorf("adding reaction to message %d: %w", messageId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for reaction on message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteReactionRepo) Remove(ctx context.Context, messageId models.MessageId, userId models.UserId, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?",
+		messageId, userId, emoji)
+	if err != nil {
+		return false, fmt.Errorf("removing reaction from message %d: %w", messageId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for reaction on message %d: %w", messageId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteReactionRepo) CountByEmoji(ctx context.Context, messageId models.MessageId, emoji string) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM message_reactions WHERE message_id = ? AND emoji = ?",
+		messageId, emoji).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting %s reactions on message %d: %w", emoji, messageId, err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLiteReactionRepo) GetByMessageIds(ctx context.Context, messageIds []models.MessageId) (map[models.MessageId][]models.Reaction, error) {
+	reactions := make(map[models.MessageId][]models.Reaction)
+	if len(messageIds) == 0 {
+		return reactions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messageIds)), ", ")
+	args := make([]any, len(messageIds))
+	for i, id := range messageIds {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT message_id, emoji, user_id
+	FROM message_reactions
+	WHERE message_id IN (`+placeholders+`)
+	ORDER BY message_id, created_at, user_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying reactions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReactions(rows, reactions)
+}
@@ -0,0 +1,195 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteScheduledMessageRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteScheduledMessageRepo(ctx context.Context, db *sql.DB) (*SQLiteScheduledMessageRepo, error) {
+	store := SQLiteScheduledMessageRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing scheduled_messages table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		send_at DATETIME NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		failure TEXT DEFAULT NULL,
+		claimed_at DATETIME DEFAULT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	createIndexSQL := "CREATE INDEX IF NOT EXISTS idx_scheduled_messages_status_send_at ON scheduled_messages(status, send_at);"
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating scheduled_messages table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createIndexSQL); err != nil {
+		return fmt.Errorf("creating scheduled_messages index: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteScheduledMessageRepo) Create(ctx context.Context, roomId models.RoomId, userId models.UserId, content string, sendAt time.Time) (models.ScheduledMessageId, error) {
+	var id models.ScheduledMessageId
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO scheduled_messages(room_id, user_id, content, send_at)
+		VALUES(?, ?, ?, ?) RETURNING id`,
+		roomId, userId, content, sendAt.UTC().Format(time.DateTime)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("scheduling message in room %d: %w", roomId, err)
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) GetById(ctx context.Context, id models.ScheduledMessageId) (*models.ScheduledMessage, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+scheduledColumns+" FROM scheduled_messages WHERE id = ?", id)
+
+	msg, err := scanScheduledMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting scheduled message %d: %w", id, err)
+	}
+
+	return msg, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) GetByUserId(ctx context.Context, roomId models.RoomId, userId models.UserId) ([]models.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+scheduledColumns+`
+	FROM scheduled_messages
+	WHERE room_id = ? AND user_id = ?
+	ORDER BY send_at, id`, roomId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("querying scheduled messages of user %d in room %d: %w", userId, roomId, err)
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+func (s *SQLiteScheduledMessageRepo) CountByUserId(ctx context.Context, userId models.UserId) (int, error) {
+	var count int
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM scheduled_messages WHERE user_id = ?", userId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting scheduled messages of user %d: %w", userId, err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) Update(ctx context.Context, id models.ScheduledMessageId, content string, sendAt time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_messages
+		SET content = ?, send_at = ?, status = 'pending', failure = NULL, claimed_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status IN ('pending', 'failed')`,
+		content, sendAt.UTC().Format(time.DateTime), id)
+	if err != nil {
+		return false, fmt.Errorf("updating scheduled message %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for scheduled message %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) Delete(ctx context.Context, id models.ScheduledMessageId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM scheduled_messages WHERE id = ? AND status IN ('pending', 'failed')", id)
+	if err != nil {
+		return false, fmt.Errorf("deleting scheduled message %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for scheduled message %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteScheduledMessageRepo) ClaimDue(ctx context.Context, now time.Time, staleBefore time.Time, limit int) ([]models.ScheduledMessage, error) {
+	// SQLite has a single writer, so the update claims rows atomically
+	// without row locks
+	rows, err := s.db.QueryContext(ctx, `UPDATE scheduled_messages
+	SET status = 'sending', claimed_at = ?
+	WHERE id IN (
+		SELECT id FROM scheduled_messages
+		WHERE (status = 'pending' AND send_at <= ?)
+			OR (status = 'sending' AND claimed_at < ?)
+		ORDER BY send_at, id
+		LIMIT ?
+	)
+	RETURNING `+scheduledColumns,
+		now.UTC().Format(time.DateTime), now.UTC().Format(time.DateTime), staleBefore.UTC().Format(time.DateTime), limit)
+	if err != nil {
+		return nil, fmt.Errorf("claiming due scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+func (s *SQLiteScheduledMessageRepo) Complete(ctx context.Context, id models.ScheduledMessageId) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE id = ?", id); err != nil {
+		return fmt.Errorf("completing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteScheduledMessageRepo) Fail(ctx context.Context, id models.ScheduledMessageId, failure string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_messages
+		SET status = 'failed', failure = ?, claimed_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = 'sending'`,
+		failure, id)
+	if err != nil {
+		return fmt.Errorf("failing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteScheduledMessageRepo) Release(ctx context.Context, id models.ScheduledMessageId) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE scheduled_messages SET status = 'pending', claimed_at = NULL WHERE id = ? AND status = 'sending'", id)
+	if err != nil {
+		return fmt.Errorf("releasing scheduled message %d: %w", id, err)
+	}
+
+	return nil
+}
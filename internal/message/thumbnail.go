@@ -0,0 +1,86 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+const (
+	// thumbnailSize bounds the longer side of a thumbnail in pixels
+	thumbnailSize = 320
+	// maxImagePixels stops huge images from being decoded into memory
+	maxImagePixels = 40_000_000
+)
+
+// makeThumbnail scales a PNG, JPEG or GIF image down to fit thumbnailSize,
+// flattening any transparency onto white, and returns it as a JPEG along
+// with the original image's dimensions.
+func makeThumbnail(data []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("reading image header: %w", err)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, 0, 0, fmt.Errorf("image is %dx%d: %w", config.Width, config.Height, models.ErrInvalidInput)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("decoding image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+	if longest := max(width, height); longest > thumbnailSize {
+		dstWidth = max(1, width*thumbnailSize/longest)
+		dstHeight = max(1, height*thumbnailSize/longest)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	// Average the block of source pixels behind each thumbnail pixel
+	for y := range dstHeight {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+
+		for x := range dstWidth {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// Colours are premultiplied, so white shows through by 1-alpha
+			white := 0xffff*n - a
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) / n >> 8),
+				G: uint8((g + white) / n >> 8),
+				B: uint8((b + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), width, height, nil
+}
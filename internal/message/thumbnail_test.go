@@ -0,0 +1,68 @@
+package message
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		name                    string
+		width, height           int
+		thumbWidth, thumbHeight int
+	}{
+		{"wide", 800, 400, 320, 160},
+		{"tall", 300, 900, 106, 320},
+		{"small", 40, 20, 40, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := range tt.height {
+				for x := range tt.width {
+					// Left half red, right half fully transparent
+					if x < tt.width/2 {
+						src.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+					}
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, src); err != nil {
+				t.Fatal(err)
+			}
+
+			thumb, width, height, err := makeThumbnail(buf.Bytes())
+			if err != nil {
+				t.Fatalf("makeThumbnail: %v", err)
+			}
+
+			if width != tt.width || height != tt.height {
+				t.Errorf("dimensions = %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail is not a JPEG: %v", err)
+			}
+
+			if got := img.Bounds().Size(); got.X != tt.thumbWidth || got.Y != tt.thumbHeight {
+				t.Errorf("thumbnail = %dx%d, want %dx%d", got.X, got.Y, tt.thumbWidth, tt.thumbHeight)
+			}
+
+			r, g, b, _ := img.At(img.Bounds().Dx()-1, 0).RGBA()
+			if r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+				t.Errorf("transparent area = (%d, %d, %d), want white", r>>8, g>>8, b>>8)
+			}
+		})
+	}
+
+	if _, _, _, err := makeThumbnail([]byte("not an image")); err == nil {
+		t.Error("makeThumbnail accepted non-image data")
+	}
+}
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/internal/room"
+	"github.com/ayushgpt01/chatRoomGo/internal/user"
+)
+
+func TestRepliesLeaveUnreadAlone(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	users, err := user.NewSqliteUserRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init users: %v", err)
+	}
+	rooms, err := room.NewSQLiteRoomRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init rooms: %v", err)
+	}
+	members, err := room.NewSQLiteRoomMemberRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init members: %v", err)
+	}
+	messages, err := NewSQLiteMessageRepo(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to init messages: %v", err)
+	}
+
+	sender, err := users.Create(ctx, "sender", "Sender", "hash", models.AccountRoleUser)
+	if err != nil {
+		t.Fatalf("create sender failed: %v", err)
+	}
+	reader, err := users.Create(ctx, "reader", "Reader", "hash", models.AccountRoleUser)
+	if err != nil {
+		t.Fatalf("create reader failed: %v", err)
+	}
+
+	r, err := rooms.Create(ctx, "general", models.RoomVisibilityPublic, sender)
+	if err != nil {
+		t.Fatalf("create room failed: %v", err)
+	}
+	if err := members.JoinRoom(ctx, r.Id, reader); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+
+	top, err := messages.Create(ctx, NewMessage{RoomId: r.Id, UserId: sender, Content: "hello"})
+	if err != nil {
+		t.Fatalf("create message failed: %v", err)
+	}
+	if _, err := messages.Create(ctx, NewMessage{RoomId: r.Id, UserId: sender, ParentId: &top, Content: "in thread"}); err != nil {
+		t.Fatalf("create reply failed: %v", err)
+	}
+
+	counts, err := members.CountUnreadByRoomId(ctx, r.Id)
+	if err != nil {
+		t.Fatalf("count unread failed: %v", err)
+	}
+	if counts[reader] != 1 {
+		t.Fatalf("expected 1 unread, got %d", counts[reader])
+	}
+
+	summaries, _, err := members.GetRoomsByUserId(ctx, reader, 10, nil)
+	if err != nil {
+		t.Fatalf("get rooms failed: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].UnreadCount != 1 {
+		t.Fatalf("expected one room with 1 unread, got %+v", summaries)
+	}
+	if summaries[0].LastMessage == nil || summaries[0].LastMessage.Id != top {
+		t.Fatalf("expected last message %d, got %+v", top, summaries[0].LastMessage)
+	}
+
+	// Reading the main timeline clears the room, reply and all
+	if _, err := members.UpdateLastMessageRead(ctx, r.Id, reader, top); err != nil {
+		t.Fatalf("mark read failed: %v", err)
+	}
+
+	counts, err = members.CountUnreadByRoomId(ctx, r.Id)
+	if err != nil {
+		t.Fatalf("count unread failed: %v", err)
+	}
+	if counts[reader] != 0 {
+		t.Fatalf("expected 0 unread, got %d", counts[reader])
+	}
+}
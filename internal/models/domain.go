@@ -8,11 +8,61 @@ import (
 
 type RoomId = int64
 
+// RoomVisibility decides who may join a room. Anyone may join a public
+// room; a private one needs an invite
+type RoomVisibility string
+
+const (
+	RoomVisibilityPublic  RoomVisibility = "public"
+	RoomVisibilityPrivate RoomVisibility = "private"
+)
+
+func (v RoomVisibility) IsValid() bool {
+	switch v {
+	case RoomVisibilityPublic, RoomVisibilityPrivate:
+		return true
+	default:
+		return false
+	}
+}
+
+// RoomKind tells named rooms from direct message conversations. A DM is
+// private, has no name of its own and only ever has the members it was made
+// for.
+type RoomKind string
+
+const (
+	RoomKindRoom RoomKind = "room"
+	RoomKindDM   RoomKind = "dm"
+)
+
 type Room struct {
-	Id        RoomId    `db:"id"`
-	Name      string    `db:"name"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id          RoomId         `db:"id"`
+	Name        string         `db:"name"`
+	Topic       string         `db:"topic"`
+	Description string         `db:"description"`
+	AvatarUrl   string         `db:"avatar_url"`
+	Visibility  RoomVisibility `db:"visibility"`
+	Kind        RoomKind       `db:"kind"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+}
+
+// DirectoryRoom is a public room as anyone browsing for rooms sees it
+type DirectoryRoom struct {
+	Room
+	MemberCount    int
+	LastActivityAt time.Time
+	// Joined is whether the browsing user is already a member
+	Joined bool
+}
+
+// RoomSummary is a room as one member sees it in their room list
+type RoomSummary struct {
+	Room
+	UnreadCount    int
+	LastMessage    *MessagePreview
+	LastActivityAt time.Time
 }
 
 func ParseRoomId(id string) (RoomId, error) {
@@ -23,6 +73,40 @@ func ParseRoomId(id string) (RoomId, error) {
 	return roomId, nil
 }
 
+type RoomInviteId = int64
+
+func ParseRoomInviteId(id string) (RoomInviteId, error) {
+	inviteId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid invite id: %s - %w", id, err)
+	}
+	return inviteId, nil
+}
+
+// RoomInvite lets whoever holds Token join its room, until it expires, is
+// revoked or has been used MaxUses times. A nil MaxUses allows any number
+// of uses; CreatedBy is nil once its creator is gone
+type RoomInvite struct {
+	Id        RoomInviteId `db:"id" json:"id"`
+	RoomId    RoomId       `db:"room_id" json:"roomId"`
+	Token     string       `db:"token" json:"token"`
+	CreatedBy *UserId      `db:"created_by" json:"createdBy"`
+	ExpiresAt time.Time    `db:"expires_at" json:"expiresAt"`
+	MaxUses   *int         `db:"max_uses" json:"maxUses"`
+	Uses      int          `db:"uses" json:"uses"`
+	RevokedAt *time.Time   `db:"revoked_at" json:"revokedAt"`
+	CreatedAt time.Time    `db:"created_at" json:"createdAt"`
+}
+
+// Usable reports whether the invite may still be used to join at now.
+func (i *RoomInvite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil || !now.Before(i.ExpiresAt) {
+		return false
+	}
+
+	return i.MaxUses == nil || i.Uses < *i.MaxUses
+}
+
 type MessageId = int64
 
 func ParseMessageId(id string) (MessageId, error) {
@@ -38,13 +122,110 @@ type Message struct {
 	Content   string     `db:"content"`
 	UserId    UserId     `db:"user_id"`
 	RoomId    RoomId     `db:"room_id"`
+	ParentId  *MessageId `db:"parent_id"`
 	CreatedAt time.Time  `db:"created_at"`
 	UpdatedAt *time.Time `db:"updated_at"`
 	Delivered bool       `db:"delivered"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	DeletedBy *UserId    `db:"deleted_by"`
+}
+
+// MessageRevision is an earlier version of a message's content, kept when
+// the message was edited at ReplacedAt
+type MessageRevision struct {
+	Id         int64     `db:"id" json:"id"`
+	MessageId  MessageId `db:"message_id" json:"messageId"`
+	Content    string    `db:"content" json:"content"`
+	EditedBy   UserId    `db:"edited_by" json:"editedBy"`
+	ReplacedAt time.Time `db:"replaced_at" json:"replacedAt"`
+}
+
+type AttachmentId = int64
+
+func ParseAttachmentId(id string) (AttachmentId, error) {
+	attachmentId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid attachment id: %s - %w", id, err)
+	}
+	return attachmentId, nil
+}
+
+// Attachment is an uploaded file kept in blob storage under StorageKey. It
+// belongs to no message until one is sent with it; ThumbnailKey, Width and
+// Height are set for images only
+type Attachment struct {
+	Id           AttachmentId `db:"id"`
+	RoomId       RoomId       `db:"room_id"`
+	UploadedBy   UserId       `db:"uploaded_by"`
+	MessageId    *MessageId   `db:"message_id"`
+	FileName     string       `db:"file_name"`
+	ContentType  string       `db:"content_type"`
+	Size         int64        `db:"size"`
+	StorageKey   string       `db:"storage_key"`
+	ThumbnailKey *string      `db:"thumbnail_key"`
+	Width        *int         `db:"width"`
+	Height       *int         `db:"height"`
+	CreatedAt    time.Time    `db:"created_at"`
+}
+
+type ScheduledMessageId = int64
+
+func ParseScheduledMessageId(id string) (ScheduledMessageId, error) {
+	scheduledId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scheduled message id: %s - %w", id, err)
+	}
+	return scheduledId, nil
+}
+
+type ScheduledStatus string
+
+const (
+	ScheduledPending ScheduledStatus = "pending"
+	ScheduledSending ScheduledStatus = "sending"
+	ScheduledFailed  ScheduledStatus = "failed"
+)
+
+// ScheduledMessage is a message waiting to be posted at SendAt. Once it is
+// posted the row is removed; if posting fails for good it is kept as failed
+// with the reason in Failure until the author edits or cancels it
+type ScheduledMessage struct {
+	Id        ScheduledMessageId `db:"id" json:"id"`
+	RoomId    RoomId             `db:"room_id" json:"roomId"`
+	UserId    UserId             `db:"user_id" json:"userId"`
+	Content   string             `db:"content" json:"content"`
+	SendAt    time.Time          `db:"send_at" json:"sendAt"`
+	Status    ScheduledStatus    `db:"status" json:"status"`
+	Failure   *string            `db:"failure" json:"failure"`
+	CreatedAt time.Time          `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time          `db:"updated_at" json:"updatedAt"`
+}
+
+// Pin marks a message as pinned in its room. PinnedBy is nil once the
+// moderator who pinned it is gone
+type Pin struct {
+	RoomId    RoomId    `db:"room_id"`
+	MessageId MessageId `db:"message_id"`
+	PinnedBy  *UserId   `db:"pinned_by"`
+	PinnedAt  time.Time `db:"pinned_at"`
+}
+
+// Reaction is one emoji on a message and everyone who reacted with it
+type Reaction struct {
+	Emoji   string
+	UserIds []UserId
 }
 
 type UserId = int64
 
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
 type AccountRole string
 
 const (
@@ -62,6 +243,25 @@ func (r AccountRole) IsValid() bool {
 	}
 }
 
+// RoomRole is what a member may do in one room. The creator of a room is
+// its owner; the owner appoints moderators
+type RoomRole string
+
+const (
+	RoomRoleOwner     RoomRole = "owner"
+	RoomRoleModerator RoomRole = "moderator"
+	RoomRoleMember    RoomRole = "member"
+)
+
+func (r RoomRole) IsValid() bool {
+	switch r {
+	case RoomRoleOwner, RoomRoleModerator, RoomRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
 type User struct {
 	Id          UserId      `db:"id"`
 	Name        string      `db:"name"`
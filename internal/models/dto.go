@@ -13,6 +13,68 @@ type ResponseMessage struct {
 	RoomId     RoomId     `json:"roomId"`
 	Delivered  bool       `json:"delivered"`
 	ReadBy     []UserId   `json:"readBy"`
+	// ParentId is set on replies; ReplyCount and LatestReply summarise the
+	// thread under a top level message
+	ParentId    *MessageId      `json:"parentId"`
+	ReplyCount  int             `json:"replyCount"`
+	LatestReply *MessagePreview `json:"latestReply"`
+	// DeletedAt marks a tombstone, whose content has been cleared
+	DeletedAt *time.Time `json:"deletedAt"`
+	DeletedBy *UserId    `json:"deletedBy"`
+	// RevisionCount is how many earlier versions the edit history holds
+	RevisionCount int  `json:"revisionCount"`
+	Pinned        bool `json:"pinned"`
+	// Reactions is filled in per viewer when messages are listed
+	Reactions []ReactionSummary `json:"reactions"`
+	Mentions  []Mention         `json:"mentions"`
+	// Attachments are downloaded from /attachments/{id}
+	Attachments []ResponseAttachment `json:"attachments"`
+}
+
+// ResponseAttachment describes a file on a message. Images also have a
+// thumbnail at /attachments/{id}/thumbnail
+type ResponseAttachment struct {
+	Id           AttachmentId `json:"id"`
+	FileName     string       `json:"fileName"`
+	ContentType  string       `json:"contentType"`
+	Size         int64        `json:"size"`
+	Width        *int         `json:"width"`
+	Height       *int         `json:"height"`
+	HasThumbnail bool         `json:"hasThumbnail"`
+}
+
+type MentionKind string
+
+const (
+	MentionUser MentionKind = "user"
+	MentionRoom MentionKind = "room"
+	MentionHere MentionKind = "here"
+)
+
+// Mention is a resolved @token in a message's content. Start and End are
+// offsets in UTF-16 code units, including the @, and UserId is set for user
+// mentions only
+type Mention struct {
+	Kind   MentionKind `json:"kind"`
+	UserId *UserId     `json:"userId,omitempty"`
+	Start  int         `json:"start"`
+	End    int         `json:"end"`
+}
+
+// ReactionSummary counts one emoji on a message for the user viewing it
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reactedByMe"`
+}
+
+// MessagePreview is the latest message of a room shown in the room list
+type MessagePreview struct {
+	Id         MessageId `json:"id"`
+	Content    string    `json:"content"`
+	SenderId   UserId    `json:"senderId"`
+	SenderName string    `json:"senderName"`
+	SentAt     time.Time `json:"sentAt"`
 }
 
 type ResponseUser struct {
@@ -20,4 +82,6 @@ type ResponseUser struct {
 	Username    string `json:"username"`
 	Name        string `json:"name"`
 	IsAnonymous bool   `json:"isAnonymous"`
+	// Role is set when the user is listed as a member of a room
+	Role RoomRole `json:"role,omitempty"`
 }
@@ -2,16 +2,23 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 )
 
 type OutgoingEvent struct {
-	Type    string `json:"type"`
+	Type   string `json:"type"`
+	RoomId RoomId `json:"roomId,omitempty"`
+	// Seq orders the events of one room; a gap means events were missed
+	Seq     uint64 `json:"seq,omitempty"`
 	Payload any    `json:"payload"`
 }
 
+// IncomingEvent is a command sent over a client's socket. A single socket
+// can be subscribed to many rooms, so every command names its room.
 type IncomingEvent struct {
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
+	Type   string          `json:"type"`
+	RoomId RoomId          `json:"roomId"`
+	Data   json.RawMessage `json:"data"`
 }
 
 type ChatEvent interface {
@@ -21,6 +28,15 @@ type ChatEvent interface {
 
 type HubBroadcaster interface {
 	Broadcast(roomId int64, event ChatEvent) error
+	// BroadcastToUser sends the event to every socket of one user
+	BroadcastToUser(userId UserId, event ChatEvent) error
+}
+
+// PresenceTracker hears when a user's sockets open, close or show activity
+type PresenceTracker interface {
+	Connect(userId UserId)
+	Disconnect(userId UserId)
+	Touch(userId UserId)
 }
 
 // Incoming events are named like commands
@@ -28,13 +44,20 @@ type IncomingEventType string
 type OutgoingEventType string
 
 const (
-	EventSendMessage   IncomingEventType = "message.send"
-	EventJoinRoom      IncomingEventType = "room.join"
-	EventLeaveRoom     IncomingEventType = "room.leave"
-	EventEditMessage   IncomingEventType = "message.edit"
-	EventDeleteMessage IncomingEventType = "message.delete"
-	EventStartTyping   IncomingEventType = "typing.start"
-	EventStopTyping    IncomingEventType = "typing.stop"
+	EventSendMessage    IncomingEventType = "message.send"
+	EventJoinRoom       IncomingEventType = "room.join"
+	EventLeaveRoom      IncomingEventType = "room.leave"
+	EventEditMessage    IncomingEventType = "message.edit"
+	EventDeleteMessage  IncomingEventType = "message.delete"
+	EventStartTyping    IncomingEventType = "typing.start"
+	EventStopTyping     IncomingEventType = "typing.stop"
+	EventRefreshAuth    IncomingEventType = "auth.refresh"
+	EventSubscribe      IncomingEventType = "room.subscribe"
+	EventUnsubscribe    IncomingEventType = "room.unsubscribe"
+	EventAckMessage     IncomingEventType = "message.ack"
+	EventReadMessage    IncomingEventType = "message.read"
+	EventReactMessage   IncomingEventType = "message.react"
+	EventUnreactMessage IncomingEventType = "message.unreact"
 )
 
 const (
@@ -45,13 +68,32 @@ const (
 	EventUserLeftRoom      OutgoingEventType = "user_left_room"
 	EventUserStartedTyping OutgoingEventType = "user_started_typing"
 	EventUserStoppedTyping OutgoingEventType = "user_stopped_typing"
+	EventSubscribed        OutgoingEventType = "subscribed"
+	EventUnsubscribed      OutgoingEventType = "unsubscribed"
+	EventResyncRequired    OutgoingEventType = "resync_required"
+	EventPresenceChanged   OutgoingEventType = "presence_changed"
+	EventMessageDelivered  OutgoingEventType = "message_delivered"
+	EventReadReceipt       OutgoingEventType = "read_receipt_updated"
+	EventUnreadChanged     OutgoingEventType = "unread_changed"
+	EventReactionUpdated   OutgoingEventType = "reaction_updated"
+	EventMentioned         OutgoingEventType = "mentioned"
+	EventMessagePinned     OutgoingEventType = "message_pinned"
+	EventMessageUnpinned   OutgoingEventType = "message_unpinned"
+	EventMemberRoleChanged OutgoingEventType = "member_role_changed"
+	EventRoomUpdated       OutgoingEventType = "room_updated"
+	EventRoomDeleted       OutgoingEventType = "room_deleted"
+	EventDMCreated         OutgoingEventType = "dm_created"
 
 	EventError OutgoingEventType = "error"
 )
 
 // EventMessageCreated - "message_created"
+// For a reply ThreadId is the top level message and ReplyCount its new
+// number of replies
 type MessageCreatedPayload struct {
-	Message *ResponseMessage `json:"message"`
+	Message    *ResponseMessage `json:"message"`
+	ThreadId   *MessageId       `json:"threadId,omitempty"`
+	ReplyCount int              `json:"replyCount,omitempty"`
 }
 
 type MessageCreatedEvent struct {
@@ -87,6 +129,7 @@ func (e *MessageUpdatedEvent) Payload() any {
 type MessageDeletedPayload struct {
 	MessageID MessageId `json:"messageId"`
 	RoomID    RoomId    `json:"roomId"`
+	DeletedBy UserId    `json:"deletedBy"`
 }
 
 type MessageDeletedEvent struct {
@@ -137,6 +180,93 @@ func (e *UserLeftRoomEvent) Payload() any {
 	return e.Data
 }
 
+// EventMemberRoleChanged - "member_role_changed"
+// ChangedBy is nil when the role moved on its own, as when ownership passes
+// to another member after the owner leaves
+type MemberRoleChangedPayload struct {
+	RoomId    RoomId   `json:"roomId"`
+	UserId    UserId   `json:"userId"`
+	Role      RoomRole `json:"role"`
+	ChangedBy *UserId  `json:"changedBy"`
+}
+
+type MemberRoleChangedEvent struct {
+	Data MemberRoleChangedPayload
+}
+
+func (e *MemberRoleChangedEvent) Type() string {
+	return string(EventMemberRoleChanged)
+}
+
+func (e *MemberRoleChangedEvent) Payload() any {
+	return e.Data
+}
+
+// EventRoomUpdated - "room_updated"
+// Carries every detail of the room, not only the ones that changed
+type RoomUpdatedPayload struct {
+	RoomId      RoomId         `json:"roomId"`
+	Name        string         `json:"name"`
+	Topic       string         `json:"topic"`
+	Description string         `json:"description"`
+	AvatarUrl   string         `json:"avatarUrl"`
+	Visibility  RoomVisibility `json:"visibility"`
+	UpdatedBy   UserId         `json:"updatedBy"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+type RoomUpdatedEvent struct {
+	Data RoomUpdatedPayload
+}
+
+func (e *RoomUpdatedEvent) Type() string {
+	return string(EventRoomUpdated)
+}
+
+func (e *RoomUpdatedEvent) Payload() any {
+	return e.Data
+}
+
+// EventRoomDeleted - "room_deleted"
+// The last event of a room; its subscriptions end once it is delivered
+type RoomDeletedPayload struct {
+	RoomId    RoomId `json:"roomId"`
+	DeletedBy UserId `json:"deletedBy"`
+}
+
+type RoomDeletedEvent struct {
+	Data RoomDeletedPayload
+}
+
+func (e *RoomDeletedEvent) Type() string {
+	return string(EventRoomDeleted)
+}
+
+func (e *RoomDeletedEvent) Payload() any {
+	return e.Data
+}
+
+// EventDMCreated - "dm_created"
+// Sent to each participant who was not already in the DM, so it can show up
+// in their room list before any message arrives
+type DMCreatedPayload struct {
+	RoomId       RoomId   `json:"roomId"`
+	Participants []UserId `json:"participants"`
+	CreatedBy    UserId   `json:"createdBy"`
+}
+
+type DMCreatedEvent struct {
+	Data DMCreatedPayload
+}
+
+func (e *DMCreatedEvent) Type() string {
+	return string(EventDMCreated)
+}
+
+func (e *DMCreatedEvent) Payload() any {
+	return e.Data
+}
+
 // EventError - "error"
 type ErrorPayload struct {
 	Message string `json:"message"`
@@ -191,3 +321,230 @@ func (e *UserStoppedTypingEvent) Type() string {
 func (e *UserStoppedTypingEvent) Payload() any {
 	return e.Data
 }
+
+// EventSubscribed - "subscribed"
+// Epoch and Seq are what a client sends back to resume the room later
+type SubscribedPayload struct {
+	RoomId RoomId `json:"roomId"`
+	Epoch  string `json:"epoch"`
+	Seq    uint64 `json:"seq"`
+}
+
+type SubscribedEvent struct {
+	Data SubscribedPayload
+}
+
+func (e *SubscribedEvent) Type() string {
+	return string(EventSubscribed)
+}
+
+func (e *SubscribedEvent) Payload() any {
+	return e.Data
+}
+
+// EventUnsubscribed - "unsubscribed"
+type UnsubscribedPayload struct {
+	RoomId RoomId `json:"roomId"`
+}
+
+type UnsubscribedEvent struct {
+	Data UnsubscribedPayload
+}
+
+func (e *UnsubscribedEvent) Type() string {
+	return string(EventUnsubscribed)
+}
+
+func (e *UnsubscribedEvent) Payload() any {
+	return e.Data
+}
+
+// EventResyncRequired - "resync_required"
+// Sent instead of a replay when the missed events are no longer buffered,
+// the client should refetch the room's history
+type ResyncRequiredPayload struct {
+	RoomId RoomId `json:"roomId"`
+	Epoch  string `json:"epoch"`
+	Seq    uint64 `json:"seq"`
+}
+
+type ResyncRequiredEvent struct {
+	Data ResyncRequiredPayload
+}
+
+func (e *ResyncRequiredEvent) Type() string {
+	return string(EventResyncRequired)
+}
+
+func (e *ResyncRequiredEvent) Payload() any {
+	return e.Data
+}
+
+// EventPresenceChanged - "presence_changed"
+// Sent to every room the user is a member of
+type PresenceChangedPayload struct {
+	RoomId       RoomId         `json:"roomId"`
+	UserId       UserId         `json:"userId"`
+	Status       PresenceStatus `json:"status"`
+	LastActiveAt time.Time      `json:"lastActiveAt"`
+}
+
+type PresenceChangedEvent struct {
+	Data PresenceChangedPayload
+}
+
+func (e *PresenceChangedEvent) Type() string {
+	return string(EventPresenceChanged)
+}
+
+func (e *PresenceChangedEvent) Payload() any {
+	return e.Data
+}
+
+// EventMessageDelivered - "message_delivered"
+// Sent to the sender each time a member acknowledges one of their messages,
+// AllDelivered is set once every member has
+type MessageDeliveredPayload struct {
+	MessageId    MessageId `json:"messageId"`
+	RoomId       RoomId    `json:"roomId"`
+	UserId       UserId    `json:"userId"`
+	DeliveredAt  time.Time `json:"deliveredAt"`
+	AllDelivered bool      `json:"allDelivered"`
+}
+
+type MessageDeliveredEvent struct {
+	Data MessageDeliveredPayload
+}
+
+func (e *MessageDeliveredEvent) Type() string {
+	return string(EventMessageDelivered)
+}
+
+func (e *MessageDeliveredEvent) Payload() any {
+	return e.Data
+}
+
+// EventReadReceipt - "read_receipt_updated"
+// The user has read every message up to and including LastReadMessageId
+type ReadReceiptUpdatedPayload struct {
+	RoomId            RoomId    `json:"roomId"`
+	UserId            UserId    `json:"userId"`
+	LastReadMessageId MessageId `json:"lastReadMessageId"`
+}
+
+type ReadReceiptUpdatedEvent struct {
+	Data ReadReceiptUpdatedPayload
+}
+
+func (e *ReadReceiptUpdatedEvent) Type() string {
+	return string(EventReadReceipt)
+}
+
+func (e *ReadReceiptUpdatedEvent) Payload() any {
+	return e.Data
+}
+
+// EventUnreadChanged - "unread_changed"
+// Sent to one user when their unread count in a room changes, LastMessage
+// is set when the change is a new message
+type UnreadChangedPayload struct {
+	RoomId      RoomId          `json:"roomId"`
+	UnreadCount int             `json:"unreadCount"`
+	LastMessage *MessagePreview `json:"lastMessage,omitempty"`
+}
+
+type UnreadChangedEvent struct {
+	Data UnreadChangedPayload
+}
+
+func (e *UnreadChangedEvent) Type() string {
+	return string(EventUnreadChanged)
+}
+
+func (e *UnreadChangedEvent) Payload() any {
+	return e.Data
+}
+
+// EventReactionUpdated - "reaction_updated"
+// A user added or removed an emoji on a message, Count is the emoji's new
+// total on it
+type ReactionUpdatedPayload struct {
+	MessageId MessageId `json:"messageId"`
+	RoomId    RoomId    `json:"roomId"`
+	UserId    UserId    `json:"userId"`
+	Emoji     string    `json:"emoji"`
+	Count     int       `json:"count"`
+	Added     bool      `json:"added"`
+}
+
+type ReactionUpdatedEvent struct {
+	Data ReactionUpdatedPayload
+}
+
+func (e *ReactionUpdatedEvent) Type() string {
+	return string(EventReactionUpdated)
+}
+
+func (e *ReactionUpdatedEvent) Payload() any {
+	return e.Data
+}
+
+// EventMentioned - "mentioned"
+// Sent to one user wherever they are connected when a message in one of
+// their rooms mentions them, directly or through @room or @here
+type MentionedPayload struct {
+	RoomId  RoomId           `json:"roomId"`
+	Message *ResponseMessage `json:"message"`
+}
+
+type MentionedEvent struct {
+	Data MentionedPayload
+}
+
+func (e *MentionedEvent) Type() string {
+	return string(EventMentioned)
+}
+
+func (e *MentionedEvent) Payload() any {
+	return e.Data
+}
+
+// EventMessagePinned - "message_pinned"
+type MessagePinnedPayload struct {
+	RoomId   RoomId           `json:"roomId"`
+	Message  *ResponseMessage `json:"message"`
+	PinnedBy UserId           `json:"pinnedBy"`
+	PinnedAt time.Time        `json:"pinnedAt"`
+}
+
+type MessagePinnedEvent struct {
+	Data MessagePinnedPayload
+}
+
+func (e *MessagePinnedEvent) Type() string {
+	return string(EventMessagePinned)
+}
+
+func (e *MessagePinnedEvent) Payload() any {
+	return e.Data
+}
+
+// EventMessageUnpinned - "message_unpinned"
+// UnpinnedBy is nil when the pin went away because the message was deleted
+type MessageUnpinnedPayload struct {
+	RoomId     RoomId    `json:"roomId"`
+	MessageId  MessageId `json:"messageId"`
+	UnpinnedBy *UserId   `json:"unpinnedBy"`
+}
+
+type MessageUnpinnedEvent struct {
+	Data MessageUnpinnedPayload
+}
+
+func (e *MessageUnpinnedEvent) Type() string {
+	return string(EventMessageUnpinned)
+}
+
+func (e *MessageUnpinnedEvent) Payload() any {
+	return e.Data
+}
@@ -0,0 +1,23 @@
+package presence
+
+import (
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type GetPresencePayload struct {
+	UserId models.UserId `json:"userId"`
+	RoomId models.RoomId `json:"roomId"`
+}
+
+type ResponsePresence struct {
+	UserId       models.UserId         `json:"userId"`
+	Status       models.PresenceStatus `json:"status"`
+	LastActiveAt time.Time             `json:"lastActiveAt"`
+}
+
+type GetPresenceResponse struct {
+	RoomId models.RoomId      `json:"roomId"`
+	Online []ResponsePresence `json:"online"`
+}
@@ -0,0 +1,41 @@
+package presence
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/auth"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/utils"
+)
+
+func HandleGetPresence(srv *PresenceService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetPresence(r.Context(), GetPresencePayload{
+			UserId: currentUserId,
+			RoomId: roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, fmt.Sprintf("GET /room/%d/presence", roomId), err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/logger"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// MemberStore is the part of the room member store presence needs to find
+// who should hear about a user's status.
+type MemberStore interface {
+	Exists(ctx context.Context, roomId models.RoomId, userId models.UserId) (bool, error)
+	GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.UserId, error)
+	GetRoomIdsByUserId(ctx context.Context, userId models.UserId) ([]models.RoomId, error)
+}
+
+type userPresence struct {
+	// connections counts the user's open sockets, e.g. one per tab
+	connections  int
+	status       models.PresenceStatus
+	lastActiveAt time.Time
+}
+
+// PresenceService tracks which users have a socket open on this server and
+// whether they have gone idle. A user with no entry is offline. Sockets are
+// counted per server, so behind several replicas each one reports the
+// users connected to it.
+type PresenceService struct {
+	ctx         context.Context
+	memberStore MemberStore
+	hub         models.HubBroadcaster
+	idleTimeout time.Duration
+
+	users map[models.UserId]*userPresence
+	mu    sync.Mutex
+}
+
+func NewPresenceService(ctx context.Context, memberStore MemberStore, hub models.HubBroadcaster, idleTimeout time.Duration) *PresenceService {
+	return &PresenceService{
+		ctx:         ctx,
+		memberStore: memberStore,
+		hub:         hub,
+		idleTimeout: idleTimeout,
+		users:       make(map[models.UserId]*userPresence),
+	}
+}
+
+// Connect records a newly opened socket, announcing the user as online when
+// it is their first.
+func (srv *PresenceService) Connect(userId models.UserId) {
+	now := time.Now()
+
+	srv.mu.Lock()
+	p := srv.users[userId]
+	if p == nil {
+		p = &userPresence{status: models.PresenceOffline}
+		srv.users[userId] = p
+	}
+	p.connections++
+	p.lastActiveAt = now
+	changed := p.status != models.PresenceOnline
+	p.status = models.PresenceOnline
+	srv.mu.Unlock()
+
+	if changed {
+		srv.notify(userId, models.PresenceOnline, now)
+	}
+}
+
+// Disconnect records a closed socket, announcing the user as offline when
+// it was their last.
+func (srv *PresenceService) Disconnect(userId models.UserId) {
+	srv.mu.Lock()
+	p := srv.users[userId]
+	if p == nil {
+		srv.mu.Unlock()
+		return
+	}
+	p.connections--
+	if p.connections > 0 {
+		srv.mu.Unlock()
+		return
+	}
+	delete(srv.users, userId)
+	lastActiveAt := p.lastActiveAt
+	srv.mu.Unlock()
+
+	srv.notify(userId, models.PresenceOffline, lastActiveAt)
+}
+
+// Touch marks the user as active, bringing them back from away.
+func (srv *PresenceService) Touch(userId models.UserId) {
+	now := time.Now()
+
+	srv.mu.Lock()
+	p := srv.users[userId]
+	if p == nil {
+		srv.mu.Unlock()
+		return
+	}
+	p.lastActiveAt = now
+	changed := p.status == models.PresenceAway
+	p.status = models.PresenceOnline
+	srv.mu.Unlock()
+
+	if changed {
+		srv.notify(userId, models.PresenceOnline, now)
+	}
+}
+
+// Run marks users away once they have been idle for the idle timeout,
+// until the context is cancelled.
+func (srv *PresenceService) Run() {
+	ticker := time.NewTicker(srv.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.ctx.Done():
+			return
+		case now := <-ticker.C:
+			srv.markIdle(now)
+		}
+	}
+}
+
+func (srv *PresenceService) markIdle(now time.Time) {
+	idle := make(map[models.UserId]time.Time)
+
+	srv.mu.Lock()
+	for userId, p := range srv.users {
+		if p.status == models.PresenceOnline && now.Sub(p.lastActiveAt) >= srv.idleTimeout {
+			p.status = models.PresenceAway
+			idle[userId] = p.lastActiveAt
+		}
+	}
+	srv.mu.Unlock()
+
+	for userId, lastActiveAt := range idle {
+		srv.notify(userId, models.PresenceAway, lastActiveAt)
+	}
+}
+
+func (srv *PresenceService) status(userId models.UserId) (models.PresenceStatus, time.Time) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	p := srv.users[userId]
+	if p == nil {
+		return models.PresenceOffline, time.Time{}
+	}
+	return p.status, p.lastActiveAt
+}
+
+// IsOnline reports whether the user has a socket open and has been active
+// within the idle timeout.
+func (srv *PresenceService) IsOnline(userId models.UserId) bool {
+	status, _ := srv.status(userId)
+	return status == models.PresenceOnline
+}
+
+// notify sends the new status to every room the user is a member of.
+func (srv *PresenceService) notify(userId models.UserId, status models.PresenceStatus, lastActiveAt time.Time) {
+	ctx, cancel := context.WithTimeout(srv.ctx, 5*time.Second)
+	defer cancel()
+
+	roomIds, err := srv.memberStore.GetRoomIdsByUserId(ctx, userId)
+	if err != nil {
+		logger.Error("presence_rooms_lookup_failed", "user_id", userId, "error", err)
+		return
+	}
+
+	for _, roomId := range roomIds {
+		srv.hub.Broadcast(roomId, &models.PresenceChangedEvent{
+			Data: models.PresenceChangedPayload{
+				RoomId:       roomId,
+				UserId:       userId,
+				Status:       status,
+				LastActiveAt: lastActiveAt,
+			},
+		})
+	}
+}
+
+func (srv *PresenceService) HandleGetPresence(ctx context.Context, payload GetPresencePayload) (GetPresenceResponse, error) {
+	isMember, err := srv.memberStore.Exists(ctx, payload.RoomId, payload.UserId)
+	if err != nil {
+		return GetPresenceResponse{}, fmt.Errorf("get presence check member room=%d: %w", payload.RoomId, err)
+	}
+
+	if !isMember {
+		return GetPresenceResponse{}, models.ErrForbidden
+	}
+
+	members, err := srv.memberStore.GetByRoomId(ctx, payload.RoomId)
+	if err != nil {
+		return GetPresenceResponse{}, fmt.Errorf("get presence members room=%d: %w", payload.RoomId, err)
+	}
+
+	online := []ResponsePresence{}
+	for _, userId := range members {
+		status, lastActiveAt := srv.status(userId)
+		if status == models.PresenceOffline {
+			continue
+		}
+
+		online = append(online, ResponsePresence{
+			UserId:       userId,
+			Status:       status,
+			LastActiveAt: lastActiveAt,
+		})
+	}
+
+	return GetPresenceResponse{
+		RoomId: payload.RoomId,
+		Online: online,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type fakeMemberStore struct {
+	rooms map[models.UserId][]models.RoomId
+}
+
+func (s *fakeMemberStore) Exists(ctx context.Context, roomId models.RoomId, userId models.UserId) (bool, error) {
+	for _, id := range s.rooms[userId] {
+		if id == roomId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeMemberStore) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.UserId, error) {
+	var members []models.UserId
+	for userId, rooms := range s.rooms {
+		for _, id := range rooms {
+			if id == roomId {
+				members = append(members, userId)
+			}
+		}
+	}
+	return members, nil
+}
+
+func (s *fakeMemberStore) GetRoomIdsByUserId(ctx context.Context, userId models.UserId) ([]models.RoomId, error) {
+	return s.rooms[userId], nil
+}
+
+type recordingBroadcaster struct {
+	mu     sync.Mutex
+	events []models.PresenceChangedPayload
+}
+
+func (b *recordingBroadcaster) Broadcast(roomId models.RoomId, evt models.ChatEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.events = append(b.events, evt.(*models.PresenceChangedEvent).Data)
+	return nil
+}
+
+func (b *recordingBroadcaster) BroadcastToUser(userId models.UserId, evt models.ChatEvent) error {
+	return nil
+}
+
+func (b *recordingBroadcaster) statuses() []models.PresenceStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]models.PresenceStatus, len(b.events))
+	for i, evt := range b.events {
+		statuses[i] = evt.Status
+	}
+	return statuses
+}
+
+func TestPresenceTransitions(t *testing.T) {
+	store := &fakeMemberStore{rooms: map[models.UserId][]models.RoomId{1: {10}, 2: {10}}}
+	hub := &recordingBroadcaster{}
+	srv := NewPresenceService(context.Background(), store, hub, time.Minute)
+
+	// Two tabs count as one user being online
+	srv.Connect(1)
+	srv.Connect(1)
+	srv.Disconnect(1)
+
+	srv.markIdle(time.Now().Add(2 * time.Minute))
+	srv.Touch(1)
+	srv.Disconnect(1)
+
+	want := []models.PresenceStatus{
+		models.PresenceOnline,
+		models.PresenceAway,
+		models.PresenceOnline,
+		models.PresenceOffline,
+	}
+	got := hub.statuses()
+	if len(got) != len(want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected statuses %v, got %v", want, got)
+		}
+	}
+}
+
+func TestGetPresenceListsOnlineMembers(t *testing.T) {
+	store := &fakeMemberStore{rooms: map[models.UserId][]models.RoomId{1: {10}, 2: {10}, 3: {10}}}
+	srv := NewPresenceService(context.Background(), store, &recordingBroadcaster{}, time.Minute)
+
+	srv.Connect(2)
+
+	res, err := srv.HandleGetPresence(context.Background(), GetPresencePayload{UserId: 1, RoomId: 10})
+	if err != nil {
+		t.Fatalf("get presence failed: %v", err)
+	}
+	if len(res.Online) != 1 || res.Online[0].UserId != 2 {
+		t.Fatalf("expected only user 2 online, got %+v", res.Online)
+	}
+
+	if _, err := srv.HandleGetPresence(context.Background(), GetPresencePayload{UserId: 4, RoomId: 10}); err != models.ErrForbidden {
+		t.Fatalf("expected forbidden for non-member, got %v", err)
+	}
+}
@@ -7,17 +7,30 @@ import (
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
 
+// JoinRoomPayload names the room by Id, by Invite or both. A private room
+// can only be joined with an invite to it.
 type JoinRoomPayload struct {
 	Id     models.RoomId `json:"roomId"`
 	UserId models.UserId `json:"userId"`
+	Invite string        `json:"invite"`
 }
 
 type ResponseRoom struct {
 	Id               models.RoomId          `json:"id"`
 	Name             string                 `json:"name"`
+	Topic            string                 `json:"topic"`
+	Description      string                 `json:"description"`
+	AvatarUrl        string                 `json:"avatarUrl"`
+	Visibility       models.RoomVisibility  `json:"visibility"`
+	Kind             models.RoomKind        `json:"kind"`
 	ParticipantCount int                    `json:"participantCount"`
 	UpdatedAt        time.Time              `json:"updatedAt"`
 	Members          []*models.ResponseUser `json:"members,omitempty"`
+	UnreadCount      int                    `json:"unreadCount"`
+	LastMessage      *models.MessagePreview `json:"lastMessage"`
+	LastActivityAt   time.Time              `json:"lastActivityAt"`
+	// Role is the caller's own role in the room
+	Role models.RoomRole `json:"role"`
 }
 
 type JoinRoomResponse struct {
@@ -31,8 +44,9 @@ type LeaveRoomPayload struct {
 }
 
 type CreateRoomPayload struct {
-	UserId models.UserId `json:"userId"`
-	Name   string        `json:"name"`
+	UserId     models.UserId         `json:"userId"`
+	Name       string                `json:"name"`
+	Visibility models.RoomVisibility `json:"visibility"`
 }
 
 type CreateRoomResponse struct {
@@ -49,3 +63,90 @@ type GetRoomResponse struct {
 	Rooms      []ResponseRoom `json:"rooms"`
 	NextCursor *string        `json:"nextCursor"`
 }
+
+type SetRolePayload struct {
+	UserId   models.UserId
+	RoomId   models.RoomId
+	MemberId models.UserId
+	Role     models.RoomRole
+}
+
+type CreateInvitePayload struct {
+	UserId    models.UserId
+	RoomId    models.RoomId
+	ExpiresAt *time.Time
+	MaxUses   *int
+}
+
+type GetInvitesPayload struct {
+	UserId models.UserId
+	RoomId models.RoomId
+}
+
+type RevokeInvitePayload struct {
+	UserId   models.UserId
+	RoomId   models.RoomId
+	InviteId models.RoomInviteId
+}
+
+// GetInvitesResponse lists a room's invites, newest first, including ones
+// that can no longer be used.
+type GetInvitesResponse struct {
+	Invites []models.RoomInvite `json:"invites"`
+}
+
+// UpdateRoomPayload changes only the details that are set
+type UpdateRoomPayload struct {
+	UserId      models.UserId
+	RoomId      models.RoomId
+	Name        *string
+	Topic       *string
+	Description *string
+	AvatarUrl   *string
+	Visibility  *models.RoomVisibility
+}
+
+type UpdateRoomResponse struct {
+	Room ResponseRoom `json:"room"`
+}
+
+type DeleteRoomPayload struct {
+	UserId models.UserId
+	RoomId models.RoomId
+}
+
+// CreateDMPayload names the other participants; the caller is always one
+type CreateDMPayload struct {
+	UserId  models.UserId
+	UserIds []models.UserId
+}
+
+type CreateDMResponse struct {
+	Room ResponseRoom `json:"room"`
+}
+
+type GetDirectoryPayload struct {
+	UserId models.UserId
+	Search string
+	Sort   DirectorySort
+	Limit  int
+	Cursor *string
+}
+
+// DirectoryRoom is a public room listed in the directory
+type DirectoryRoom struct {
+	Id             models.RoomId `json:"id"`
+	Name           string        `json:"name"`
+	Topic          string        `json:"topic"`
+	Description    string        `json:"description"`
+	AvatarUrl      string        `json:"avatarUrl"`
+	MemberCount    int           `json:"memberCount"`
+	LastActivityAt time.Time     `json:"lastActivityAt"`
+	// Joined is whether the caller is already a member
+	Joined bool `json:"joined"`
+}
+
+type GetDirectoryResponse struct {
+	Rooms      []DirectoryRoom `json:"rooms"`
+	NextCursor *string         `json:"nextCursor"`
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/auth"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
@@ -22,9 +23,22 @@ func (p Request) Valid(ctx context.Context) map[string]string {
 	return problems
 }
 
+type joinRequest struct {
+	RoomId models.RoomId `json:"roomId"`
+	Invite string        `json:"invite"`
+}
+
+func (p joinRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if p.RoomId == 0 && p.Invite == "" {
+		problems["roomId"] = "Room Id or invite is required"
+	}
+	return problems
+}
+
 func HandleJoinRoom(srv *RoomService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		temp, ok := utils.HandleDecode[Request](w, r)
+		temp, ok := utils.HandleDecode[joinRequest](w, r)
 		if !ok {
 			return
 		}
@@ -34,6 +48,7 @@ func HandleJoinRoom(srv *RoomService) http.Handler {
 		res, err := srv.HandleJoinRoom(r.Context(), JoinRoomPayload{
 			Id:     temp.RoomId,
 			UserId: currentUserId,
+			Invite: temp.Invite,
 		})
 
 		if err != nil {
@@ -76,7 +91,8 @@ func HandleLeaveRoom(srv *RoomService) http.Handler {
 }
 
 type CreateRoomRequest struct {
-	Name string `json:"name"`
+	Name       string                `json:"name"`
+	Visibility models.RoomVisibility `json:"visibility"`
 }
 
 func (p CreateRoomRequest) Valid(ctx context.Context) map[string]string {
@@ -84,6 +100,9 @@ func (p CreateRoomRequest) Valid(ctx context.Context) map[string]string {
 	if len(p.Name) == 0 {
 		problems["name"] = "room name is required"
 	}
+	if p.Visibility != "" && !p.Visibility.IsValid() {
+		problems["visibility"] = "visibility must be public or private"
+	}
 	return problems
 }
 
@@ -101,8 +120,9 @@ func HandleCreateRoom(srv *RoomService) http.Handler {
 		}
 
 		res, err := srv.HandleCreateRoom(r.Context(), CreateRoomPayload{
-			UserId: currentUserId,
-			Name:   temp.Name,
+			UserId:     currentUserId,
+			Name:       temp.Name,
+			Visibility: temp.Visibility,
 		})
 
 		if err != nil {
@@ -160,3 +180,360 @@ func HandleGetRooms(srv *RoomService) http.Handler {
 		}
 	})
 }
+
+type setRoleRequest struct {
+	Role models.RoomRole `json:"role"`
+}
+
+func (p setRoleRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if p.Role != models.RoomRoleModerator && p.Role != models.RoomRoleMember {
+		problems["role"] = "Role must be moderator or member"
+	}
+	return problems
+}
+
+func HandleSetRole(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		memberId, err := models.ParseUserId(r.PathValue("userId"))
+		if err != nil {
+			http.Error(w, "Invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[setRoleRequest](w, r)
+		if !ok {
+			return
+		}
+
+		err = srv.HandleSetRole(r.Context(), SetRolePayload{
+			UserId:   currentUserId,
+			RoomId:   roomId,
+			MemberId: memberId,
+			Role:     body.Role,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "PUT /room/{roomId}/members/{userId}/role", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type createInviteRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses"`
+}
+
+func (p createInviteRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if p.MaxUses != nil && (*p.MaxUses < 1 || *p.MaxUses > maxInviteUses) {
+		problems["maxUses"] = "Max uses must be between 1 and 1000"
+	}
+	return problems
+}
+
+func HandleCreateInvite(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[createInviteRequest](w, r)
+		if !ok {
+			return
+		}
+
+		res, err := srv.HandleCreateInvite(r.Context(), CreateInvitePayload{
+			UserId:    currentUserId,
+			RoomId:    roomId,
+			ExpiresAt: body.ExpiresAt,
+			MaxUses:   body.MaxUses,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /room/{roomId}/invites", err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusCreated, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleGetInvites(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetInvites(r.Context(), GetInvitesPayload{
+			UserId: currentUserId,
+			RoomId: roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "GET /room/{roomId}/invites", err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleRevokeInvite(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		inviteId, err := models.ParseRoomInviteId(r.PathValue("inviteId"))
+		if err != nil {
+			http.Error(w, "Invalid invite id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = srv.HandleRevokeInvite(r.Context(), RevokeInvitePayload{
+			UserId:   currentUserId,
+			RoomId:   roomId,
+			InviteId: inviteId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "DELETE /room/{roomId}/invites/{inviteId}", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type updateRoomRequest struct {
+	Name        *string                `json:"name"`
+	Topic       *string                `json:"topic"`
+	Description *string                `json:"description"`
+	AvatarUrl   *string                `json:"avatarUrl"`
+	Visibility  *models.RoomVisibility `json:"visibility"`
+}
+
+func (p updateRoomRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if p.Name == nil && p.Topic == nil && p.Description == nil && p.AvatarUrl == nil && p.Visibility == nil {
+		problems["room"] = "Nothing to update"
+	}
+	if p.Name != nil && len(*p.Name) == 0 {
+		problems["name"] = "room name is required"
+	}
+	if p.Visibility != nil && !p.Visibility.IsValid() {
+		problems["visibility"] = "visibility must be public or private"
+	}
+	return problems
+}
+
+func HandleUpdateRoom(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, ok := utils.HandleDecode[updateRoomRequest](w, r)
+		if !ok {
+			return
+		}
+
+		res, err := srv.HandleUpdateRoom(r.Context(), UpdateRoomPayload{
+			UserId:      currentUserId,
+			RoomId:      roomId,
+			Name:        body.Name,
+			Topic:       body.Topic,
+			Description: body.Description,
+			AvatarUrl:   body.AvatarUrl,
+			Visibility:  body.Visibility,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "PATCH /room/{roomId}", err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleDeleteRoom(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomId, err := models.ParseRoomId(r.PathValue("roomId"))
+		if err != nil {
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = srv.HandleDeleteRoom(r.Context(), DeleteRoomPayload{
+			UserId: currentUserId,
+			RoomId: roomId,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "DELETE /room/{roomId}", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type createDMRequest struct {
+	UserIds []models.UserId `json:"userIds"`
+}
+
+func (p createDMRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if len(p.UserIds) == 0 {
+		problems["userIds"] = "At least one user is required"
+	}
+	if len(p.UserIds) >= maxDMParticipants {
+		problems["userIds"] = "A DM can have at most 10 participants"
+	}
+	return problems
+}
+
+func HandleCreateDM(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := utils.HandleDecode[createDMRequest](w, r)
+		if !ok {
+			return
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleCreateDM(r.Context(), CreateDMPayload{
+			UserId:  currentUserId,
+			UserIds: body.UserIds,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "POST /dm", err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func HandleGetDirectory(srv *RoomService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+
+		if limit > 100 {
+			http.Error(w, "Limit should be under 100", http.StatusBadRequest)
+			return
+		}
+
+		sort := DirectorySort(query.Get("sort"))
+		if sort != "" && !sort.IsValid() {
+			http.Error(w, "Sort must be members or activity", http.StatusBadRequest)
+			return
+		}
+
+		var cursor *string
+		if c := query.Get("cursor"); c != "" {
+			cursor = &c
+		}
+
+		currentUserId, ok := r.Context().Value(auth.UserIDKey).(models.UserId)
+		if !ok {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := srv.HandleGetDirectory(r.Context(), GetDirectoryPayload{
+			UserId: currentUserId,
+			Search: query.Get("q"),
+			Sort:   sort,
+			Limit:  limit,
+			Cursor: cursor,
+		})
+
+		if err != nil {
+			utils.HandleServiceError(w, "GET /rooms/directory", err)
+			return
+		}
+
+		err = utils.Encode(w, r, http.StatusOK, res)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+	})
+}
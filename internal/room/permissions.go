@@ -0,0 +1,86 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// Permission is something a member may do in a room, granted by their role
+// there.
+type Permission int
+
+const (
+	PermissionSendMessage Permission = iota
+	// PermissionModerateMessages covers editing and deleting others'
+	// messages, reading their edit history and pinning
+	PermissionModerateMessages
+	PermissionManageRoles
+	PermissionManageRoom
+	PermissionManageInvites
+)
+
+var rolePermissions = map[models.RoomRole][]Permission{
+	models.RoomRoleOwner: {
+		PermissionSendMessage,
+		PermissionModerateMessages,
+		PermissionManageRoles,
+		PermissionManageRoom,
+		PermissionManageInvites,
+	},
+	models.RoomRoleModerator: {
+		PermissionSendMessage,
+		PermissionModerateMessages,
+		PermissionManageInvites,
+	},
+	models.RoomRoleMember: {
+		PermissionSendMessage,
+	},
+}
+
+// Can reports whether the role grants the permission.
+func Can(role models.RoomRole, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// Permissions answers what a user may do in a room from their role there.
+type Permissions struct {
+	roomMemberStore RoomMemberStore
+}
+
+func NewPermissions(roomMemberStore RoomMemberStore) *Permissions {
+	return &Permissions{roomMemberStore}
+}
+
+// Role returns the user's role in the room, or models.ErrUnauthorized when
+// they are not a member.
+func (p *Permissions) Role(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.RoomRole, error) {
+	role, err := p.roomMemberStore.GetRole(ctx, roomId, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return "", models.ErrUnauthorized
+	}
+	if err != nil {
+		return "", fmt.Errorf("get role of user_id=%d in room_id=%d: %w", userId, roomId, err)
+	}
+
+	return role, nil
+}
+
+// Require checks that the user may do something in the room, returning
+// models.ErrUnauthorized for non-members and models.ErrForbidden for
+// members whose role does not allow it.
+func (p *Permissions) Require(ctx context.Context, roomId models.RoomId, userId models.UserId, permission Permission) (models.RoomRole, error) {
+	role, err := p.Role(ctx, roomId, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if !Can(role, permission) {
+		return role, models.ErrForbidden
+	}
+
+	return role, nil
+}
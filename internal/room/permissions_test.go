@@ -0,0 +1,32 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       models.RoomRole
+		permission Permission
+		want       bool
+	}{
+		{models.RoomRoleOwner, PermissionManageRoles, true},
+		{models.RoomRoleOwner, PermissionModerateMessages, true},
+		{models.RoomRoleModerator, PermissionModerateMessages, true},
+		{models.RoomRoleModerator, PermissionManageRoles, false},
+		{models.RoomRoleModerator, PermissionManageRoom, false},
+		{models.RoomRoleModerator, PermissionManageInvites, true},
+		{models.RoomRoleMember, PermissionManageInvites, false},
+		{models.RoomRoleMember, PermissionSendMessage, true},
+		{models.RoomRoleMember, PermissionModerateMessages, false},
+		{models.RoomRole("admin"), PermissionSendMessage, false},
+	}
+
+	for _, tt := range tests {
+		if got := Can(tt.role, tt.permission); got != tt.want {
+			t.Errorf("Can(%s, %d) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package room
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+type PostgresInviteRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresInviteRepo(ctx context.Context, db *sql.DB) *PostgresInviteRepo {
+	return &PostgresInviteRepo{db}
+}
+
+func (s *PostgresInviteRepo) Create(ctx context.Context, roomId models.RoomId, token string, createdBy models.UserId, expiresAt time.Time, maxUses *int) (*models.RoomInvite, error) {
+	row := s.db.QueryRowContext(ctx,
+		`INSERT INTO room_invites(room_id, token, created_by, expires_at, max_uses)
+		VALUES($1, $2, $3, $4, $5) RETURNING `+inviteColumns,
+		roomId, token, createdBy, expiresAt, maxUses)
+
+	invite, err := scanInvite(row)
+	if err != nil {
+		return nil, fmt.Errorf("creating invite for room %d: %w", roomId, err)
+	}
+
+	return invite, nil
+}
+
+func (s *PostgresInviteRepo) GetByToken(ctx context.Context, token string) (*models.RoomInvite, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+inviteColumns+" FROM room_invites WHERE token = $1", token)
+
+	invite, err := scanInvite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting invite by token: %w", err)
+	}
+
+	return invite, nil
+}
+
+func (s *PostgresInviteRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.RoomInvite, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+inviteColumns+`
+	FROM room_invites
+	WHERE room_id = $1
+	ORDER BY created_at DESC, id DESC`, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying invites of room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanInvites(rows)
+}
+
+func (s *PostgresInviteRepo) Redeem(ctx context.Context, id models.RoomInviteId, now time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE room_invites SET uses = uses + 1
+		WHERE id = $1
+			AND revoked_at IS NULL
+			AND expires_at > $2
+			AND (max_uses IS NULL OR uses < max_uses)`,
+		id, now)
+	if err != nil {
+		return false, fmt.Errorf("redeeming invite %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for invite %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresInviteRepo) Revoke(ctx context.Context, roomId models.RoomId, id models.RoomInviteId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE room_invites SET revoked_at = NOW() WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL",
+		id, roomId)
+	if err != nil {
+		return false, fmt.Errorf("revoking invite %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for invite %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
@@ -104,10 +104,54 @@ func (s *PostgresRoomMemberRepo) GetByRoomId(ctx context.Context, roomId models.
 	return ids, nil
 }
 
-func (s *PostgresRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.Room, *string, error) {
-	query := `SELECT r.id, r.name, r.created_at, r.updated_at
+func (s *PostgresRoomMemberRepo) GetRoomIdsByUserId(ctx context.Context, userId models.UserId) ([]models.RoomId, error) {
+	query := "SELECT room_id FROM room_members WHERE user_id = $1"
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get member rooms user_id=%d: %w", userId, err)
+	}
+	defer rows.Close()
+
+	var ids []models.RoomId
+	for rows.Next() {
+		var id models.RoomId
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan member room user_id=%d: %w", userId, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate member rooms user_id=%d: %w", userId, err)
+	}
+
+	return ids, nil
+}
+
+// GetRoomsByUserId lists the user's rooms along with their unread count and
+// latest message, all in one query. Thread replies count toward neither.
+func (s *PostgresRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.RoomSummary, *string, error) {
+	query := `SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at,
+		(
+			SELECT COUNT(*) FROM messages m
+			WHERE m.room_id = r.id
+				AND m.id > COALESCE(rm.last_message_read_id, 0)
+				AND m.user_id <> rm.user_id
+				AND m.parent_id IS NULL
+				AND m.deleted_at IS NULL
+		) AS unread_count,
+		lm.id, lm.content, lm.user_id, lu.name, lm.created_at
 	FROM rooms r
 	JOIN room_members rm ON r.id = rm.room_id
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.content, m.user_id, m.created_at
+		FROM messages m
+		WHERE m.room_id = r.id AND m.parent_id IS NULL AND m.deleted_at IS NULL
+		ORDER BY m.id DESC
+		LIMIT 1
+	) lm ON TRUE
+	LEFT JOIN users lu ON lu.id = lm.user_id
 	WHERE rm.user_id = $1`
 
 	args := []any{userId}
@@ -129,13 +173,49 @@ func (s *PostgresRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId mo
 	}
 	defer rows.Close()
 
-	var rooms []*models.Room
+	var rooms []*models.RoomSummary
 	for rows.Next() {
-		room := &models.Room{}
-		err := rows.Scan(&room.Id, &room.Name, &room.CreatedAt, &room.UpdatedAt)
+		room := &models.RoomSummary{}
+		var lastId sql.NullInt64
+		var lastContent, lastSenderName sql.NullString
+		var lastSenderId sql.NullInt64
+		var lastSentAt sql.NullTime
+
+		err := rows.Scan(
+			&room.Id,
+			&room.Name,
+			&room.Topic,
+			&room.Description,
+			&room.AvatarUrl,
+			&room.Visibility,
+			&room.Kind,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.UnreadCount,
+			&lastId,
+			&lastContent,
+			&lastSenderId,
+			&lastSenderName,
+			&lastSentAt,
+		)
 		if err != nil {
 			return nil, nil, fmt.Errorf("scanning rooms for user %d: %w", userId, err)
 		}
+
+		room.LastActivityAt = room.UpdatedAt
+		if lastId.Valid {
+			room.LastMessage = &models.MessagePreview{
+				Id:         lastId.Int64,
+				Content:    lastContent.String,
+				SenderId:   lastSenderId.Int64,
+				SenderName: lastSenderName.String,
+				SentAt:     lastSentAt.Time,
+			}
+			if lastSentAt.Time.After(room.LastActivityAt) {
+				room.LastActivityAt = lastSentAt.Time
+			}
+		}
+
 		rooms = append(rooms, room)
 	}
 
@@ -154,24 +234,23 @@ func (s *PostgresRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId mo
 	return rooms, nextCursor, nil
 }
 
-func (s *PostgresRoomMemberRepo) UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) error {
+// UpdateLastMessageRead only ever moves the read marker forward and reports
+// whether it moved.
+func (s *PostgresRoomMemberRepo) UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) (bool, error) {
 	res, err := s.db.ExecContext(ctx,
-		"UPDATE room_members SET last_message_read_id = $1 WHERE room_id = $2 AND user_id = $3",
+		`UPDATE room_members SET last_message_read_id = $1
+		WHERE room_id = $2 AND user_id = $3 AND COALESCE(last_message_read_id, 0) < $1`,
 		messageId, roomId, userId)
 	if err != nil {
-		return fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, err)
+		return false, fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("checking rows affected for update last message read %d: %w", roomId, err)
+		return false, fmt.Errorf("checking rows affected for update last message read %d: %w", roomId, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, models.ErrNotFound)
-	}
-
-	return nil
+	return rowsAffected > 0, nil
 }
 
 func (s *PostgresRoomMemberRepo) GetLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.MessageId, error) {
@@ -219,3 +298,121 @@ func (s *PostgresRoomMemberRepo) GetRoomMembers(ctx context.Context, roomId mode
 
 	return members, nil
 }
+
+// CountUnreadByRoomId returns how many top-level messages from others each
+// member of the room has not read yet.
+func (s *PostgresRoomMemberRepo) CountUnreadByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]int, error) {
+	query := `SELECT rm.user_id, COUNT(m.id)
+	FROM room_members rm
+	LEFT JOIN messages m ON m.room_id = rm.room_id
+		AND m.id > COALESCE(rm.last_message_read_id, 0)
+		AND m.user_id <> rm.user_id
+		AND m.parent_id IS NULL
+		AND m.deleted_at IS NULL
+	WHERE rm.room_id = $1
+	GROUP BY rm.user_id`
+
+	rows, err := s.db.QueryContext(ctx, query, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("count unread room_id=%d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[models.UserId]int)
+	for rows.Next() {
+		var userId models.UserId
+		var count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, fmt.Errorf("scan unread count room_id=%d: %w", roomId, err)
+		}
+		counts[userId] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate unread counts room_id=%d: %w", roomId, err)
+	}
+
+	return counts, nil
+}
+
+func (s *PostgresRoomMemberRepo) GetRole(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.RoomRole, error) {
+	query := "SELECT role FROM room_members WHERE room_id = $1 AND user_id = $2"
+	var role models.RoomRole
+
+	err := s.db.QueryRowContext(ctx, query, roomId, userId).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("get role room_id=%d user_id=%d: %w", roomId, userId, models.ErrNotFound)
+		}
+		return "", fmt.Errorf("get role room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	return role, nil
+}
+
+func (s *PostgresRoomMemberRepo) GetRolesByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]models.RoomRole, error) {
+	query := "SELECT user_id, role FROM room_members WHERE room_id = $1"
+
+	rows, err := s.db.QueryContext(ctx, query, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("get roles room_id=%d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	roles := make(map[models.UserId]models.RoomRole)
+	for rows.Next() {
+		var userId models.UserId
+		var role models.RoomRole
+		if err := rows.Scan(&userId, &role); err != nil {
+			return nil, fmt.Errorf("scan role room_id=%d: %w", roomId, err)
+		}
+		roles[userId] = role
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate roles room_id=%d: %w", roomId, err)
+	}
+
+	return roles, nil
+}
+
+func (s *PostgresRoomMemberRepo) SetRole(ctx context.Context, roomId models.RoomId, userId models.UserId, role models.RoomRole) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3",
+		role, roomId, userId)
+	if err != nil {
+		return false, fmt.Errorf("set role room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set role rows affected room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *PostgresRoomMemberRepo) PromoteSuccessor(ctx context.Context, roomId models.RoomId) (*models.UserId, error) {
+	query := `UPDATE room_members SET role = 'owner'
+	WHERE room_id = $1
+		AND user_id = (
+			SELECT user_id FROM room_members
+			WHERE room_id = $1
+			ORDER BY CASE role WHEN 'moderator' THEN 0 ELSE 1 END, joined_at, user_id
+			LIMIT 1
+		)
+		AND NOT EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND role = 'owner')
+	RETURNING user_id`
+
+	var userId models.UserId
+
+	err := s.db.QueryRowContext(ctx, query, roomId).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("promote successor room_id=%d: %w", roomId, err)
+	}
+
+	return &userId, nil
+}
@@ -17,16 +17,31 @@ func NewPostgresRoomRepo(ctx context.Context, db *sql.DB) *PostgresRoomRepo {
 	return &PostgresRoomRepo{db}
 }
 
-func (s *PostgresRoomRepo) Create(ctx context.Context, name string) (*models.Room, error) {
+func (s *PostgresRoomRepo) Create(ctx context.Context, name string, visibility models.RoomVisibility, ownerId models.UserId) (*models.Room, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin creating room %q: %w", name, err)
+	}
+	defer tx.Rollback()
+
 	var room models.Room
 
-	query := "INSERT INTO rooms(name) VALUES($1) RETURNING id, name, created_at, updated_at"
+	query := "INSERT INTO rooms(name, visibility) VALUES($1, $2) RETURNING id, name, topic, description, avatar_url, visibility, kind, created_at, updated_at"
 
-	err := s.db.QueryRowContext(ctx, query, name).Scan(&room.Id, &room.Name, &room.CreatedAt, &room.UpdatedAt)
+	err = tx.QueryRowContext(ctx, query, name, visibility).Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("inserting room with name %q: %w", name, err)
 	}
 
+	_, err = tx.ExecContext(ctx, "INSERT INTO room_members(room_id, user_id, role) VALUES($1, $2, $3)", room.Id, ownerId, models.RoomRoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("adding owner %d to room %d: %w", ownerId, room.Id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit room %q: %w", name, err)
+	}
+
 	return &room, nil
 }
 
@@ -34,12 +49,12 @@ func (s *PostgresRoomRepo) GetById(ctx context.Context, roomId models.RoomId) (*
 	var room models.Room
 
 	row := s.db.QueryRowContext(ctx, `
-		SELECT r.id, r.name, r.created_at, r.updated_at
+		SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at
 		FROM rooms r 
 		WHERE r.id = $1
 	`, roomId)
 
-	err := row.Scan(&room.Id, &room.Name, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting room by id %d: %w", roomId, models.ErrNotFound)
@@ -50,22 +65,29 @@ func (s *PostgresRoomRepo) GetById(ctx context.Context, roomId models.RoomId) (*
 	return &room, nil
 }
 
-func (s *PostgresRoomRepo) UpdateName(ctx context.Context, roomId models.RoomId, name string) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE rooms SET name = $1 WHERE id = $2", name, roomId)
-	if err != nil {
-		return fmt.Errorf("updating room name for id %d: %w", roomId, err)
-	}
+func (s *PostgresRoomRepo) Update(ctx context.Context, roomId models.RoomId, update RoomUpdate) (*models.Room, error) {
+	var room models.Room
 
-	count, err := res.RowsAffected()
+	row := s.db.QueryRowContext(ctx, `
+		UPDATE rooms SET
+			name = COALESCE($1, name),
+			topic = COALESCE($2, topic),
+			description = COALESCE($3, description),
+			avatar_url = COALESCE($4, avatar_url),
+			visibility = COALESCE($5, visibility)
+		WHERE id = $6
+		RETURNING id, name, topic, description, avatar_url, visibility, kind, created_at, updated_at
+	`, update.Name, update.Topic, update.Description, update.AvatarUrl, update.Visibility, roomId)
+
+	err := row.Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("checking rows affected for update room %d: %w", roomId, err)
-	}
-
-	if count == 0 {
-		return fmt.Errorf("updating room name for id %d: %w", roomId, models.ErrNotFound)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("updating room %d: %w", roomId, models.ErrNotFound)
+		}
+		return nil, fmt.Errorf("updating room %d: %w", roomId, err)
 	}
 
-	return nil
+	return &room, nil
 }
 
 func (s *PostgresRoomRepo) Delete(ctx context.Context, roomId models.RoomId) error {
@@ -85,3 +107,149 @@ func (s *PostgresRoomRepo) Delete(ctx context.Context, roomId models.RoomId) err
 
 	return nil
 }
+
+func (s *PostgresRoomRepo) GetByDmKey(ctx context.Context, dmKey string) (*models.Room, error) {
+	var room models.Room
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at
+		FROM rooms r
+		WHERE r.dm_key = $1
+	`, dmKey)
+
+	err := row.Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("getting dm %q: %w", dmKey, models.ErrNotFound)
+		}
+		return nil, fmt.Errorf("scanning dm %q: %w", dmKey, err)
+	}
+
+	return &room, nil
+}
+
+func (s *PostgresRoomRepo) CreateDM(ctx context.Context, dmKey string, participants []models.UserId) (*models.Room, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin creating dm %q: %w", dmKey, err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ANY($1)", participants).Scan(&found)
+	if err != nil {
+		return nil, fmt.Errorf("checking participants of dm %q: %w", dmKey, err)
+	}
+
+	if found != len(participants) {
+		return nil, fmt.Errorf("creating dm %q: %w", dmKey, models.ErrNotFound)
+	}
+
+	var room models.Room
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rooms(name, visibility, kind, dm_key) VALUES('', $1, $2, $3)
+		ON CONFLICT (dm_key) DO NOTHING
+		RETURNING id, name, topic, description, avatar_url, visibility, kind, created_at, updated_at
+	`, models.RoomVisibilityPrivate, models.RoomKindDM, dmKey).Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
+
+	// Someone else made it first
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return s.GetByDmKey(ctx, dmKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inserting dm %q: %w", dmKey, err)
+	}
+
+	for _, userId := range participants {
+		_, err := tx.ExecContext(ctx, "INSERT INTO room_members(room_id, user_id) VALUES($1, $2)", room.Id, userId)
+		if err != nil {
+			return nil, fmt.Errorf("adding user %d to dm %d: %w", userId, room.Id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit dm %q: %w", dmKey, err)
+	}
+
+	return &room, nil
+}
+
+func (s *PostgresRoomRepo) GetDirectory(ctx context.Context, query DirectoryQuery) ([]*models.DirectoryRoom, error) {
+	sqlQuery := `SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at,
+		d.member_count, d.last_activity_at, d.joined
+	FROM rooms r
+	CROSS JOIN LATERAL (
+		SELECT
+			(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id) AS member_count,
+			GREATEST(r.updated_at, (
+				SELECT MAX(m.created_at) FROM messages m
+				WHERE m.room_id = r.id AND m.deleted_at IS NULL
+			)) AS last_activity_at,
+			EXISTS(
+				SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = $1
+			) AS joined
+	) d
+	WHERE r.kind = $2 AND r.visibility = $3`
+
+	args := []any{query.UserId, models.RoomKindRoom, models.RoomVisibilityPublic}
+
+	if query.Search != "" {
+		args = append(args, likePattern(query.Search))
+		sqlQuery += fmt.Sprintf(` AND (r.name ILIKE $%[1]d ESCAPE '\' OR r.topic ILIKE $%[1]d ESCAPE '\')`, len(args))
+	}
+
+	sortColumn := "d.member_count"
+	if query.Sort == DirectorySortActivity {
+		sortColumn = "d.last_activity_at"
+	}
+
+	if query.After != nil {
+		var after any = query.After.MemberCount
+		if query.Sort == DirectorySortActivity {
+			after = query.After.LastActivityAt
+		}
+
+		args = append(args, after, query.After.Id)
+		sqlQuery += fmt.Sprintf(" AND (%s, r.id) < ($%d, $%d)", sortColumn, len(args)-1, len(args))
+	}
+
+	args = append(args, query.Limit)
+	sqlQuery += fmt.Sprintf(" ORDER BY %s DESC, r.id DESC LIMIT $%d", sortColumn, len(args))
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying room directory: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []*models.DirectoryRoom{}
+	for rows.Next() {
+		var room models.DirectoryRoom
+		err := rows.Scan(
+			&room.Id,
+			&room.Name,
+			&room.Topic,
+			&room.Description,
+			&room.AvatarUrl,
+			&room.Visibility,
+			&room.Kind,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.MemberCount,
+			&room.LastActivityAt,
+			&room.Joined,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning room directory: %w", err)
+		}
+
+		rooms = append(rooms, &room)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating room directory: %w", err)
+	}
+
+	return rooms, nil
+}
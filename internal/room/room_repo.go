@@ -2,15 +2,82 @@ package room
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
 
 type RoomStore interface {
-	Create(ctx context.Context, name string) (*models.Room, error)
+	// Create makes the room with ownerId as its owner
+	Create(ctx context.Context, name string, visibility models.RoomVisibility, ownerId models.UserId) (*models.Room, error)
 	GetById(ctx context.Context, roomId models.RoomId) (*models.Room, error)
-	UpdateName(ctx context.Context, roomId models.RoomId, name string) error
+	// Update reports models.ErrNotFound when there is no such room
+	Update(ctx context.Context, roomId models.RoomId, update RoomUpdate) (*models.Room, error)
 	Delete(ctx context.Context, roomId models.RoomId) error
+	// GetByDmKey reports models.ErrNotFound when the participants have no DM
+	GetByDmKey(ctx context.Context, dmKey string) (*models.Room, error)
+	// CreateDM makes a DM with the participants as its members, or returns
+	// the one they already have. It reports models.ErrNotFound when any of
+	// the participants does not exist.
+	CreateDM(ctx context.Context, dmKey string, participants []models.UserId) (*models.Room, error)
+	// GetDirectory lists public rooms, never DMs, in the order asked for
+	GetDirectory(ctx context.Context, query DirectoryQuery) ([]*models.DirectoryRoom, error)
+}
+
+// DirectorySort is the order the room directory is listed in, largest or
+// latest first
+type DirectorySort string
+
+const (
+	DirectorySortMembers  DirectorySort = "members"
+	DirectorySortActivity DirectorySort = "activity"
+)
+
+func (s DirectorySort) IsValid() bool {
+	switch s {
+	case DirectorySortMembers, DirectorySortActivity:
+		return true
+	default:
+		return false
+	}
+}
+
+// DirectoryCursor is the last room of the previous page. Only the field the
+// directory is sorted by is used besides Id.
+type DirectoryCursor struct {
+	MemberCount    int
+	LastActivityAt time.Time
+	Id             models.RoomId
+}
+
+type DirectoryQuery struct {
+	// UserId is who the Joined flag is for
+	UserId models.UserId
+	// Search matches anywhere in a room's name or topic when set
+	Search string
+	Sort   DirectorySort
+	After  *DirectoryCursor
+	Limit  int
+}
+
+// likePattern matches text containing search, with LIKE wildcards in it
+// taken literally. Queries using it must declare '\' as the escape.
+func likePattern(search string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search)
+	return "%" + escaped + "%"
+}
+
+// RoomUpdate holds the room details to change. Nil fields are left as they
+// are.
+type RoomUpdate struct {
+	Name        *string
+	Topic       *string
+	Description *string
+	AvatarUrl   *string
+	Visibility  *models.RoomVisibility
 }
 
 type RoomMemberStore interface {
@@ -19,8 +86,81 @@ type RoomMemberStore interface {
 	Exists(ctx context.Context, roomId models.RoomId, userId models.UserId) (bool, error)
 	CountByRoomId(ctx context.Context, roomId models.RoomId) (int, error)
 	GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.UserId, error)
-	GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.Room, *string, error)
-	UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) error
+	GetRoomIdsByUserId(ctx context.Context, userId models.UserId) ([]models.RoomId, error)
+	GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.RoomSummary, *string, error)
+	CountUnreadByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]int, error)
+	UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) (bool, error)
 	GetLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.MessageId, error)
 	GetRoomMembers(ctx context.Context, roomId models.RoomId) ([]*models.User, error)
+	// GetRole reports models.ErrNotFound when the user is not a member
+	GetRole(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.RoomRole, error)
+	GetRolesByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]models.RoomRole, error)
+	// SetRole reports false when the user is not a member
+	SetRole(ctx context.Context, roomId models.RoomId, userId models.UserId, role models.RoomRole) (bool, error)
+	// PromoteSuccessor makes the longest standing moderator, or failing that
+	// member, the owner of a room left without one. It returns nil when the
+	// room has an owner or no members.
+	PromoteSuccessor(ctx context.Context, roomId models.RoomId) (*models.UserId, error)
+}
+
+type InviteStore interface {
+	Create(ctx context.Context, roomId models.RoomId, token string, createdBy models.UserId, expiresAt time.Time, maxUses *int) (*models.RoomInvite, error)
+	// GetByToken reports models.ErrNotFound for an unknown token
+	GetByToken(ctx context.Context, token string) (*models.RoomInvite, error)
+	// GetByRoomId lists a room's invites, newest first
+	GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.RoomInvite, error)
+	// Redeem counts a use of the invite, reporting false when it has expired,
+	// been revoked or been used up by now
+	Redeem(ctx context.Context, id models.RoomInviteId, now time.Time) (bool, error)
+	// Revoke reports false when the room has no such unrevoked invite
+	Revoke(ctx context.Context, roomId models.RoomId, id models.RoomInviteId) (bool, error)
+}
+
+const inviteColumns = "id, room_id, token, created_by, expires_at, max_uses, uses, revoked_at, created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvite(row rowScanner) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	var createdBy, maxUses sql.NullInt64
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&invite.Id, &invite.RoomId, &invite.Token, &createdBy, &invite.ExpiresAt,
+		&maxUses, &invite.Uses, &revokedAt, &invite.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if createdBy.Valid {
+		invite.CreatedBy = &createdBy.Int64
+	}
+	if maxUses.Valid {
+		uses := int(maxUses.Int64)
+		invite.MaxUses = &uses
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
+	}
+
+	return &invite, nil
+}
+
+func scanInvites(rows *sql.Rows) ([]models.RoomInvite, error) {
+	invites := []models.RoomInvite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning invite: %w", err)
+		}
+
+		invites = append(invites, *invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating invites: %w", err)
+	}
+
+	return invites, nil
 }
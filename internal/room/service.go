@@ -2,82 +2,229 @@ package room
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/auth"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
 )
 
+const (
+	// defaultInviteLifetime is how long an invite lasts when its creator
+	// does not say
+	defaultInviteLifetime = 7 * 24 * time.Hour
+	maxInviteLifetime     = 30 * 24 * time.Hour
+	maxInviteUses         = 1000
+
+	maxRoomNameLength    = 100
+	maxTopicLength       = 250
+	maxDescriptionLength = 2000
+	maxAvatarUrlLength   = 2048
+
+	// maxDMParticipants caps a group DM, counting its creator
+	maxDMParticipants = 10
+)
+
+// AttachmentPurger removes the files uploaded to a room, which would
+// otherwise outlive it in blob storage
+type AttachmentPurger interface {
+	HandleGetRoomAttachments(ctx context.Context, roomId models.RoomId) ([]models.Attachment, error)
+	HandleDeleteAttachmentBlobs(ctx context.Context, attachments []models.Attachment)
+}
+
 type RoomService struct {
 	roomMemberStore RoomMemberStore
 	roomStore       RoomStore
+	inviteStore     InviteStore
 	authService     *auth.AuthService
 	hub             models.HubBroadcaster
+	permissions     *Permissions
+
+	// attachments is told to clear out a room before it is deleted when set
+	attachments AttachmentPurger
+}
+
+func NewRoomService(roomMemberStore RoomMemberStore, roomStore RoomStore, inviteStore InviteStore, authService *auth.AuthService, hub models.HubBroadcaster) *RoomService {
+	return &RoomService{
+		roomMemberStore: roomMemberStore,
+		roomStore:       roomStore,
+		inviteStore:     inviteStore,
+		authService:     authService,
+		hub:             hub,
+		permissions:     NewPermissions(roomMemberStore),
+	}
 }
 
-func NewRoomService(roomMemberStore RoomMemberStore, roomStore RoomStore, authService *auth.AuthService, hub models.HubBroadcaster) *RoomService {
-	return &RoomService{roomMemberStore, roomStore, authService, hub}
+// PurgeAttachmentsWith sets what removes a room's attachments when it is
+// deleted. Without it their blobs are left behind.
+func (srv *RoomService) PurgeAttachmentsWith(attachments AttachmentPurger) {
+	srv.attachments = attachments
+}
+
+// resolveInvite finds the room an invite is for and checks it can still be
+// used. An unknown or unusable invite, or one for a different room than the
+// one asked for, is forbidden like a room that does not exist.
+func (srv *RoomService) resolveInvite(ctx context.Context, token string, roomId models.RoomId) (*models.RoomInvite, error) {
+	invite, err := srv.inviteStore.GetByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.ErrForbidden
+		}
+
+		return nil, fmt.Errorf("join room get invite: %w", err)
+	}
+
+	if (roomId != 0 && invite.RoomId != roomId) || !invite.Usable(time.Now()) {
+		return nil, models.ErrForbidden
+	}
+
+	return invite, nil
 }
 
 func (srv *RoomService) HandleJoinRoom(ctx context.Context, payload JoinRoomPayload) (JoinRoomResponse, error) {
-	var loginRes *auth.LoginResponse
-	targetUserId := payload.UserId
+	roomId := payload.Id
 
-	if targetUserId == 0 {
-		login, err := srv.authService.HandleGuestSignup(ctx)
+	var invite *models.RoomInvite
+	if payload.Invite != "" {
+		var err error
+		invite, err = srv.resolveInvite(ctx, payload.Invite, roomId)
 		if err != nil {
-			return JoinRoomResponse{}, fmt.Errorf("join room guest signup: %w", err)
+			return JoinRoomResponse{}, err
 		}
 
-		loginRes = &login
-		targetUserId = login.User.Id
+		roomId = invite.RoomId
 	}
 
-	room, err := srv.roomStore.GetById(ctx, payload.Id)
+	room, err := srv.roomStore.GetById(ctx, roomId)
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			return JoinRoomResponse{}, models.ErrForbidden
 		}
 
-		return JoinRoomResponse{}, fmt.Errorf("join room get room=%d: %w", payload.Id, err)
+		return JoinRoomResponse{}, fmt.Errorf("join room get room=%d: %w", roomId, err)
 	}
 
-	// Check if room has reached the 50 member limit
-	members, err := srv.roomMemberStore.GetRoomMembers(ctx, room.Id)
-	if err != nil {
-		return JoinRoomResponse{}, fmt.Errorf("join room get members=%d: %w", payload.Id, err)
+	member := false
+	if payload.UserId != 0 {
+		member, err = srv.roomMemberStore.Exists(ctx, room.Id, payload.UserId)
+		if err != nil {
+			return JoinRoomResponse{}, fmt.Errorf("join room: %w", err)
+		}
+	}
+
+	// Only the participants a DM was made for are ever in it
+	if room.Kind == models.RoomKindDM && !member {
+		return JoinRoomResponse{}, models.ErrForbidden
 	}
 
-	if len(members) >= 50 {
-		return JoinRoomResponse{}, fmt.Errorf("room has reached maximum capacity of 50 members")
+	// Members of a private room may come back without an invite
+	if room.Visibility == models.RoomVisibilityPrivate && invite == nil && !member {
+		return JoinRoomResponse{}, models.ErrForbidden
+	}
+
+	if !member {
+		// Check if room has reached the 50 member limit
+		members, err := srv.roomMemberStore.GetRoomMembers(ctx, room.Id)
+		if err != nil {
+			return JoinRoomResponse{}, fmt.Errorf("join room get members=%d: %w", room.Id, err)
+		}
+
+		if len(members) >= 50 {
+			return JoinRoomResponse{}, fmt.Errorf("room has reached maximum capacity of 50 members")
+		}
+
+		// The invite may have been used up since it was checked
+		if invite != nil {
+			redeemed, err := srv.inviteStore.Redeem(ctx, invite.Id, time.Now())
+			if err != nil {
+				return JoinRoomResponse{}, fmt.Errorf("join room: %w", err)
+			}
+
+			if !redeemed {
+				return JoinRoomResponse{}, models.ErrForbidden
+			}
+		}
+	}
+
+	// Guests are only created once they are sure to get in
+	var loginRes *auth.LoginResponse
+	targetUserId := payload.UserId
+
+	if targetUserId == 0 {
+		login, err := srv.authService.HandleGuestSignup(ctx)
+		if err != nil {
+			return JoinRoomResponse{}, fmt.Errorf("join room guest signup: %w", err)
+		}
+
+		loginRes = &login
+		targetUserId = login.User.Id
 	}
 
 	if err = srv.roomMemberStore.JoinRoom(ctx, room.Id, targetUserId); err != nil {
 		return JoinRoomResponse{}, fmt.Errorf("join room: %w", err)
 	}
 
-	srv.hub.Broadcast(room.Id, &models.UserJoinedRoomEvent{
-		Data: models.UserJoinedRoomPayload{
-			RoomID: room.Id,
-			UserID: targetUserId,
-		},
-	})
+	// Joining again keeps whatever role the user already had
+	role, err := srv.roomMemberStore.GetRole(ctx, room.Id, targetUserId)
+	if err != nil {
+		return JoinRoomResponse{}, fmt.Errorf("join room: %w", err)
+	}
+
+	name := room.Name
+	if room.Kind == models.RoomKindDM {
+		members, err := srv.roomMemberStore.GetRoomMembers(ctx, room.Id)
+		if err != nil {
+			return JoinRoomResponse{}, fmt.Errorf("join room get members=%d: %w", room.Id, err)
+		}
+		name = displayName(room, members, targetUserId)
+	}
+
+	if !member {
+		srv.hub.Broadcast(room.Id, &models.UserJoinedRoomEvent{
+			Data: models.UserJoinedRoomPayload{
+				RoomID: room.Id,
+				UserID: targetUserId,
+			},
+		})
+	}
 
 	return JoinRoomResponse{
 		Room: ResponseRoom{
 			Id:               room.Id,
-			Name:             room.Name,
+			Name:             name,
+			Topic:            room.Topic,
+			Description:      room.Description,
+			AvatarUrl:        room.AvatarUrl,
+			Visibility:       room.Visibility,
+			Kind:             room.Kind,
 			ParticipantCount: 0,
 			UpdatedAt:        room.UpdatedAt,
 			Members:          []*models.ResponseUser{},
+			Role:             role,
 		},
 		Login: loginRes,
 	}, nil
 }
 
 func (srv *RoomService) HandleLeaveRoom(ctx context.Context, payload LeaveRoomPayload) error {
-	err := srv.roomMemberStore.LeaveRoom(ctx, payload.Id, payload.UserId)
+	role, err := srv.permissions.Role(ctx, payload.Id, payload.UserId)
+	if err != nil {
+		if errors.Is(err, models.ErrUnauthorized) {
+			return models.ErrForbidden
+		}
+
+		return fmt.Errorf("handle leave room: %w", err)
+	}
+
+	err = srv.roomMemberStore.LeaveRoom(ctx, payload.Id, payload.UserId)
 
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
@@ -94,26 +241,55 @@ func (srv *RoomService) HandleLeaveRoom(ctx context.Context, payload LeaveRoomPa
 		},
 	})
 
+	// A room is never left without an owner while it has members
+	if role == models.RoomRoleOwner {
+		successor, err := srv.roomMemberStore.PromoteSuccessor(ctx, payload.Id)
+		if err != nil {
+			return fmt.Errorf("handle leave room: %w", err)
+		}
+
+		if successor != nil {
+			srv.hub.Broadcast(payload.Id, &models.MemberRoleChangedEvent{
+				Data: models.MemberRoleChangedPayload{
+					RoomId: payload.Id,
+					UserId: *successor,
+					Role:   models.RoomRoleOwner,
+				},
+			})
+		}
+	}
+
 	return nil
 }
 
 func (srv *RoomService) HandleCreateRoom(ctx context.Context, payload CreateRoomPayload) (CreateRoomResponse, error) {
-	room, err := srv.roomStore.Create(ctx, payload.Name)
-	if err != nil {
-		return CreateRoomResponse{}, fmt.Errorf("create room name=%s: %w", payload.Name, err)
+	visibility := payload.Visibility
+	if visibility == "" {
+		visibility = models.RoomVisibilityPublic
 	}
 
-	if err = srv.roomMemberStore.JoinRoom(ctx, room.Id, payload.UserId); err != nil {
-		return CreateRoomResponse{}, fmt.Errorf("create room join user: %w", err)
+	if !visibility.IsValid() {
+		return CreateRoomResponse{}, models.ErrInvalidInput
+	}
+
+	room, err := srv.roomStore.Create(ctx, payload.Name, visibility, payload.UserId)
+	if err != nil {
+		return CreateRoomResponse{}, fmt.Errorf("create room name=%s: %w", payload.Name, err)
 	}
 
 	return CreateRoomResponse{
 		Room: ResponseRoom{
 			Id:               room.Id,
 			Name:             room.Name,
+			Topic:            room.Topic,
+			Description:      room.Description,
+			AvatarUrl:        room.AvatarUrl,
+			Visibility:       room.Visibility,
+			Kind:             room.Kind,
 			ParticipantCount: 0,
 			UpdatedAt:        room.UpdatedAt,
 			Members:          []*models.ResponseUser{},
+			Role:             models.RoomRoleOwner,
 		},
 	}, nil
 }
@@ -132,6 +308,11 @@ func (srv *RoomService) HandleGetRooms(ctx context.Context, payload GetRoomPaylo
 			members = []*models.User{}
 		}
 
+		roles, err := srv.roomMemberStore.GetRolesByRoomId(ctx, room.Id)
+		if err != nil {
+			roles = map[models.UserId]models.RoomRole{}
+		}
+
 		responseMembers := make([]*models.ResponseUser, len(members))
 		for i, member := range members {
 			responseMembers[i] = &models.ResponseUser{
@@ -139,15 +320,25 @@ func (srv *RoomService) HandleGetRooms(ctx context.Context, payload GetRoomPaylo
 				Username:    member.Username,
 				Name:        member.Name,
 				IsAnonymous: member.AccountRole == models.AccountRoleGuest,
+				Role:        roles[member.Id],
 			}
 		}
 
 		responseRooms = append(responseRooms, ResponseRoom{
 			Id:               room.Id,
-			Name:             room.Name,
+			Name:             displayName(&room.Room, members, payload.UserId),
+			Topic:            room.Topic,
+			Description:      room.Description,
+			AvatarUrl:        room.AvatarUrl,
+			Visibility:       room.Visibility,
+			Kind:             room.Kind,
 			ParticipantCount: len(responseMembers),
 			UpdatedAt:        room.UpdatedAt,
 			Members:          responseMembers,
+			UnreadCount:      room.UnreadCount,
+			LastMessage:      room.LastMessage,
+			LastActivityAt:   room.LastActivityAt,
+			Role:             roles[payload.UserId],
 		})
 	}
 
@@ -156,3 +347,473 @@ func (srv *RoomService) HandleGetRooms(ctx context.Context, payload GetRoomPaylo
 		NextCursor: nextCursor,
 	}, nil
 }
+
+// HandleSetRole makes a member of the room a moderator or a plain member.
+// Only the owner may, and the owner's own role cannot be changed this way.
+func (srv *RoomService) HandleSetRole(ctx context.Context, payload SetRolePayload) error {
+	if payload.Role != models.RoomRoleModerator && payload.Role != models.RoomRoleMember {
+		return models.ErrInvalidInput
+	}
+
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageRoles); err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+
+	if payload.MemberId == payload.UserId {
+		return fmt.Errorf("owner user_id=%d cannot change own role: %w", payload.UserId, models.ErrConflict)
+	}
+
+	current, err := srv.roomMemberStore.GetRole(ctx, payload.RoomId, payload.MemberId)
+	if err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+
+	if current == payload.Role {
+		return nil
+	}
+
+	updated, err := srv.roomMemberStore.SetRole(ctx, payload.RoomId, payload.MemberId, payload.Role)
+	if err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+
+	if !updated {
+		return models.ErrNotFound
+	}
+
+	srv.hub.Broadcast(payload.RoomId, &models.MemberRoleChangedEvent{
+		Data: models.MemberRoleChangedPayload{
+			RoomId:    payload.RoomId,
+			UserId:    payload.MemberId,
+			Role:      payload.Role,
+			ChangedBy: &payload.UserId,
+		},
+	})
+
+	return nil
+}
+
+func generateInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate invite token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HandleCreateInvite makes an invite link to the room. It lasts a week
+// unless ExpiresAt says otherwise, and may be used any number of times
+// unless MaxUses is set.
+func (srv *RoomService) HandleCreateInvite(ctx context.Context, payload CreateInvitePayload) (*models.RoomInvite, error) {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageInvites); err != nil {
+		return nil, fmt.Errorf("create invite: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultInviteLifetime)
+	if payload.ExpiresAt != nil {
+		expiresAt = *payload.ExpiresAt
+	}
+
+	if !expiresAt.After(now) || expiresAt.After(now.Add(maxInviteLifetime)) {
+		return nil, models.ErrInvalidInput
+	}
+
+	if payload.MaxUses != nil && (*payload.MaxUses < 1 || *payload.MaxUses > maxInviteUses) {
+		return nil, models.ErrInvalidInput
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		return nil, fmt.Errorf("create invite: %w", err)
+	}
+
+	invite, err := srv.inviteStore.Create(ctx, payload.RoomId, token, payload.UserId, expiresAt, payload.MaxUses)
+	if err != nil {
+		return nil, fmt.Errorf("create invite: %w", err)
+	}
+
+	return invite, nil
+}
+
+func (srv *RoomService) HandleGetInvites(ctx context.Context, payload GetInvitesPayload) (*GetInvitesResponse, error) {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageInvites); err != nil {
+		return nil, fmt.Errorf("get invites: %w", err)
+	}
+
+	invites, err := srv.inviteStore.GetByRoomId(ctx, payload.RoomId)
+	if err != nil {
+		return nil, fmt.Errorf("get invites: %w", err)
+	}
+
+	return &GetInvitesResponse{Invites: invites}, nil
+}
+
+func (srv *RoomService) HandleRevokeInvite(ctx context.Context, payload RevokeInvitePayload) error {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageInvites); err != nil {
+		return fmt.Errorf("revoke invite: %w", err)
+	}
+
+	revoked, err := srv.inviteStore.Revoke(ctx, payload.RoomId, payload.InviteId)
+	if err != nil {
+		return fmt.Errorf("revoke invite: %w", err)
+	}
+
+	if !revoked {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// validRoomUpdate trims the text fields of an update in place and reports
+// whether it changes anything and everything it sets is acceptable.
+func validRoomUpdate(update *RoomUpdate) bool {
+	if update.Name == nil && update.Topic == nil && update.Description == nil &&
+		update.AvatarUrl == nil && update.Visibility == nil {
+		return false
+	}
+
+	limits := []struct {
+		field *string
+		max   int
+	}{
+		{update.Name, maxRoomNameLength},
+		{update.Topic, maxTopicLength},
+		{update.Description, maxDescriptionLength},
+		{update.AvatarUrl, maxAvatarUrlLength},
+	}
+	for _, limit := range limits {
+		if limit.field == nil {
+			continue
+		}
+		*limit.field = strings.TrimSpace(*limit.field)
+		if utf8.RuneCountInString(*limit.field) > limit.max {
+			return false
+		}
+	}
+
+	if update.Name != nil && *update.Name == "" {
+		return false
+	}
+
+	// An empty avatar clears it, anything else must be a web address
+	if update.AvatarUrl != nil && *update.AvatarUrl != "" {
+		u, err := url.Parse(*update.AvatarUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return false
+		}
+	}
+
+	if update.Visibility != nil && !update.Visibility.IsValid() {
+		return false
+	}
+
+	return true
+}
+
+// HandleUpdateRoom changes the room's name, topic, description, avatar or
+// visibility. Only the owner may.
+func (srv *RoomService) HandleUpdateRoom(ctx context.Context, payload UpdateRoomPayload) (UpdateRoomResponse, error) {
+	update := RoomUpdate{
+		Name:        payload.Name,
+		Topic:       payload.Topic,
+		Description: payload.Description,
+		AvatarUrl:   payload.AvatarUrl,
+		Visibility:  payload.Visibility,
+	}
+
+	if !validRoomUpdate(&update) {
+		return UpdateRoomResponse{}, models.ErrInvalidInput
+	}
+
+	role, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageRoom)
+	if err != nil {
+		return UpdateRoomResponse{}, fmt.Errorf("update room: %w", err)
+	}
+
+	room, err := srv.roomStore.Update(ctx, payload.RoomId, update)
+	if err != nil {
+		return UpdateRoomResponse{}, fmt.Errorf("update room: %w", err)
+	}
+
+	srv.hub.Broadcast(room.Id, &models.RoomUpdatedEvent{
+		Data: models.RoomUpdatedPayload{
+			RoomId:      room.Id,
+			Name:        room.Name,
+			Topic:       room.Topic,
+			Description: room.Description,
+			AvatarUrl:   room.AvatarUrl,
+			Visibility:  room.Visibility,
+			UpdatedBy:   payload.UserId,
+			UpdatedAt:   room.UpdatedAt,
+		},
+	})
+
+	return UpdateRoomResponse{
+		Room: ResponseRoom{
+			Id:          room.Id,
+			Name:        room.Name,
+			Topic:       room.Topic,
+			Description: room.Description,
+			AvatarUrl:   room.AvatarUrl,
+			Visibility:  room.Visibility,
+			Kind:        room.Kind,
+			UpdatedAt:   room.UpdatedAt,
+			Role:        role,
+		},
+	}, nil
+}
+
+// HandleDeleteRoom deletes the room with its messages, members and invites.
+// Only the owner may. Subscribers get a room_deleted event, after which
+// their subscriptions to the room end.
+func (srv *RoomService) HandleDeleteRoom(ctx context.Context, payload DeleteRoomPayload) error {
+	if _, err := srv.permissions.Require(ctx, payload.RoomId, payload.UserId, PermissionManageRoom); err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+
+	// The attachment rows go with the room, so note their blobs first
+	var attachments []models.Attachment
+	if srv.attachments != nil {
+		var err error
+		attachments, err = srv.attachments.HandleGetRoomAttachments(ctx, payload.RoomId)
+		if err != nil {
+			return fmt.Errorf("delete room: %w", err)
+		}
+	}
+
+	if err := srv.roomStore.Delete(ctx, payload.RoomId); err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+
+	if srv.attachments != nil {
+		srv.attachments.HandleDeleteAttachmentBlobs(context.WithoutCancel(ctx), attachments)
+	}
+
+	srv.hub.Broadcast(payload.RoomId, &models.RoomDeletedEvent{
+		Data: models.RoomDeletedPayload{
+			RoomId:    payload.RoomId,
+			DeletedBy: payload.UserId,
+		},
+	})
+
+	return nil
+}
+
+// displayName is what the viewer sees the room called. A DM has no name of
+// its own and goes by its other participants.
+func displayName(room *models.Room, members []*models.User, viewer models.UserId) string {
+	if room.Kind != models.RoomKindDM {
+		return room.Name
+	}
+
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.Id != viewer {
+			names = append(names, member.Name)
+		}
+	}
+
+	// Everyone else has left
+	if len(names) == 0 {
+		for _, member := range members {
+			names = append(names, member.Name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// dmKey identifies a DM by its participants, whatever order they come in.
+func dmKey(participants []models.UserId) string {
+	ids := make([]string, len(participants))
+	for i, userId := range participants {
+		ids[i] = strconv.FormatInt(userId, 10)
+	}
+	return strings.Join(ids, ":")
+}
+
+// HandleCreateDM returns the caller's DM with the given users, making it if
+// they have none. Participants who had left the DM are brought back into it.
+func (srv *RoomService) HandleCreateDM(ctx context.Context, payload CreateDMPayload) (CreateDMResponse, error) {
+	participants := append([]models.UserId{payload.UserId}, payload.UserIds...)
+	slices.Sort(participants)
+	participants = slices.Compact(participants)
+
+	if len(participants) < 2 || len(participants) > maxDMParticipants {
+		return CreateDMResponse{}, models.ErrInvalidInput
+	}
+
+	key := dmKey(participants)
+
+	// joined are the participants who were not in the DM before
+	var joined []models.UserId
+
+	room, err := srv.roomStore.GetByDmKey(ctx, key)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		room, err = srv.roomStore.CreateDM(ctx, key, participants)
+		if err != nil {
+			return CreateDMResponse{}, fmt.Errorf("create dm: %w", err)
+		}
+		joined = participants
+
+	case err != nil:
+		return CreateDMResponse{}, fmt.Errorf("create dm: %w", err)
+
+	default:
+		for _, userId := range participants {
+			member, err := srv.roomMemberStore.Exists(ctx, room.Id, userId)
+			if err != nil {
+				return CreateDMResponse{}, fmt.Errorf("create dm: %w", err)
+			}
+			if member {
+				continue
+			}
+
+			if err := srv.roomMemberStore.JoinRoom(ctx, room.Id, userId); err != nil {
+				return CreateDMResponse{}, fmt.Errorf("create dm: %w", err)
+			}
+			joined = append(joined, userId)
+		}
+	}
+
+	for _, userId := range joined {
+		if userId == payload.UserId {
+			continue
+		}
+
+		srv.hub.BroadcastToUser(userId, &models.DMCreatedEvent{
+			Data: models.DMCreatedPayload{
+				RoomId:       room.Id,
+				Participants: participants,
+				CreatedBy:    payload.UserId,
+			},
+		})
+	}
+
+	members, err := srv.roomMemberStore.GetRoomMembers(ctx, room.Id)
+	if err != nil {
+		return CreateDMResponse{}, fmt.Errorf("create dm get members=%d: %w", room.Id, err)
+	}
+
+	responseMembers := make([]*models.ResponseUser, len(members))
+	for i, member := range members {
+		responseMembers[i] = &models.ResponseUser{
+			Id:          member.Id,
+			Username:    member.Username,
+			Name:        member.Name,
+			IsAnonymous: member.AccountRole == models.AccountRoleGuest,
+			Role:        models.RoomRoleMember,
+		}
+	}
+
+	return CreateDMResponse{
+		Room: ResponseRoom{
+			Id:               room.Id,
+			Name:             displayName(room, members, payload.UserId),
+			Visibility:       room.Visibility,
+			Kind:             room.Kind,
+			ParticipantCount: len(responseMembers),
+			UpdatedAt:        room.UpdatedAt,
+			Members:          responseMembers,
+			Role:             models.RoomRoleMember,
+		},
+	}, nil
+}
+
+// encodeDirectoryCursor marks where the next directory page starts as the
+// sort value and id of the last room listed.
+func encodeDirectoryCursor(room *models.DirectoryRoom, sort DirectorySort) string {
+	value := int64(room.MemberCount)
+	if sort == DirectorySortActivity {
+		value = room.LastActivityAt.UnixMicro()
+	}
+	return fmt.Sprintf("%d_%d", value, room.Id)
+}
+
+func decodeDirectoryCursor(cursor string, sort DirectorySort) (*DirectoryCursor, error) {
+	valueStr, idStr, ok := strings.Cut(cursor, "_")
+	if !ok {
+		return nil, models.ErrInvalidInput
+	}
+
+	value, err := strconv.ParseInt(valueStr, 10, 64)
+	if err != nil {
+		return nil, models.ErrInvalidInput
+	}
+
+	id, err := models.ParseRoomId(idStr)
+	if err != nil {
+		return nil, models.ErrInvalidInput
+	}
+
+	after := &DirectoryCursor{Id: id}
+	if sort == DirectorySortActivity {
+		after.LastActivityAt = time.UnixMicro(value).UTC()
+	} else {
+		after.MemberCount = int(value)
+	}
+
+	return after, nil
+}
+
+// HandleGetDirectory lists the public rooms anyone may join, most members
+// or most recently active first.
+func (srv *RoomService) HandleGetDirectory(ctx context.Context, payload GetDirectoryPayload) (GetDirectoryResponse, error) {
+	sort := payload.Sort
+	if sort == "" {
+		sort = DirectorySortMembers
+	}
+
+	if !sort.IsValid() {
+		return GetDirectoryResponse{}, models.ErrInvalidInput
+	}
+
+	var after *DirectoryCursor
+	if payload.Cursor != nil && *payload.Cursor != "" {
+		var err error
+		after, err = decodeDirectoryCursor(*payload.Cursor, sort)
+		if err != nil {
+			return GetDirectoryResponse{}, err
+		}
+	}
+
+	rooms, err := srv.roomStore.GetDirectory(ctx, DirectoryQuery{
+		UserId: payload.UserId,
+		Search: strings.TrimSpace(payload.Search),
+		Sort:   sort,
+		After:  after,
+		Limit:  payload.Limit + 1,
+	})
+	if err != nil {
+		return GetDirectoryResponse{}, fmt.Errorf("get directory: %w", err)
+	}
+
+	var nextCursor *string
+	if len(rooms) > payload.Limit {
+		c := encodeDirectoryCursor(rooms[payload.Limit-1], sort)
+		nextCursor = &c
+		rooms = rooms[:payload.Limit]
+	}
+
+	responseRooms := make([]DirectoryRoom, len(rooms))
+	for i, room := range rooms {
+		responseRooms[i] = DirectoryRoom{
+			Id:             room.Id,
+			Name:           room.Name,
+			Topic:          room.Topic,
+			Description:    room.Description,
+			AvatarUrl:      room.AvatarUrl,
+			MemberCount:    room.MemberCount,
+			LastActivityAt: room.LastActivityAt,
+			Joined:         room.Joined,
+		}
+	}
+
+	return GetDirectoryResponse{
+		Rooms:      responseRooms,
+		NextCursor: nextCursor,
+	}, nil
+}
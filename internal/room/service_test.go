@@ -0,0 +1,65 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+func TestDisplayName(t *testing.T) {
+	members := []*models.User{
+		{Id: 1, Name: "Ann"},
+		{Id: 2, Name: "Bob"},
+		{Id: 3, Name: "Cat"},
+	}
+
+	tests := []struct {
+		name    string
+		room    models.Room
+		members []*models.User
+		viewer  models.UserId
+		want    string
+	}{
+		{"named room", models.Room{Name: "general", Kind: models.RoomKindRoom}, members, 1, "general"},
+		{"dm", models.Room{Kind: models.RoomKindDM}, members[:2], 1, "Bob"},
+		{"group dm", models.Room{Kind: models.RoomKindDM}, members, 2, "Ann, Cat"},
+		{"alone in dm", models.Room{Kind: models.RoomKindDM}, members[:1], 1, "Ann"},
+	}
+
+	for _, tt := range tests {
+		if got := displayName(&tt.room, tt.members, tt.viewer); got != tt.want {
+			t.Errorf("%s: displayName() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDmKey(t *testing.T) {
+	if got := dmKey([]models.UserId{2, 10, 31}); got != "2:10:31" {
+		t.Errorf("dmKey() = %q, want %q", got, "2:10:31")
+	}
+}
+
+func TestDirectoryCursorRoundTrip(t *testing.T) {
+	room := &models.DirectoryRoom{
+		Room:           models.Room{Id: 42},
+		MemberCount:    7,
+		LastActivityAt: time.Date(2026, 4, 30, 12, 0, 0, 123456000, time.UTC),
+	}
+
+	after, err := decodeDirectoryCursor(encodeDirectoryCursor(room, DirectorySortMembers), DirectorySortMembers)
+	if err != nil || after.Id != 42 || after.MemberCount != 7 {
+		t.Errorf("members cursor decoded to %+v, %v", after, err)
+	}
+
+	after, err = decodeDirectoryCursor(encodeDirectoryCursor(room, DirectorySortActivity), DirectorySortActivity)
+	if err != nil || after.Id != 42 || !after.LastActivityAt.Equal(room.LastActivityAt) {
+		t.Errorf("activity cursor decoded to %+v, %v", after, err)
+	}
+
+	for _, cursor := range []string{"", "7", "x_42", "7_x"} {
+		if _, err := decodeDirectoryCursor(cursor, DirectorySortMembers); err == nil {
+			t.Errorf("cursor %q should be rejected", cursor)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package room
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteInviteRepo struct {
+	db *sql.DB
+}
+
+func NewSQLiteInviteRepo(ctx context.Context, db *sql.DB) (*SQLiteInviteRepo, error) {
+	store := SQLiteInviteRepo{db}
+
+	if err := store.init(ctx); err != nil {
+		return nil, fmt.Errorf("initializing room_invites table: %w", err)
+	}
+
+	return &store, nil
+}
+
+func (s *SQLiteInviteRepo) init(ctx context.Context) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS room_invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		created_by INTEGER DEFAULT NULL,
+		expires_at DATETIME NOT NULL,
+		max_uses INTEGER DEFAULT NULL,
+		uses INTEGER NOT NULL DEFAULT 0,
+		revoked_at DATETIME DEFAULT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	createIndexSQL := "CREATE INDEX IF NOT EXISTS idx_room_invites_room_id ON room_invites(room_id);"
+
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("creating room_invites table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, createIndexSQL); err != nil {
+		return fmt.Errorf("creating room_invites index: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteInviteRepo) Create(ctx context.Context, roomId models.RoomId, token string, createdBy models.UserId, expiresAt time.Time, maxUses *int) (*models.RoomInvite, error) {
+	row := s.db.QueryRowContext(ctx,
+		`INSERT INTO room_invites(room_id, token, created_by, expires_at, max_uses)
+		VALUES(?, ?, ?, ?, ?) RETURNING `+inviteColumns,
+		roomId, token, createdBy, expiresAt.UTC().Format(time.DateTime), maxUses)
+
+	invite, err := scanInvite(row)
+	if err != nil {
+		return nil, fmt.Errorf("creating invite for room %d: %w", roomId, err)
+	}
+
+	return invite, nil
+}
+
+func (s *SQLiteInviteRepo) GetByToken(ctx context.Context, token string) (*models.RoomInvite, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+inviteColumns+" FROM room_invites WHERE token = ?", token)
+
+	invite, err := scanInvite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting invite by token: %w", err)
+	}
+
+	return invite, nil
+}
+
+func (s *SQLiteInviteRepo) GetByRoomId(ctx context.Context, roomId models.RoomId) ([]models.RoomInvite, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+inviteColumns+`
+	FROM room_invites
+	WHERE room_id = ?
+	ORDER BY created_at DESC, id DESC`, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("querying invites of room %d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	return scanInvites(rows)
+}
+
+func (s *SQLiteInviteRepo) Redeem(ctx context.Context, id models.RoomInviteId, now time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE room_invites SET uses = uses + 1
+		WHERE id = ?
+			AND revoked_at IS NULL
+			AND expires_at > ?
+			AND (max_uses IS NULL OR uses < max_uses)`,
+		id, now.UTC().Format(time.DateTime))
+	if err != nil {
+		return false, fmt.Errorf("redeeming invite %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for invite %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteInviteRepo) Revoke(ctx context.Context, roomId models.RoomId, id models.RoomInviteId) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE room_invites SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND room_id = ? AND revoked_at IS NULL",
+		id, roomId)
+	if err != nil {
+		return false, fmt.Errorf("revoking invite %d: %w", id, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected for invite %d: %w", id, err)
+	}
+
+	return count > 0, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/utils"
 	_ "modernc.org/sqlite"
 )
 
@@ -30,6 +31,8 @@ func (s *SQLiteRoomMemberRepo) init(ctx context.Context) error {
 		user_id INTEGER NOT NULL,
 		joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		last_message_read_id INTEGER DEFAULT 0,
+		role TEXT NOT NULL DEFAULT 'member'
+			CHECK(role IN ('owner', 'moderator', 'member')),
 		FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 		PRIMARY KEY (room_id, user_id)
@@ -41,6 +44,29 @@ func (s *SQLiteRoomMemberRepo) init(ctx context.Context) error {
 		return fmt.Errorf("create room_members table: %w", err)
 	}
 
+	addedRoles, err := utils.EnsureSQLiteColumn(ctx, s.db, "room_members", "role",
+		"TEXT NOT NULL DEFAULT 'member' CHECK(role IN ('owner', 'moderator', 'member'))")
+	if err != nil {
+		return fmt.Errorf("upgrade room_members table: %w", err)
+	}
+
+	// Rooms made before roles existed go to whoever joined them first
+	if addedRoles {
+		_, err := s.db.ExecContext(ctx, `UPDATE room_members SET role = 'owner'
+		WHERE (room_id, user_id) IN (
+			SELECT room_id, user_id FROM room_members m
+			WHERE user_id = (
+				SELECT user_id FROM room_members f
+				WHERE f.room_id = m.room_id
+				ORDER BY f.joined_at, f.user_id
+				LIMIT 1
+			)
+		)`)
+		if err != nil {
+			return fmt.Errorf("assign room_members owners: %w", err)
+		}
+	}
+
 	if _, err := s.db.ExecContext(ctx, createUserIdIndexSQL); err != nil {
 		return fmt.Errorf("create room_members user_id index: %w", err)
 	}
@@ -130,10 +156,50 @@ func (s *SQLiteRoomMemberRepo) GetByRoomId(ctx context.Context, roomId models.Ro
 	return ids, nil
 }
 
-func (s *SQLiteRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.Room, *string, error) {
-	query := `SELECT r.id, r.name, r.created_at, r.updated_at
+func (s *SQLiteRoomMemberRepo) GetRoomIdsByUserId(ctx context.Context, userId models.UserId) ([]models.RoomId, error) {
+	query := "SELECT room_id FROM room_members WHERE user_id = ?"
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get member rooms user_id=%d: %w", userId, err)
+	}
+	defer rows.Close()
+
+	var ids []models.RoomId
+	for rows.Next() {
+		var id models.RoomId
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan member room user_id=%d: %w", userId, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate member rooms user_id=%d: %w", userId, err)
+	}
+
+	return ids, nil
+}
+
+// GetRoomsByUserId lists the user's rooms along with their unread count and
+// latest message, all in one query. Thread replies count toward neither.
+func (s *SQLiteRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId models.UserId, limit int, cursor *string) ([]*models.RoomSummary, *string, error) {
+	query := `SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at,
+		(
+			SELECT COUNT(*) FROM messages m
+			WHERE m.room_id = r.id
+				AND m.id > COALESCE(rm.last_message_read_id, 0)
+				AND m.user_id <> rm.user_id
+				AND m.parent_id IS NULL
+				AND m.deleted_at IS NULL
+		) AS unread_count,
+		lm.id, lm.content, lm.user_id, lu.name, lm.created_at
 	FROM rooms r
 	JOIN room_members rm ON r.id = rm.room_id
+	LEFT JOIN messages lm ON lm.id = (
+		SELECT MAX(m.id) FROM messages m WHERE m.room_id = r.id AND m.parent_id IS NULL AND m.deleted_at IS NULL
+	)
+	LEFT JOIN users lu ON lu.id = lm.user_id
 	WHERE rm.user_id = ?`
 
 	args := []any{userId}
@@ -152,13 +218,49 @@ func (s *SQLiteRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId mode
 	}
 	defer rows.Close()
 
-	var rooms []*models.Room
+	var rooms []*models.RoomSummary
 	for rows.Next() {
-		room := &models.Room{}
-		err := rows.Scan(&room.Id, &room.Name, &room.CreatedAt, &room.UpdatedAt)
+		room := &models.RoomSummary{}
+		var lastId sql.NullInt64
+		var lastContent, lastSenderName sql.NullString
+		var lastSenderId sql.NullInt64
+		var lastSentAt sql.NullTime
+
+		err := rows.Scan(
+			&room.Id,
+			&room.Name,
+			&room.Topic,
+			&room.Description,
+			&room.AvatarUrl,
+			&room.Visibility,
+			&room.Kind,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.UnreadCount,
+			&lastId,
+			&lastContent,
+			&lastSenderId,
+			&lastSenderName,
+			&lastSentAt,
+		)
 		if err != nil {
 			return nil, nil, fmt.Errorf("scanning rooms for user %d: %w", userId, err)
 		}
+
+		room.LastActivityAt = room.UpdatedAt
+		if lastId.Valid {
+			room.LastMessage = &models.MessagePreview{
+				Id:         lastId.Int64,
+				Content:    lastContent.String,
+				SenderId:   lastSenderId.Int64,
+				SenderName: lastSenderName.String,
+				SentAt:     lastSentAt.Time,
+			}
+			if lastSentAt.Time.After(room.LastActivityAt) {
+				room.LastActivityAt = lastSentAt.Time
+			}
+		}
+
 		rooms = append(rooms, room)
 	}
 
@@ -177,24 +279,23 @@ func (s *SQLiteRoomMemberRepo) GetRoomsByUserId(ctx context.Context, userId mode
 	return rooms, nextCursor, nil
 }
 
-func (s *SQLiteRoomMemberRepo) UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) error {
+// UpdateLastMessageRead only ever moves the read marker forward and reports
+// whether it moved.
+func (s *SQLiteRoomMemberRepo) UpdateLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId, messageId models.MessageId) (bool, error) {
 	res, err := s.db.ExecContext(ctx,
-		"UPDATE room_members SET last_message_read_id = ? WHERE room_id = ? AND user_id = ?",
-		messageId, roomId, userId)
+		`UPDATE room_members SET last_message_read_id = ?
+		WHERE room_id = ? AND user_id = ? AND COALESCE(last_message_read_id, 0) < ?`,
+		messageId, roomId, userId, messageId)
 	if err != nil {
-		return fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, err)
+		return false, fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("checking rows affected for update last message read %d: %w", roomId, err)
+		return false, fmt.Errorf("checking rows affected for update last message read %d: %w", roomId, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("update last message read room_id=%d user_id=%d: %w", roomId, userId, models.ErrNotFound)
-	}
-
-	return nil
+	return rowsAffected > 0, nil
 }
 
 func (s *SQLiteRoomMemberRepo) GetLastMessageRead(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.MessageId, error) {
@@ -242,3 +343,121 @@ func (s *SQLiteRoomMemberRepo) GetRoomMembers(ctx context.Context, roomId models
 
 	return members, nil
 }
+
+// CountUnreadByRoomId returns how many top-level messages from others each
+// member of the room has not read yet.
+func (s *SQLiteRoomMemberRepo) CountUnreadByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]int, error) {
+	query := `SELECT rm.user_id, COUNT(m.id)
+	FROM room_members rm
+	LEFT JOIN messages m ON m.room_id = rm.room_id
+		AND m.id > COALESCE(rm.last_message_read_id, 0)
+		AND m.user_id <> rm.user_id
+		AND m.parent_id IS NULL
+		AND m.deleted_at IS NULL
+	WHERE rm.room_id = ?
+	GROUP BY rm.user_id`
+
+	rows, err := s.db.QueryContext(ctx, query, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("count unread room_id=%d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[models.UserId]int)
+	for rows.Next() {
+		var userId models.UserId
+		var count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, fmt.Errorf("scan unread count room_id=%d: %w", roomId, err)
+		}
+		counts[userId] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate unread counts room_id=%d: %w", roomId, err)
+	}
+
+	return counts, nil
+}
+
+func (s *SQLiteRoomMemberRepo) GetRole(ctx context.Context, roomId models.RoomId, userId models.UserId) (models.RoomRole, error) {
+	query := "SELECT role FROM room_members WHERE room_id = ? AND user_id = ?"
+	var role models.RoomRole
+
+	err := s.db.QueryRowContext(ctx, query, roomId, userId).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("get role room_id=%d user_id=%d: %w", roomId, userId, models.ErrNotFound)
+		}
+		return "", fmt.Errorf("get role room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	return role, nil
+}
+
+func (s *SQLiteRoomMemberRepo) GetRolesByRoomId(ctx context.Context, roomId models.RoomId) (map[models.UserId]models.RoomRole, error) {
+	query := "SELECT user_id, role FROM room_members WHERE room_id = ?"
+
+	rows, err := s.db.QueryContext(ctx, query, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("get roles room_id=%d: %w", roomId, err)
+	}
+	defer rows.Close()
+
+	roles := make(map[models.UserId]models.RoomRole)
+	for rows.Next() {
+		var userId models.UserId
+		var role models.RoomRole
+		if err := rows.Scan(&userId, &role); err != nil {
+			return nil, fmt.Errorf("scan role room_id=%d: %w", roomId, err)
+		}
+		roles[userId] = role
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate roles room_id=%d: %w", roomId, err)
+	}
+
+	return roles, nil
+}
+
+func (s *SQLiteRoomMemberRepo) SetRole(ctx context.Context, roomId models.RoomId, userId models.UserId, role models.RoomRole) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?",
+		role, roomId, userId)
+	if err != nil {
+		return false, fmt.Errorf("set role room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set role rows affected room_id=%d user_id=%d: %w", roomId, userId, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *SQLiteRoomMemberRepo) PromoteSuccessor(ctx context.Context, roomId models.RoomId) (*models.UserId, error) {
+	query := `UPDATE room_members SET role = 'owner'
+	WHERE room_id = ?
+		AND user_id = (
+			SELECT user_id FROM room_members
+			WHERE room_id = ?
+			ORDER BY CASE role WHEN 'moderator' THEN 0 ELSE 1 END, joined_at, user_id
+			LIMIT 1
+		)
+		AND NOT EXISTS (SELECT 1 FROM room_members WHERE room_id = ? AND role = 'owner')
+	RETURNING user_id`
+
+	var userId models.UserId
+
+	err := s.db.QueryRowContext(ctx, query, roomId, roomId, roomId).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("promote successor room_id=%d: %w", roomId, err)
+	}
+
+	return &userId, nil
+}
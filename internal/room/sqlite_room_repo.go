@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/ayushgpt01/chatRoomGo/utils"
 	_ "modernc.org/sqlite"
 )
 
@@ -28,6 +31,14 @@ func (s *SQLiteRoomRepo) init(ctx context.Context) error {
 	createTableSQL := `CREATE TABLE IF NOT EXISTS rooms(
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT,
+		topic TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		visibility TEXT NOT NULL DEFAULT 'public'
+			CHECK(visibility IN ('public', 'private')),
+		kind TEXT NOT NULL DEFAULT 'room'
+			CHECK(kind IN ('room', 'dm')),
+		dm_key TEXT DEFAULT NULL UNIQUE,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -42,6 +53,27 @@ func (s *SQLiteRoomRepo) init(ctx context.Context) error {
 		return fmt.Errorf("creating rooms table: %w", err)
 	}
 
+	// Columns added since the rooms table was first created
+	addedColumns := []struct{ name, definition string }{
+		{"visibility", "TEXT NOT NULL DEFAULT 'public' CHECK(visibility IN ('public', 'private'))"},
+		{"topic", "TEXT NOT NULL DEFAULT ''"},
+		{"description", "TEXT NOT NULL DEFAULT ''"},
+		{"avatar_url", "TEXT NOT NULL DEFAULT ''"},
+		{"kind", "TEXT NOT NULL DEFAULT 'room' CHECK(kind IN ('room', 'dm'))"},
+		{"dm_key", "TEXT DEFAULT NULL"},
+	}
+
+	for _, column := range addedColumns {
+		if _, err := utils.EnsureSQLiteColumn(ctx, s.db, "rooms", column.name, column.definition); err != nil {
+			return fmt.Errorf("upgrading rooms table: %w", err)
+		}
+	}
+
+	// An added dm_key cannot carry its UNIQUE constraint, so an index does
+	if _, err := s.db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS uq_rooms_dm_key ON rooms(dm_key)"); err != nil {
+		return fmt.Errorf("creating rooms dm_key index: %w", err)
+	}
+
 	if _, err := s.db.ExecContext(ctx, createTriggerSQL); err != nil {
 		return fmt.Errorf("creating update_room_timestamp trigger: %w", err)
 	}
@@ -49,8 +81,14 @@ func (s *SQLiteRoomRepo) init(ctx context.Context) error {
 	return nil
 }
 
-func (s *SQLiteRoomRepo) Create(ctx context.Context, name string) (*models.Room, error) {
-	res, err := s.db.ExecContext(ctx, "INSERT INTO rooms(name) VALUES(?)", name)
+func (s *SQLiteRoomRepo) Create(ctx context.Context, name string, visibility models.RoomVisibility, ownerId models.UserId) (*models.Room, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin creating room %q: %w", name, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO rooms(name, visibility) VALUES(?, ?)", name, visibility)
 	if err != nil {
 		return nil, fmt.Errorf("inserting room with name %q: %w", name, err)
 	}
@@ -60,6 +98,15 @@ func (s *SQLiteRoomRepo) Create(ctx context.Context, name string) (*models.Room,
 		return nil, fmt.Errorf("getting last insert id for room %q: %w", name, err)
 	}
 
+	_, err = tx.ExecContext(ctx, "INSERT INTO room_members(room_id, user_id, role) VALUES(?, ?, ?)", roomId, ownerId, models.RoomRoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("adding owner %d to room %d: %w", ownerId, roomId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit room %q: %w", name, err)
+	}
+
 	room, err := s.GetById(ctx, roomId)
 	if err != nil {
 		return nil, fmt.Errorf("fetching created room %d: %w", roomId, err)
@@ -72,12 +119,12 @@ func (s *SQLiteRoomRepo) GetById(ctx context.Context, roomId models.RoomId) (*mo
 	var room models.Room
 
 	row := s.db.QueryRowContext(ctx, `
-		SELECT r.id, r.name, r.created_at, r.updated_at
+		SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at
 		FROM rooms r 
 		WHERE r.id = ?
 	`, roomId)
 
-	err := row.Scan(&room.Id, &room.Name, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("getting room by id %d: %w", roomId, models.ErrNotFound)
@@ -88,26 +135,52 @@ func (s *SQLiteRoomRepo) GetById(ctx context.Context, roomId models.RoomId) (*mo
 	return &room, nil
 }
 
-func (s *SQLiteRoomRepo) UpdateName(ctx context.Context, roomId models.RoomId, name string) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE rooms SET name = ? WHERE id = ?", name, roomId)
+func (s *SQLiteRoomRepo) Update(ctx context.Context, roomId models.RoomId, update RoomUpdate) (*models.Room, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE rooms SET
+			name = COALESCE(?, name),
+			topic = COALESCE(?, topic),
+			description = COALESCE(?, description),
+			avatar_url = COALESCE(?, avatar_url),
+			visibility = COALESCE(?, visibility)
+		WHERE id = ?
+	`, update.Name, update.Topic, update.Description, update.AvatarUrl, update.Visibility, roomId)
 	if err != nil {
-		return fmt.Errorf("updating room name for id %d: %w", roomId, err)
+		return nil, fmt.Errorf("updating room %d: %w", roomId, err)
 	}
 
 	count, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("checking rows affected for update room %d: %w", roomId, err)
+		return nil, fmt.Errorf("checking rows affected for update room %d: %w", roomId, err)
 	}
 
 	if count == 0 {
-		return fmt.Errorf("updating room name for id %d: %w", roomId, models.ErrNotFound)
+		return nil, fmt.Errorf("updating room %d: %w", roomId, models.ErrNotFound)
 	}
 
-	return nil
+	// Re-read so updated_at reflects the timestamp trigger
+	room, err := s.GetById(ctx, roomId)
+	if err != nil {
+		return nil, fmt.Errorf("fetching updated room %d: %w", roomId, err)
+	}
+
+	return room, nil
 }
 
 func (s *SQLiteRoomRepo) Delete(ctx context.Context, roomId models.RoomId) error {
-	res, err := s.db.ExecContext(ctx, "DELETE FROM rooms WHERE id = ?", roomId)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin deleting room %d: %w", roomId, err)
+	}
+	defer tx.Rollback()
+
+	// Messages tables created before rooms could be deleted restrict it
+	// rather than cascade, so clear them out first
+	if _, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE room_id = ?", roomId); err != nil {
+		return fmt.Errorf("deleting messages of room %d: %w", roomId, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM rooms WHERE id = ?", roomId)
 	if err != nil {
 		return fmt.Errorf("deleting room by id %d: %w", roomId, err)
 	}
@@ -121,5 +194,174 @@ func (s *SQLiteRoomRepo) Delete(ctx context.Context, roomId models.RoomId) error
 		return fmt.Errorf("deleting room by id %d: %w", roomId, models.ErrNotFound)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit deleting room %d: %w", roomId, err)
+	}
+
 	return nil
 }
+
+func (s *SQLiteRoomRepo) GetByDmKey(ctx context.Context, dmKey string) (*models.Room, error) {
+	var room models.Room
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at
+		FROM rooms r
+		WHERE r.dm_key = ?
+	`, dmKey)
+
+	err := row.Scan(&room.Id, &room.Name, &room.Topic, &room.Description, &room.AvatarUrl, &room.Visibility, &room.Kind, &room.CreatedAt, &room.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("getting dm %q: %w", dmKey, models.ErrNotFound)
+		}
+		return nil, fmt.Errorf("scanning dm %q: %w", dmKey, err)
+	}
+
+	return &room, nil
+}
+
+func (s *SQLiteRoomRepo) CreateDM(ctx context.Context, dmKey string, participants []models.UserId) (*models.Room, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin creating dm %q: %w", dmKey, err)
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(participants)), ", ")
+	args := make([]any, len(participants))
+	for i, userId := range participants {
+		args[i] = userId
+	}
+
+	var found int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id IN ("+placeholders+")", args...).Scan(&found)
+	if err != nil {
+		return nil, fmt.Errorf("checking participants of dm %q: %w", dmKey, err)
+	}
+
+	if found != len(participants) {
+		return nil, fmt.Errorf("creating dm %q: %w", dmKey, models.ErrNotFound)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO rooms(name, visibility, kind, dm_key) VALUES('', ?, ?, ?) ON CONFLICT (dm_key) DO NOTHING",
+		models.RoomVisibilityPrivate, models.RoomKindDM, dmKey)
+	if err != nil {
+		return nil, fmt.Errorf("inserting dm %q: %w", dmKey, err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("checking rows affected for dm %q: %w", dmKey, err)
+	}
+
+	// Someone else made it first
+	if count == 0 {
+		tx.Rollback()
+		return s.GetByDmKey(ctx, dmKey)
+	}
+
+	roomId, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("getting last insert id for dm %q: %w", dmKey, err)
+	}
+
+	for _, userId := range participants {
+		_, err := tx.ExecContext(ctx, "INSERT INTO room_members(room_id, user_id) VALUES(?, ?)", roomId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("adding user %d to dm %d: %w", userId, roomId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit dm %q: %w", dmKey, err)
+	}
+
+	return s.GetById(ctx, roomId)
+}
+
+func (s *SQLiteRoomRepo) GetDirectory(ctx context.Context, query DirectoryQuery) ([]*models.DirectoryRoom, error) {
+	// SQLite lets WHERE and ORDER BY use the computed column aliases
+	sqlQuery := `SELECT r.id, r.name, r.topic, r.description, r.avatar_url, r.visibility, r.kind, r.created_at, r.updated_at,
+		(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id) AS member_count,
+		MAX(r.updated_at, COALESCE((
+			SELECT MAX(m.created_at) FROM messages m
+			WHERE m.room_id = r.id AND m.deleted_at IS NULL
+		), r.updated_at)) AS last_activity_at,
+		EXISTS(
+			SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = ?
+		) AS joined
+	FROM rooms r
+	WHERE r.kind = ? AND r.visibility = ?`
+
+	args := []any{query.UserId, models.RoomKindRoom, models.RoomVisibilityPublic}
+
+	if query.Search != "" {
+		pattern := likePattern(query.Search)
+		args = append(args, pattern, pattern)
+		sqlQuery += ` AND (r.name LIKE ? ESCAPE '\' OR r.topic LIKE ? ESCAPE '\')`
+	}
+
+	sortColumn := "member_count"
+	if query.Sort == DirectorySortActivity {
+		sortColumn = "last_activity_at"
+	}
+
+	if query.After != nil {
+		var after any = query.After.MemberCount
+		if query.Sort == DirectorySortActivity {
+			after = query.After.LastActivityAt.UTC().Format(time.DateTime)
+		}
+
+		args = append(args, after, query.After.Id)
+		sqlQuery += fmt.Sprintf(" AND (%s, r.id) < (?, ?)", sortColumn)
+	}
+
+	args = append(args, query.Limit)
+	sqlQuery += fmt.Sprintf(" ORDER BY %s DESC, r.id DESC LIMIT ?", sortColumn)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying room directory: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []*models.DirectoryRoom{}
+	for rows.Next() {
+		var room models.DirectoryRoom
+		// A computed column comes back as text rather than a time
+		var lastActivityAt string
+
+		err := rows.Scan(
+			&room.Id,
+			&room.Name,
+			&room.Topic,
+			&room.Description,
+			&room.AvatarUrl,
+			&room.Visibility,
+			&room.Kind,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.MemberCount,
+			&lastActivityAt,
+			&room.Joined,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning room directory: %w", err)
+		}
+
+		room.LastActivityAt, err = time.Parse(time.DateTime, lastActivityAt)
+		if err != nil {
+			return nil, fmt.Errorf("parsing last activity of room %d: %w", room.Id, err)
+		}
+
+		rooms = append(rooms, &room)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating room directory: %w", err)
+	}
+
+	return rooms, nil
+}
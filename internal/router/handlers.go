@@ -5,10 +5,11 @@ import (
 
 	"github.com/ayushgpt01/chatRoomGo/internal/auth"
 	"github.com/ayushgpt01/chatRoomGo/internal/message"
+	"github.com/ayushgpt01/chatRoomGo/internal/presence"
 	"github.com/ayushgpt01/chatRoomGo/internal/room"
 )
 
-func handleAPIRoutes(mux *http.ServeMux, authService *auth.AuthService, roomService *room.RoomService, messageService *message.MessageService) {
+func handleAPIRoutes(mux *http.ServeMux, authService *auth.AuthService, roomService *room.RoomService, messageService *message.MessageService, scheduleService *message.ScheduleService, presenceService *presence.PresenceService) {
 	apiMux := http.NewServeMux()
 
 	// Public Routes
@@ -27,10 +28,36 @@ func handleAPIRoutes(mux *http.ServeMux, authService *auth.AuthService, roomServ
 	protectedMux.Handle("POST /room/leave", room.HandleLeaveRoom(roomService))
 	protectedMux.Handle("GET /room/getAll", room.HandleGetRooms(roomService))
 	protectedMux.Handle("POST /room/create", room.HandleCreateRoom(roomService))
+	protectedMux.Handle("GET /rooms/directory", room.HandleGetDirectory(roomService))
+	protectedMux.Handle("POST /dm", room.HandleCreateDM(roomService))
+	protectedMux.Handle("PATCH /room/{roomId}", room.HandleUpdateRoom(roomService))
+	protectedMux.Handle("DELETE /room/{roomId}", room.HandleDeleteRoom(roomService))
+	protectedMux.Handle("PUT /room/{roomId}/members/{userId}/role", room.HandleSetRole(roomService))
+	protectedMux.Handle("GET /room/{roomId}/invites", room.HandleGetInvites(roomService))
+	protectedMux.Handle("POST /room/{roomId}/invites", room.HandleCreateInvite(roomService))
+	protectedMux.Handle("DELETE /room/{roomId}/invites/{inviteId}", room.HandleRevokeInvite(roomService))
+	protectedMux.Handle("GET /room/{roomId}/presence", presence.HandleGetPresence(presenceService))
 	protectedMux.Handle("GET /room/{roomId}/messages", message.HandleGetMessages(messageService))
 	protectedMux.Handle("POST /room/{roomId}/messages", message.HandleSendMessage(messageService))
+	protectedMux.Handle("GET /room/{roomId}/messages/{messageId}/replies", message.HandleGetReplies(messageService))
+	protectedMux.Handle("POST /room/{roomId}/messages/{messageId}/replies", message.HandleSendReply(messageService))
+	protectedMux.Handle("GET /room/{roomId}/messages/{messageId}/history", message.HandleGetHistory(messageService))
 	protectedMux.Handle("PATCH /room/{roomId}/messages/{messageId}", message.HandleEditMessage(messageService))
 	protectedMux.Handle("DELETE /room/{roomId}/messages/{messageId}", message.HandleDeleteMessage(messageService))
+	protectedMux.Handle("PUT /room/{roomId}/messages/{messageId}/reactions/{emoji}", message.HandleReact(messageService))
+	protectedMux.Handle("DELETE /room/{roomId}/messages/{messageId}/reactions/{emoji}", message.HandleUnreact(messageService))
+	protectedMux.Handle("GET /room/{roomId}/pins", message.HandleGetPins(messageService))
+	protectedMux.Handle("PUT /room/{roomId}/messages/{messageId}/pin", message.HandlePin(messageService))
+	protectedMux.Handle("DELETE /room/{roomId}/messages/{messageId}/pin", message.HandleUnpin(messageService))
+	protectedMux.Handle("GET /room/{roomId}/scheduled", message.HandleGetScheduled(scheduleService))
+	protectedMux.Handle("POST /room/{roomId}/scheduled", message.HandleScheduleMessage(scheduleService))
+	protectedMux.Handle("PATCH /room/{roomId}/scheduled/{scheduledId}", message.HandleEditScheduled(scheduleService))
+	protectedMux.Handle("DELETE /room/{roomId}/scheduled/{scheduledId}", message.HandleCancelScheduled(scheduleService))
+	protectedMux.Handle("POST /room/{roomId}/attachments", message.HandleUploadAttachment(messageService))
+	protectedMux.Handle("GET /attachments/{attachmentId}", message.HandleDownloadAttachment(messageService, false))
+	protectedMux.Handle("GET /attachments/{attachmentId}/thumbnail", message.HandleDownloadAttachment(messageService, true))
+	protectedMux.Handle("POST /room/{roomId}/read", message.HandleMarkAsRead(messageService))
+	protectedMux.Handle("GET /search/messages", message.HandleSearchMessages(messageService))
 
 	apiMux.Handle("/", authService.Middleware(protectedMux))
 
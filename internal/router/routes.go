@@ -7,6 +7,7 @@ import (
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/message"
 	"github.com/ayushgpt01/chatRoomGo/internal/middleware"
+	"github.com/ayushgpt01/chatRoomGo/internal/presence"
 	"github.com/ayushgpt01/chatRoomGo/internal/room"
 	"github.com/ayushgpt01/chatRoomGo/internal/ws"
 	"github.com/rs/cors"
@@ -27,12 +28,12 @@ func recoverMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func HandleRoutes(wsHandler *ws.Wshandler, authService *auth.AuthService, roomService *room.RoomService, messageService *message.MessageService) http.Handler {
+func HandleRoutes(wsHandler *ws.Wshandler, authService *auth.AuthService, roomService *room.RoomService, messageService *message.MessageService, scheduleService *message.ScheduleService, presenceService *presence.PresenceService) http.Handler {
 	logger.Info("Setting up routes...")
 
 	mux := http.NewServeMux()
 
-	handleAPIRoutes(mux, authService, roomService, messageService)
+	handleAPIRoutes(mux, authService, roomService, messageService, scheduleService, presenceService)
 	handleViews(mux)
 	mux.Handle("/ws", wsHandler)
 
@@ -61,8 +61,8 @@ func SeedChatData(ctx context.Context, db *sql.DB) error {
 
 	// ---- Join Users to Room ----
 	_, err = tx.ExecContext(ctx, `
-        INSERT INTO room_members (room_id, user_id)
-        VALUES ($1, $2), ($1, $3)
+        INSERT INTO room_members (room_id, user_id, role)
+        VALUES ($1, $2, 'owner'), ($1, $3, 'member')
     `, roomID, aliceID, bobID)
 	if err != nil {
 		return fmt.Errorf("seeding members: %w", err)
@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+)
+
+// LocalBroadcaster delivers events straight to this process's hub. It is
+// enough when a single server instance owns every socket.
+type LocalBroadcaster struct {
+	hub *Hub
+}
+
+func NewLocalBroadcaster(hub *Hub) *LocalBroadcaster {
+	return &LocalBroadcaster{hub}
+}
+
+func (b *LocalBroadcaster) Broadcast(roomId models.RoomId, evt models.ChatEvent) error {
+	return b.hub.Broadcast(roomId, evt)
+}
+
+func (b *LocalBroadcaster) BroadcastToUser(userId models.UserId, evt models.ChatEvent) error {
+	b.hub.SendToUser(userId, evt)
+	return nil
+}
+
+// broadcastEnvelope is the wire format used to hand an event to other
+// server instances. It targets either a room or, when UserId is set, every
+// socket of that user. An envelope too large to send directly is stored
+// and only its StoredId is sent.
+type broadcastEnvelope struct {
+	RoomId   models.RoomId   `json:"roomId,omitempty"`
+	UserId   models.UserId   `json:"userId,omitempty"`
+	StoredId int64           `json:"storedId,omitempty"`
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// remoteEvent is an event received from another instance. Its payload is
+// already JSON and is written to the sockets unchanged.
+type remoteEvent struct {
+	eventType string
+	payload   json.RawMessage
+}
+
+func (e *remoteEvent) Type() string {
+	return e.eventType
+}
+
+func (e *remoteEvent) Payload() any {
+	return e.payload
+}
+
+// decodeEnvelope rebuilds the typed events the hub itself reacts to and
+// passes everything else through as a remoteEvent.
+func decodeEnvelope(env broadcastEnvelope) models.ChatEvent {
+	switch models.OutgoingEventType(env.Type) {
+	case models.EventUserLeftRoom:
+		var data models.UserLeftRoomPayload
+		if err := json.Unmarshal(env.Payload, &data); err == nil {
+			return &models.UserLeftRoomEvent{Data: data}
+		}
+	case models.EventRoomDeleted:
+		var data models.RoomDeletedPayload
+		if err := json.Unmarshal(env.Payload, &data); err == nil {
+			return &models.RoomDeletedEvent{Data: data}
+		}
+	}
+
+	return &remoteEvent{eventType: env.Type, payload: env.Payload}
+}
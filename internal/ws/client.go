@@ -2,8 +2,11 @@ package ws
 
 import (
 	"encoding/json"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ayushgpt01/chatRoomGo/internal/auth"
 	"github.com/ayushgpt01/chatRoomGo/internal/event"
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
@@ -11,10 +14,50 @@ import (
 )
 
 type Client struct {
-	id     models.UserId
-	roomID models.RoomId
-	conn   *websocket.Conn
-	send   chan models.ChatEvent
+	id   models.UserId
+	conn *websocket.Conn
+	send chan models.ChatEvent
+	// done is closed once the write pump has stopped
+	done chan struct{}
+
+	// expiresAt is the expiry of the access token the socket was opened
+	// with; refresh carries the expiry of a token sent via auth.refresh.
+	expiresAt time.Time
+	refresh   chan time.Time
+
+	// slowSince is when a broadcast first found the send queue full, in
+	// unix nanoseconds, or zero while the client keeps up.
+	slowSince atomic.Int64
+	kicked    chan closeFrame
+	kickOnce  sync.Once
+}
+
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+func newClient(userID models.UserId, conn *websocket.Conn, queueSize int, expiresAt time.Time) *Client {
+	return &Client{
+		id:        userID,
+		conn:      conn,
+		send:      make(chan models.ChatEvent, queueSize),
+		done:      make(chan struct{}),
+		expiresAt: expiresAt,
+		refresh:   make(chan time.Time, 1),
+		kicked:    make(chan closeFrame, 1),
+	}
+}
+
+// kick asks the write pump to close the socket with the given close code.
+// It reports whether this call was the one that triggered the close.
+func (c *Client) kick(code int, reason string) bool {
+	kicked := false
+	c.kickOnce.Do(func() {
+		c.kicked <- closeFrame{code, reason}
+		kicked = true
+	})
+	return kicked
 }
 
 type connectedEvent struct {
@@ -28,8 +71,8 @@ func (e *connectedEvent) Payload() any {
 	return nil
 }
 
-func (c *Client) readPump(hub *Hub, chatService *event.EventService) {
-	log := logger.WithUserID(int(c.id)).With("room_id", int(c.roomID))
+func (c *Client) readPump(hub *Hub, broadcaster models.HubBroadcaster, chatService *event.EventService, authService *auth.AuthService) {
+	log := logger.WithUserID(int(c.id))
 
 	log.Info("websocket_read_pump_started")
 
@@ -44,7 +87,7 @@ func (c *Client) readPump(hub *Hub, chatService *event.EventService) {
 
 	defer func() {
 		log.Info("websocket_read_pump_ending")
-		hub.UnregisterClient(c.roomID, c)
+		hub.Disconnect(c)
 		c.conn.Close()
 	}()
 
@@ -55,6 +98,8 @@ func (c *Client) readPump(hub *Hub, chatService *event.EventService) {
 			return
 		}
 
+		hub.Active(c)
+
 		log.Debug("websocket_message_received",
 			"message_size", len(data),
 			"payload", string(data),
@@ -76,34 +121,141 @@ func (c *Client) readPump(hub *Hub, chatService *event.EventService) {
 			"payload_size", len(data),
 		)
 
-		evt, err := chatService.HandleIncoming(hub.ctx, c.roomID, c.id, msg)
+		switch models.IncomingEventType(msg.Type) {
+		case models.EventRefreshAuth:
+			if err := c.refreshAuth(authService, msg); err != nil {
+				log.Warn("websocket_auth_refresh_failed",
+					"error", err.Error(),
+				)
+				c.reply(event.NewErrorEvent(err))
+			}
+			continue
+
+		case models.EventSubscribe:
+			// The room acknowledges the subscription itself
+			if err := c.subscribe(hub, chatService, msg); err != nil {
+				log.Warn("websocket_subscribe_failed",
+					"error", err.Error(),
+					"room_id", msg.RoomId,
+				)
+				c.reply(event.NewErrorEvent(err))
+			}
+			continue
+
+		case models.EventUnsubscribe:
+			if err := hub.Unsubscribe(msg.RoomId, c); err != nil {
+				log.Warn("websocket_unsubscribe_failed",
+					"error", err.Error(),
+					"room_id", msg.RoomId,
+				)
+				c.reply(event.NewErrorEvent(err))
+				continue
+			}
+			c.reply(&models.UnsubscribedEvent{Data: models.UnsubscribedPayload{RoomId: msg.RoomId}})
+			continue
+		}
+
+		if !hub.IsSubscribed(msg.RoomId, c) {
+			log.Warn("websocket_event_for_unsubscribed_room",
+				"event_type", msg.Type,
+				"room_id", msg.RoomId,
+			)
+			c.reply(event.NewErrorEvent(event.ErrNotSubscribed))
+			continue
+		}
+
+		evt, err := chatService.HandleIncoming(hub.ctx, c.id, msg)
 		if err != nil {
 			log.Warn("websocket_handle_incoming_failed",
 				"error", err.Error(),
 				"event_type", msg.Type,
 			)
-			c.send <- event.NewErrorEvent(err)
+			c.reply(event.NewErrorEvent(err))
+			continue
+		}
+
+		if evt == nil {
 			continue
 		}
 
 		log.Debug("websocket_broadcasting_event",
 			"event_type", evt.Type(),
-			"room_id", c.roomID,
+			"room_id", msg.RoomId,
 		)
 
-		hub.Broadcast(c.roomID, evt)
+		broadcaster.Broadcast(msg.RoomId, evt)
+	}
+}
+
+// subscribe adds the socket to a room's broadcasts once the user is known to
+// be a member of it. A client reconnecting sends the epoch and last sequence
+// it saw in the room to have the missed events replayed.
+func (c *Client) subscribe(hub *Hub, chatService *event.EventService, msg models.IncomingEvent) error {
+	var resume *resumePoint
+	if len(msg.Data) > 0 && string(msg.Data) != "null" {
+		var point resumePoint
+		if err := json.Unmarshal(msg.Data, &point); err != nil {
+			return event.ErrInvalidPayload
+		}
+		if point.Epoch != "" {
+			resume = &point
+		}
+	}
+
+	if err := chatService.AuthorizeRoom(hub.ctx, msg.RoomId, c.id); err != nil {
+		return err
+	}
+
+	return hub.Subscribe(msg.RoomId, c, resume)
+}
+
+// reply queues an event for this client only, dropping it if the socket is
+// already closing.
+func (c *Client) reply(evt models.ChatEvent) {
+	select {
+	case c.send <- evt:
+	case <-c.done:
+	}
+}
+
+// refreshAuth extends the lifetime of the socket with a freshly issued
+// access token, which must belong to the same user the socket was opened for.
+func (c *Client) refreshAuth(authService *auth.AuthService, msg models.IncomingEvent) error {
+	var payload struct {
+		Token string `json:"token"`
 	}
+
+	if err := json.Unmarshal(msg.Data, &payload); err != nil {
+		return event.ErrInvalidPayload
+	}
+
+	userID, expiresAt, err := authService.ParseAccessToken(payload.Token)
+	if err != nil || userID != c.id {
+		return event.ErrUnauthorized
+	}
+
+	// Only the latest expiry matters, drop any refresh not yet picked up
+	select {
+	case <-c.refresh:
+	default:
+	}
+	c.refresh <- expiresAt
+
+	return nil
 }
 
 func (c *Client) writePump() {
-	log := logger.WithUserID(int(c.id)).With("room_id", int(c.roomID))
+	log := logger.WithUserID(int(c.id))
 
 	log.Info("websocket_write_pump_started")
 
 	ticker := time.NewTicker(54 * time.Second)
+	expiry := time.NewTimer(time.Until(c.expiresAt))
 	defer func() {
 		log.Info("websocket_write_pump_ending")
 		ticker.Stop()
+		expiry.Stop()
+		close(c.done)
 		c.conn.Close()
 	}()
 
@@ -121,6 +273,11 @@ func (c *Client) writePump() {
 				Payload: evt.Payload(),
 			}
 
+			if re, ok := evt.(roomEvent); ok {
+				outgoingEvent.RoomId = re.roomID
+				outgoingEvent.Seq = re.seq
+			}
+
 			// Calculate payload size by marshaling to JSON
 			payloadSize := 0
 			if payloadBytes, err := json.Marshal(outgoingEvent.Payload); err == nil {
@@ -144,6 +301,25 @@ func (c *Client) writePump() {
 				"event_type", evt.Type(),
 			)
 
+		case expiresAt := <-c.refresh:
+			log.Debug("websocket_auth_refreshed", "expires_at", expiresAt)
+			expiry.Reset(time.Until(expiresAt))
+
+		case <-expiry.C:
+			log.Info("websocket_token_expired")
+			c.conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "access token expired"))
+			return
+
+		case frame := <-c.kicked:
+			log.Info("websocket_client_kicked",
+				"code", frame.code,
+				"reason", frame.reason,
+			)
+			c.conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(frame.code, frame.reason))
+			return
+
 		case <-ticker.C:
 			log.Debug("websocket_sending_ping")
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
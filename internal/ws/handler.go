@@ -1,8 +1,10 @@
 package ws
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/ayushgpt01/chatRoomGo/internal/auth"
 	"github.com/ayushgpt01/chatRoomGo/internal/event"
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
@@ -11,55 +13,91 @@ import (
 
 type Wshandler struct {
 	hub         *Hub
+	broadcaster models.HubBroadcaster
 	chatService *event.EventService
+	authService *auth.AuthService
 }
 
-func NewWSHandler(hub *Hub, chatService *event.EventService) *Wshandler {
+func NewWSHandler(hub *Hub, broadcaster models.HubBroadcaster, chatService *event.EventService, authService *auth.AuthService) *Wshandler {
 	return &Wshandler{
 		hub,
+		broadcaster,
 		chatService,
+		authService,
 	}
 }
 
+// Browsers cannot set an Authorization header on a WebSocket handshake, so
+// the access token travels as the second entry of Sec-WebSocket-Protocol:
+// `new WebSocket(url, ["access_token", token])`.
+const accessTokenProtocol = "access_token"
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{accessTokenProtocol},
+}
+
+func accessTokenFromRequest(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == accessTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
 }
 
 func (h *Wshandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	roomIdStr := r.URL.Query().Get("room")
-	userIdStr := r.URL.Query().Get("user")
 	remoteAddr := r.RemoteAddr
 	userAgent := r.UserAgent()
 
 	logger.Info("websocket_connection_attempt",
 		"room_id", roomIdStr,
-		"user_id", userIdStr,
 		"remote_addr", remoteAddr,
 		"user_agent", userAgent,
 	)
 
-	userID, err := models.ParseUserId(userIdStr)
+	userID, expiresAt, err := h.authService.ParseAccessToken(accessTokenFromRequest(r))
 	if err != nil {
-		logger.Warn("websocket_invalid_user_id",
-			"user_id_str", userIdStr,
+		logger.Warn("websocket_auth_failed",
 			"error", err.Error(),
 			"remote_addr", remoteAddr,
 		)
-		http.Error(w, "room and user required", http.StatusBadRequest)
+		http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	roomId, err := models.ParseRoomId(roomIdStr)
-	if err != nil {
-		logger.Warn("websocket_invalid_room_id",
-			"room_id_str", roomIdStr,
-			"error", err.Error(),
-			"remote_addr", remoteAddr,
-		)
-		http.Error(w, "room and user required", http.StatusBadRequest)
-		return
+	// The room query parameter is optional: it subscribes the socket to one
+	// room straight away, more can be added with room.subscribe.
+	var roomId models.RoomId
+	if roomIdStr != "" {
+		roomId, err = models.ParseRoomId(roomIdStr)
+		if err != nil {
+			logger.Warn("websocket_invalid_room_id",
+				"room_id_str", roomIdStr,
+				"error", err.Error(),
+				"remote_addr", remoteAddr,
+			)
+			http.Error(w, "Invalid room id", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.chatService.AuthorizeRoom(r.Context(), roomId, userID); err != nil {
+			logger.Warn("websocket_room_forbidden",
+				"error", err.Error(),
+				"user_id", userID,
+				"room_id", roomId,
+			)
+			if errors.Is(err, event.ErrForbidden) || errors.Is(err, event.ErrNotRoomMember) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// upgrade
@@ -83,23 +121,22 @@ func (h *Wshandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer ws.Close()
 
 	// create client
-	client := Client{
-		id:     userID,
-		conn:   ws,
-		send:   make(chan models.ChatEvent),
-		roomID: roomId,
-	}
-
-	// register client in room
-	err = h.hub.RegisterClient(roomId, &client)
-	if err != nil {
-		logger.Error("websocket_register_client_failed",
-			"error", err.Error(),
-			"user_id", userID,
-			"room_id", roomId,
-		)
-		ws.Close()
-		return
+	client := newClient(userID, ws, h.hub.config.SendQueueSize, expiresAt)
+
+	h.hub.Connect(client)
+
+	if roomId != 0 {
+		err = h.hub.Subscribe(roomId, client, nil)
+		if err != nil {
+			logger.Error("websocket_register_client_failed",
+				"error", err.Error(),
+				"user_id", userID,
+				"room_id", roomId,
+			)
+			h.hub.Disconnect(client)
+			ws.Close()
+			return
+		}
 	}
 
 	logger.Info("websocket_client_registered",
@@ -109,5 +146,5 @@ func (h *Wshandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// start pumps
 	go client.writePump()
-	client.readPump(h.hub, h.chatService)
+	client.readPump(h.hub, h.broadcaster, h.chatService, h.authService)
 }
@@ -4,31 +4,96 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ayushgpt01/chatRoomGo/internal/event"
 	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/google/uuid"
 )
 
+// Config tunes how the hub treats clients that cannot keep up.
+type Config struct {
+	// SendQueueSize is how many events may wait for a client's socket
+	SendQueueSize int
+	// SlowClientTimeout is how long a client's queue may stay full before
+	// the client is disconnected
+	SlowClientTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SendQueueSize:     256,
+		SlowClientTimeout: 10 * time.Second,
+	}
+}
+
+// Stats counts what the hub had to give up on because of slow clients.
+type Stats struct {
+	EventsDropped       uint64 `json:"eventsDropped"`
+	ClientsDisconnected uint64 `json:"clientsDisconnected"`
+}
+
+type hubStats struct {
+	eventsDropped       atomic.Uint64
+	clientsDisconnected atomic.Uint64
+}
+
 type Hub struct {
-	ctx   context.Context
+	ctx    context.Context
+	config Config
+	stats  hubStats
+	// epoch identifies this hub's run; room sequence numbers restart with it
+	epoch string
 	rooms map[models.RoomId]*Room
-	mu    sync.RWMutex
+	// clients maps every connected client to the rooms it is subscribed to
+	clients map[*Client]map[models.RoomId]bool
+	mu      sync.RWMutex
+
+	// presence is told about connects, disconnects and activity when set
+	presence models.PresenceTracker
 }
 
-func NewHub(ctx context.Context) *Hub {
+func NewHub(ctx context.Context, config Config) *Hub {
+	defaults := DefaultConfig()
+	if config.SendQueueSize <= 0 {
+		config.SendQueueSize = defaults.SendQueueSize
+	}
+	if config.SlowClientTimeout <= 0 {
+		config.SlowClientTimeout = defaults.SlowClientTimeout
+	}
+
 	return &Hub{
-		ctx:   ctx,
-		rooms: make(map[models.RoomId]*Room),
-		mu:    sync.RWMutex{},
+		ctx:     ctx,
+		config:  config,
+		epoch:   uuid.New().String(),
+		rooms:   make(map[models.RoomId]*Room),
+		clients: make(map[*Client]map[models.RoomId]bool),
+		mu:      sync.RWMutex{},
 	}
 }
 
 func (hub *Hub) AddRoom(roomId models.RoomId) *Room {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	return hub.addRoomLocked(roomId)
+}
+
+// addRoomLocked returns the running room for roomId, starting one if needed.
+// Callers must hold hub.mu for writing.
+func (hub *Hub) addRoomLocked(roomId models.RoomId) *Room {
+	if room := hub.rooms[roomId]; room != nil {
+		return room
+	}
+
 	roomCtx, roomCancel := context.WithCancel(hub.ctx)
 
 	room := &Room{
 		id:         roomId,
-		register:   make(chan *Client),
+		hub:        hub,
+		register:   make(chan subscription),
 		unregister: make(chan *Client),
 		broadcast:  make(chan models.ChatEvent),
 		clients:    make(map[*Client]bool),
@@ -36,9 +101,7 @@ func (hub *Hub) AddRoom(roomId models.RoomId) *Room {
 		cancel:     roomCancel,
 	}
 
-	hub.mu.Lock()
 	hub.rooms[roomId] = room
-	hub.mu.Unlock()
 
 	go room.Run()
 
@@ -56,6 +119,11 @@ func (hub *Hub) DeleteRoom(id models.RoomId) error {
 
 	room.cancel()
 	delete(hub.rooms, id)
+
+	for _, rooms := range hub.clients {
+		delete(rooms, id)
+	}
+
 	return nil
 }
 
@@ -77,32 +145,118 @@ func (hub *Hub) RoomExists(id models.RoomId) bool {
 	return hub.rooms[id] != nil
 }
 
-func (hub *Hub) RegisterClient(roomId models.RoomId, client *Client) error {
-	hub.mu.RLock()
-	room := hub.rooms[roomId]
-	hub.mu.RUnlock()
+// TrackPresence reports client connects, disconnects and activity to
+// tracker. It must be called before the hub serves any client.
+func (hub *Hub) TrackPresence(tracker models.PresenceTracker) {
+	hub.presence = tracker
+}
 
-	if room == nil {
-		room = hub.AddRoom(roomId)
+// Connect tracks a newly opened socket. It receives nothing until it
+// subscribes to at least one room.
+func (hub *Hub) Connect(client *Client) {
+	hub.mu.Lock()
+	hub.clients[client] = make(map[models.RoomId]bool)
+	hub.mu.Unlock()
+
+	if hub.presence != nil {
+		hub.presence.Connect(client.id)
+	}
+}
+
+// Active records that the client's user did something on the socket.
+func (hub *Hub) Active(client *Client) {
+	if hub.presence != nil {
+		hub.presence.Touch(client.id)
+	}
+}
+
+// Disconnect removes the client from every room it is subscribed to and
+// closes its send channel, which stops the write pump.
+func (hub *Hub) Disconnect(client *Client) {
+	hub.mu.Lock()
+	rooms, ok := hub.clients[client]
+	delete(hub.clients, client)
+	subscribed := make([]*Room, 0, len(rooms))
+	for roomId := range rooms {
+		if room := hub.rooms[roomId]; room != nil {
+			subscribed = append(subscribed, room)
+		}
+	}
+	hub.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, room := range subscribed {
+		room.leave(client)
+	}
+
+	close(client.send)
+
+	if hub.presence != nil {
+		hub.presence.Disconnect(client.id)
+	}
+}
+
+// Subscribe adds the client to a room. The room confirms with a subscribed
+// event; when resume is set it then replays the events the client missed,
+// or asks it to resync if they are no longer buffered.
+func (hub *Hub) Subscribe(roomId models.RoomId, client *Client, resume *resumePoint) error {
+	hub.mu.Lock()
+	rooms, ok := hub.clients[client]
+	if !ok {
+		hub.mu.Unlock()
+		return fmt.Errorf("client for user %d is not connected", client.id)
+	}
+
+	room := hub.addRoomLocked(roomId)
+	rooms[roomId] = true
+	hub.mu.Unlock()
+
+	if !room.join(client, resume) {
+		hub.forget(roomId, client)
+		return fmt.Errorf("room %d is closed", roomId)
 	}
 
-	room.register <- client
 	return nil
 }
 
-func (hub *Hub) UnregisterClient(roomId models.RoomId, client *Client) error {
-	hub.mu.RLock()
+// Unsubscribe removes the client from a room it is subscribed to.
+func (hub *Hub) Unsubscribe(roomId models.RoomId, client *Client) error {
+	hub.mu.Lock()
+	rooms := hub.clients[client]
+	subscribed := rooms[roomId]
+	delete(rooms, roomId)
 	room := hub.rooms[roomId]
-	hub.mu.RUnlock()
+	hub.mu.Unlock()
 
-	if room == nil {
-		return fmt.Errorf("No room found with id %d", roomId)
+	if !subscribed || room == nil {
+		return fmt.Errorf("unsubscribe from room %d: %w", roomId, event.ErrNotSubscribed)
 	}
 
-	room.unregister <- client
+	room.leave(client)
 	return nil
 }
 
+func (hub *Hub) IsSubscribed(roomId models.RoomId, client *Client) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	return hub.clients[client][roomId]
+}
+
+// forget drops the hub's record of a subscription the room itself ended,
+// e.g. when the user left the room.
+func (hub *Hub) forget(roomId models.RoomId, client *Client) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if rooms := hub.clients[client]; rooms != nil {
+		delete(rooms, roomId)
+	}
+}
+
 func (hub *Hub) Broadcast(roomId models.RoomId, evt models.ChatEvent) error {
 	hub.mu.RLock()
 	room := hub.rooms[roomId]
@@ -112,10 +266,61 @@ func (hub *Hub) Broadcast(roomId models.RoomId, evt models.ChatEvent) error {
 		return fmt.Errorf("No room found with id %d", roomId)
 	}
 
-	room.broadcast <- evt
+	room.publish(evt)
 	return nil
 }
 
+// SendToUser delivers an event to every socket the user has open on this
+// server, whichever rooms they are subscribed to.
+func (hub *Hub) SendToUser(userId models.UserId, evt models.ChatEvent) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for client := range hub.clients {
+		if client.id != userId {
+			continue
+		}
+
+		select {
+		case client.send <- evt:
+		default:
+			hub.stats.eventsDropped.Add(1)
+		}
+	}
+}
+
+func (hub *Hub) Stats() Stats {
+	return Stats{
+		EventsDropped:       hub.stats.eventsDropped.Load(),
+		ClientsDisconnected: hub.stats.clientsDisconnected.Load(),
+	}
+}
+
+// ReportStats logs the slow client counters every interval while they keep
+// changing, until the hub shuts down.
+func (hub *Hub) ReportStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last Stats
+	for {
+		select {
+		case <-hub.ctx.Done():
+			return
+		case <-ticker.C:
+			stats := hub.Stats()
+			if stats == last {
+				continue
+			}
+			logger.Warn("websocket_slow_client_stats",
+				"events_dropped", stats.EventsDropped,
+				"clients_disconnected", stats.ClientsDisconnected,
+			)
+			last = stats
+		}
+	}
+}
+
 func (hub *Hub) Cleanup() {
 	<-hub.ctx.Done()
 	logger.Info("Cleaning up Hub...")
@@ -0,0 +1,232 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/event"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+func newTestClient(hub *Hub, userID models.UserId) *Client {
+	client := newClient(userID, nil, 2*replayBufferSize, time.Now().Add(time.Hour))
+	hub.Connect(client)
+	return client
+}
+
+func typingEvent(roomID models.RoomId, userID models.UserId) models.ChatEvent {
+	return &models.UserStoppedTypingEvent{
+		Data: models.UserStoppedTypingPayload{RoomId: roomID, UserId: userID},
+	}
+}
+
+func nextEvent(t *testing.T, client *Client) models.ChatEvent {
+	t.Helper()
+
+	select {
+	case evt := <-client.send:
+		return evt
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for event")
+		return nil
+	}
+}
+
+func expectSubscribed(t *testing.T, client *Client) models.SubscribedPayload {
+	t.Helper()
+
+	evt, ok := nextEvent(t, client).(*models.SubscribedEvent)
+	if !ok {
+		t.Fatalf("expected subscribed event")
+	}
+	return evt.Data
+}
+
+func TestResumeReplaysMissedEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(ctx, DefaultConfig())
+	const roomID models.RoomId = 1
+
+	first := newTestClient(hub, 1)
+	if err := hub.Subscribe(roomID, first, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	sub := expectSubscribed(t, first)
+
+	for range 3 {
+		hub.Broadcast(roomID, typingEvent(roomID, 1))
+	}
+
+	// Pretend the socket dropped after seeing only the first event
+	second := newTestClient(hub, 1)
+	resume := &resumePoint{Epoch: sub.Epoch, LastSeq: sub.Seq + 1}
+	if err := hub.Subscribe(roomID, second, resume); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	if got := expectSubscribed(t, second); got.Seq != 3 {
+		t.Fatalf("expected current seq 3, got %d", got.Seq)
+	}
+
+	for _, want := range []uint64{2, 3} {
+		evt, ok := nextEvent(t, second).(roomEvent)
+		if !ok {
+			t.Fatalf("expected replayed room event")
+		}
+		if evt.seq != want {
+			t.Fatalf("expected seq %d, got %d", want, evt.seq)
+		}
+	}
+}
+
+func TestResumeOutsideBufferRequiresResync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(ctx, DefaultConfig())
+	const roomID models.RoomId = 1
+
+	first := newTestClient(hub, 1)
+	if err := hub.Subscribe(roomID, first, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	sub := expectSubscribed(t, first)
+
+	for range replayBufferSize + 5 {
+		hub.Broadcast(roomID, typingEvent(roomID, 1))
+	}
+
+	tests := []struct {
+		name   string
+		resume resumePoint
+	}{
+		{name: "gap too large", resume: resumePoint{Epoch: sub.Epoch, LastSeq: 1}},
+		{name: "other epoch", resume: resumePoint{Epoch: "stale", LastSeq: replayBufferSize}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(hub, 2)
+			if err := hub.Subscribe(roomID, client, &tt.resume); err != nil {
+				t.Fatalf("resume failed: %v", err)
+			}
+
+			expectSubscribed(t, client)
+
+			if _, ok := nextEvent(t, client).(*models.ResyncRequiredEvent); !ok {
+				t.Fatalf("expected resync_required event")
+			}
+		})
+	}
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(ctx, Config{SendQueueSize: 1, SlowClientTimeout: time.Nanosecond})
+	const roomID models.RoomId = 1
+
+	// The subscribed ack fills the queue and is never read
+	client := newClient(1, nil, hub.config.SendQueueSize, time.Now().Add(time.Hour))
+	hub.Connect(client)
+	if err := hub.Subscribe(roomID, client, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	for range 3 {
+		hub.Broadcast(roomID, typingEvent(roomID, 1))
+	}
+
+	select {
+	case frame := <-client.kicked:
+		if frame.code != websocket.CloseTryAgainLater {
+			t.Fatalf("expected close code %d, got %d", websocket.CloseTryAgainLater, frame.code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for slow client to be kicked")
+	}
+
+	// Once the next broadcast is accepted the kick has been counted
+	hub.Broadcast(roomID, typingEvent(roomID, 1))
+
+	stats := hub.Stats()
+	if stats.ClientsDisconnected != 1 {
+		t.Fatalf("expected 1 disconnected client, got %d", stats.ClientsDisconnected)
+	}
+	if stats.EventsDropped < 2 {
+		t.Fatalf("expected at least 2 dropped events, got %d", stats.EventsDropped)
+	}
+}
+
+func TestRoomDeletedEndsSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(ctx, DefaultConfig())
+	const roomID models.RoomId = 1
+
+	client := newTestClient(hub, 1)
+	if err := hub.Subscribe(roomID, client, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	expectSubscribed(t, client)
+
+	hub.Broadcast(roomID, &models.RoomDeletedEvent{
+		Data: models.RoomDeletedPayload{RoomId: roomID, DeletedBy: 1},
+	})
+
+	evt, ok := nextEvent(t, client).(roomEvent)
+	if !ok || evt.Type() != string(models.EventRoomDeleted) {
+		t.Fatalf("expected room_deleted event")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for hub.RoomExists(roomID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("room still running after deletion")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if hub.IsSubscribed(roomID, client) {
+		t.Fatalf("client still subscribed to deleted room")
+	}
+
+	// The socket itself stays open for the user's other rooms
+	if err := hub.Subscribe(2, client, nil); err != nil {
+		t.Fatalf("subscribe to another room failed: %v", err)
+	}
+	expectSubscribed(t, client)
+}
+
+func TestUnsubscribeRequiresSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(ctx, DefaultConfig())
+	const roomID models.RoomId = 1
+
+	client := newTestClient(hub, 1)
+	if err := hub.Unsubscribe(roomID, client); !errors.Is(err, event.ErrNotSubscribed) {
+		t.Fatalf("unsubscribe before subscribing = %v, want %v", err, event.ErrNotSubscribed)
+	}
+
+	if err := hub.Subscribe(roomID, client, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	expectSubscribed(t, client)
+
+	if err := hub.Unsubscribe(roomID, client); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+
+	if err := hub.Unsubscribe(roomID, client); !errors.Is(err, event.ErrNotSubscribed) {
+		t.Fatalf("second unsubscribe = %v, want %v", err, event.ErrNotSubscribed)
+	}
+}
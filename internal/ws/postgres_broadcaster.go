@@ -0,0 +1,206 @@
+package ws
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ayushgpt01/chatRoomGo/internal/logger"
+	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const postgresBroadcastChannel = "chat_room_events"
+
+// Postgres rejects NOTIFY payloads of this many bytes or more
+const maxNotifyPayload = 8000
+
+// Stored envelopes are kept this long for listeners to load them
+const storedEnvelopeRetention = 5 * time.Minute
+
+// PostgresBroadcaster fans events out to every server instance through
+// Postgres LISTEN/NOTIFY. Broadcast only publishes; each instance, including
+// the sender, delivers to its own hub when the notification comes back.
+type PostgresBroadcaster struct {
+	ctx context.Context
+	db  *sql.DB
+	hub *Hub
+}
+
+func NewPostgresBroadcaster(ctx context.Context, db *sql.DB, hub *Hub) *PostgresBroadcaster {
+	return &PostgresBroadcaster{ctx, db, hub}
+}
+
+func (b *PostgresBroadcaster) Broadcast(roomId models.RoomId, evt models.ChatEvent) error {
+	return b.notify(broadcastEnvelope{RoomId: roomId}, evt)
+}
+
+func (b *PostgresBroadcaster) BroadcastToUser(userId models.UserId, evt models.ChatEvent) error {
+	return b.notify(broadcastEnvelope{UserId: userId}, evt)
+}
+
+func (b *PostgresBroadcaster) notify(env broadcastEnvelope, evt models.ChatEvent) error {
+	payload, err := json.Marshal(evt.Payload())
+	if err != nil {
+		return fmt.Errorf("marshal %s payload for room %d: %w", evt.Type(), env.RoomId, err)
+	}
+
+	env.Type = evt.Type()
+	env.Payload = payload
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal %s envelope for room %d: %w", evt.Type(), env.RoomId, err)
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+
+	if len(data) >= maxNotifyPayload {
+		data, err = b.store(ctx, data)
+		if err != nil {
+			logger.Error("broadcast_store_failed",
+				"error", err.Error(),
+				"event_type", evt.Type(),
+				"room_id", env.RoomId,
+				"user_id", env.UserId,
+			)
+			return fmt.Errorf("store %s for room %d: %w", evt.Type(), env.RoomId, err)
+		}
+	}
+
+	if _, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", postgresBroadcastChannel, string(data)); err != nil {
+		logger.Error("broadcast_notify_failed",
+			"error", err.Error(),
+			"event_type", evt.Type(),
+			"room_id", env.RoomId,
+			"user_id", env.UserId,
+		)
+		return fmt.Errorf("notify %s for room %d: %w", evt.Type(), env.RoomId, err)
+	}
+
+	return nil
+}
+
+// store saves an envelope too large to notify and returns the envelope that
+// points listeners at it, clearing out those kept past their retention.
+func (b *PostgresBroadcaster) store(ctx context.Context, data []byte) ([]byte, error) {
+	var id int64
+	err := b.db.QueryRowContext(ctx,
+		"INSERT INTO broadcast_events(envelope) VALUES($1) RETURNING id",
+		string(data)).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("inserting broadcast envelope: %w", err)
+	}
+
+	if _, err := b.db.ExecContext(ctx,
+		"DELETE FROM broadcast_events WHERE created_at < $1",
+		time.Now().Add(-storedEnvelopeRetention)); err != nil {
+		logger.Warn("broadcast_purge_failed", "error", err.Error())
+	}
+
+	return json.Marshal(broadcastEnvelope{StoredId: id})
+}
+
+// load reads back an envelope saved by store.
+func (b *PostgresBroadcaster) load(id int64) (broadcastEnvelope, error) {
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+
+	var env broadcastEnvelope
+	var data string
+	err := b.db.QueryRowContext(ctx, "SELECT envelope FROM broadcast_events WHERE id = $1", id).Scan(&data)
+	if err != nil {
+		return env, fmt.Errorf("loading broadcast envelope %d: %w", id, err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		return env, fmt.Errorf("decoding broadcast envelope %d: %w", id, err)
+	}
+
+	return env, nil
+}
+
+// Listen holds a dedicated connection on the channel and delivers every
+// notification to the local hub until ctx is cancelled, reconnecting with
+// backoff if the connection drops.
+func (b *PostgresBroadcaster) Listen() {
+	backoff := time.Second
+
+	for {
+		err := b.listen()
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		logger.Error("broadcast_listen_failed",
+			"error", err.Error(),
+			"retry_in", backoff.String(),
+		)
+
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func (b *PostgresBroadcaster) listen() error {
+	conn, err := b.db.Conn(b.ctx)
+	if err != nil {
+		return fmt.Errorf("acquire listen connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+
+		if _, err := pgConn.Exec(b.ctx, "LISTEN "+pgx.Identifier{postgresBroadcastChannel}.Sanitize()); err != nil {
+			return fmt.Errorf("listen on %s: %w", postgresBroadcastChannel, err)
+		}
+
+		logger.Info("broadcast_listening", "channel", postgresBroadcastChannel)
+
+		for {
+			notification, err := pgConn.WaitForNotification(b.ctx)
+			if err != nil {
+				return fmt.Errorf("wait for notification: %w", err)
+			}
+
+			var env broadcastEnvelope
+			if err := json.Unmarshal([]byte(notification.Payload), &env); err != nil {
+				logger.Warn("broadcast_invalid_envelope",
+					"error", err.Error(),
+					"payload", notification.Payload,
+				)
+				continue
+			}
+
+			if env.StoredId != 0 {
+				stored, err := b.load(env.StoredId)
+				if err != nil {
+					logger.Warn("broadcast_load_failed",
+						"error", err.Error(),
+						"stored_id", env.StoredId,
+					)
+					continue
+				}
+				env = stored
+			}
+
+			if env.UserId != 0 {
+				b.hub.SendToUser(env.UserId, decodeEnvelope(env))
+				continue
+			}
+
+			// No local sockets in this room, nothing to deliver
+			b.hub.Broadcast(env.RoomId, decodeEnvelope(env))
+		}
+	})
+}
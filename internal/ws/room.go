@@ -2,21 +2,55 @@ package ws
 
 import (
 	"context"
+	"time"
 
+	"github.com/ayushgpt01/chatRoomGo/internal/logger"
 	"github.com/ayushgpt01/chatRoomGo/internal/models"
+	"github.com/gorilla/websocket"
 )
 
+// replayBufferSize is how many recent events a room keeps for clients
+// resuming after a reconnect.
+const replayBufferSize = 256
+
 type Room struct {
 	id         models.RoomId
-	register   chan *Client
+	hub        *Hub
+	register   chan subscription
 	unregister chan *Client
 	broadcast  chan models.ChatEvent
 	clients    map[*Client]bool
 
+	// seq is the sequence number of the last event broadcast in the room,
+	// history holds the most recent of those events, oldest first.
+	seq     uint64
+	history []roomEvent
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// roomEvent tags an event with the room it was broadcast to and its place
+// in the room's sequence, so a client subscribed to several rooms can tell
+// them apart and notice gaps.
+type roomEvent struct {
+	models.ChatEvent
+	roomID models.RoomId
+	seq    uint64
+}
+
+// resumePoint is the last event a client saw in a room before its socket
+// dropped.
+type resumePoint struct {
+	Epoch   string `json:"epoch"`
+	LastSeq uint64 `json:"lastSeq"`
+}
+
+type subscription struct {
+	client *Client
+	resume *resumePoint
+}
+
 func (r *Room) Run() {
 	defer r.Cleanup()
 
@@ -25,32 +59,170 @@ func (r *Room) Run() {
 		case <-r.ctx.Done():
 			return
 
-		case client := <-r.register:
-			r.clients[client] = true
+		case sub := <-r.register:
+			r.clients[sub.client] = true
+			r.acknowledge(sub)
 
 		case client := <-r.unregister:
 			delete(r.clients, client)
-			close(client.send)
 
 		case msg := <-r.broadcast:
+			r.seq++
+			evt := roomEvent{ChatEvent: msg, roomID: r.id, seq: r.seq}
+			r.record(evt)
+
 			for client := range r.clients {
 				select {
-				case client.send <- msg:
+				case client.send <- evt:
+					client.slowSince.Store(0)
 				default:
-					// Dropping slow clients. Need to handle later
+					// The client can spot the gap from the sequence numbers
+					r.hub.stats.eventsDropped.Add(1)
+					r.throttle(client)
 				}
 			}
+
+			// A member who left the room must stop receiving its events
+			if left, ok := msg.(*models.UserLeftRoomEvent); ok {
+				r.dropUser(left.Data.UserID)
+			}
+
+			// Nothing follows a room's deletion, so its subscriptions end
+			// once the clients have it queued
+			if _, ok := msg.(*models.RoomDeletedEvent); ok {
+				r.hub.DeleteRoom(r.id)
+				return
+			}
 		}
 	}
 }
 
-func (room *Room) Cleanup() {
-	for client := range room.clients {
-		close(client.send)
+// throttle is called when a client's queue is full. A client that stays
+// full for longer than the configured timeout is disconnected so it can
+// reconnect and resume instead of silently missing events.
+func (r *Room) throttle(client *Client) {
+	now := time.Now()
+	if client.slowSince.CompareAndSwap(0, now.UnixNano()) {
+		return
 	}
 
+	since := time.Unix(0, client.slowSince.Load())
+	if now.Sub(since) < r.hub.config.SlowClientTimeout {
+		return
+	}
+
+	if client.kick(websocket.CloseTryAgainLater, "client too slow") {
+		r.hub.stats.clientsDisconnected.Add(1)
+		logger.Warn("websocket_slow_client_disconnected",
+			"user_id", client.id,
+			"room_id", r.id,
+			"full_for", now.Sub(since).String(),
+		)
+	}
+}
+
+func (r *Room) record(evt roomEvent) {
+	if len(r.history) == replayBufferSize {
+		copy(r.history, r.history[1:])
+		r.history = r.history[:replayBufferSize-1]
+	}
+	r.history = append(r.history, evt)
+}
+
+// acknowledge confirms a subscription and, for a resuming client, replays
+// what it missed. It runs inside the Run loop so nothing broadcast in the
+// meantime can slip between the replay and live events.
+func (r *Room) acknowledge(sub subscription) {
+	if !r.deliver(sub.client, &models.SubscribedEvent{
+		Data: models.SubscribedPayload{RoomId: r.id, Epoch: r.hub.epoch, Seq: r.seq},
+	}) {
+		return
+	}
+
+	if sub.resume == nil || sub.resume.LastSeq == r.seq {
+		return
+	}
+
+	missed, ok := r.missedSince(*sub.resume)
+	if !ok {
+		r.deliver(sub.client, &models.ResyncRequiredEvent{
+			Data: models.ResyncRequiredPayload{RoomId: r.id, Epoch: r.hub.epoch, Seq: r.seq},
+		})
+		return
+	}
+
+	for _, evt := range missed {
+		if !r.deliver(sub.client, evt) {
+			return
+		}
+	}
+}
+
+// missedSince returns the buffered events after the resume point, or false
+// when the point is from another hub or older than the buffer reaches.
+func (r *Room) missedSince(from resumePoint) ([]roomEvent, bool) {
+	if from.Epoch != r.hub.epoch || from.LastSeq > r.seq {
+		return nil, false
+	}
+
+	oldest := r.seq - uint64(len(r.history)) + 1
+	if from.LastSeq+1 < oldest {
+		return nil, false
+	}
+
+	return r.history[from.LastSeq+1-oldest:], true
+}
+
+// deliver waits for the client to take evt, giving up if its socket has
+// closed or the room is shutting down.
+func (r *Room) deliver(client *Client, evt models.ChatEvent) bool {
+	select {
+	case client.send <- evt:
+		return true
+	case <-client.done:
+		return false
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+func (r *Room) dropUser(userID models.UserId) {
+	for client := range r.clients {
+		if client.id == userID {
+			delete(r.clients, client)
+			r.hub.forget(r.id, client)
+		}
+	}
+}
+
+// join, leave and publish hand work to the Run loop, giving up if the room
+// has already been shut down.
+func (r *Room) join(client *Client, resume *resumePoint) bool {
+	select {
+	case r.register <- subscription{client: client, resume: resume}:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+func (r *Room) leave(client *Client) {
+	select {
+	case r.unregister <- client:
+	case <-r.ctx.Done():
+	}
+}
+
+func (r *Room) publish(evt models.ChatEvent) {
+	select {
+	case r.broadcast <- evt:
+	case <-r.ctx.Done():
+	}
+}
+
+// Cleanup forgets the room's clients. Their send channels belong to the hub
+// connection and are closed on Disconnect, since a client can outlive a room.
+func (room *Room) Cleanup() {
 	room.clients = nil
-	close(room.broadcast)
-	close(room.register)
-	close(room.unregister)
+	room.history = nil
 }
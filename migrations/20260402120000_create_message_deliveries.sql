@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_deliveries(
+    message_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT pk_message_deliveries PRIMARY KEY (message_id, user_id),
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_deliveries_user_id ON message_deliveries(user_id);
+
+-- A message is only delivered once every recipient has acknowledged it
+ALTER TABLE messages ALTER COLUMN delivered SET DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE messages ALTER COLUMN delivered SET DEFAULT TRUE;
+DROP TABLE IF EXISTS message_deliveries;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id BIGINT DEFAULT NULL;
+ALTER TABLE messages ADD CONSTRAINT fk_parent FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages(parent_id, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_parent_id;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_parent;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_mentions(
+    message_id BIGINT NOT NULL,
+    kind TEXT NOT NULL,
+    user_id BIGINT,
+    start_offset INT NOT NULL,
+    end_offset INT NOT NULL,
+
+    CONSTRAINT pk_message_mentions PRIMARY KEY (message_id, start_offset),
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_mention_kind CHECK (kind IN ('user', 'room', 'here'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_mentions;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by BIGINT DEFAULT NULL;
+ALTER TABLE messages ADD CONSTRAINT fk_deleted_by FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_deleted_at;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_deleted_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_by;
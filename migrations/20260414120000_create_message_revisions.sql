@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_revisions(
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    message_id BIGINT NOT NULL,
+    content TEXT NOT NULL,
+    edited_by BIGINT NOT NULL,
+    replaced_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_edited_by FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_revisions_message_id ON message_revisions(message_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_revisions;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_attachments(
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    room_id BIGINT NOT NULL,
+    uploaded_by BIGINT NOT NULL,
+    message_id BIGINT DEFAULT NULL,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    thumbnail_key TEXT DEFAULT NULL,
+    width INTEGER DEFAULT NULL,
+    height INTEGER DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT fk_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE CASCADE,
+    -- Purging a message leaves its attachments unlinked for the orphan sweep,
+    -- which also removes their blobs
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_attachments_message_id ON message_attachments(message_id, id);
+CREATE INDEX IF NOT EXISTS idx_message_attachments_orphans ON message_attachments(created_at) WHERE message_id IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS message_attachments;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS room_pins(
+    room_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    pinned_by BIGINT DEFAULT NULL,
+    pinned_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT pk_room_pins PRIMARY KEY (room_id, message_id),
+    CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_pinned_by FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS room_pins;
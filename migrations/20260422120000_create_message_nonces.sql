@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_nonces(
+    user_id BIGINT NOT NULL,
+    nonce TEXT NOT NULL,
+    -- NULL while the send that claimed the nonce is still in flight
+    message_id BIGINT DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT pk_message_nonces PRIMARY KEY (user_id, nonce),
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_nonces_created_at ON message_nonces(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_nonces;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS scheduled_messages(
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    room_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    content TEXT NOT NULL,
+    send_at TIMESTAMPTZ NOT NULL,
+    -- pending until due, sending while the scheduler posts it, failed when
+    -- posting it did not work for good
+    status TEXT NOT NULL DEFAULT 'pending',
+    failure TEXT DEFAULT NULL,
+    claimed_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_status_send_at ON scheduled_messages(status, send_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_user_room ON scheduled_messages(user_id, room_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS scheduled_messages;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE room_members
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member'
+        CHECK (role IN ('owner', 'moderator', 'member'));
+
+-- Rooms made before roles existed go to whoever joined them first
+UPDATE room_members SET role = 'owner'
+WHERE (room_id, user_id) IN (
+    SELECT DISTINCT ON (room_id) room_id, user_id
+    FROM room_members
+    ORDER BY room_id, joined_at, user_id
+);
+
+-- +goose Down
+ALTER TABLE room_members DROP COLUMN IF EXISTS role;
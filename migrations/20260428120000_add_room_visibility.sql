@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'private'));
+
+-- +goose Down
+ALTER TABLE rooms DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS room_invites(
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    room_id BIGINT NOT NULL,
+    token TEXT NOT NULL,
+    created_by BIGINT DEFAULT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    -- NULL allows any number of uses
+    max_uses INT DEFAULT NULL,
+    uses INT NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT uq_room_invites_token UNIQUE (token),
+    CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_invites_room_id ON room_invites(room_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS room_invites;
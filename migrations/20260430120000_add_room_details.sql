@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS topic TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS topic;
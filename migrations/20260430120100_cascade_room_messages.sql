@@ -0,0 +1,10 @@
+-- +goose Up
+-- Deleting a room takes its messages with it
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_room;
+ALTER TABLE messages
+    ADD CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_room;
+ALTER TABLE messages
+    ADD CONSTRAINT fk_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE RESTRICT;
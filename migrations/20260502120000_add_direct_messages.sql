@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'room'
+        CHECK (kind IN ('room', 'dm')),
+    -- The sorted participant ids of a DM, so each set of users has one
+    ADD COLUMN IF NOT EXISTS dm_key TEXT DEFAULT NULL,
+    ADD CONSTRAINT uq_rooms_dm_key UNIQUE (dm_key);
+
+-- +goose Down
+ALTER TABLE rooms
+    DROP CONSTRAINT IF EXISTS uq_rooms_dm_key,
+    DROP COLUMN IF EXISTS dm_key,
+    DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- updated_at also moves on delivery and tombstoning, so edits get their own column
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ DEFAULT NULL;
+
+UPDATE messages m SET edited_at = (
+    SELECT MAX(v.replaced_at) FROM message_revisions v WHERE v.message_id = m.id
+)
+WHERE EXISTS (SELECT 1 FROM message_revisions v WHERE v.message_id = m.id);
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Envelopes too large for a NOTIFY payload wait here for the listeners
+CREATE TABLE IF NOT EXISTS broadcast_events(
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    envelope TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_events_created_at ON broadcast_events(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS broadcast_events;
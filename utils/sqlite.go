@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// EnsureSQLiteColumn adds a column to a table created before the column
+// existed, since CREATE TABLE IF NOT EXISTS leaves an older table as it is.
+// The definition follows the column name, as in ALTER TABLE ... ADD COLUMN.
+// It reports whether the column had to be added.
+func EnsureSQLiteColumn(ctx context.Context, db *sql.DB, table, column, definition string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)",
+		table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("checking column %s.%s: %w", table, column, err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return false, fmt.Errorf("adding column %s.%s: %w", table, column, err)
+	}
+
+	return true, nil
+}